@@ -0,0 +1,388 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"fmt"
+	"github.com/lawrencewoodman/dlit"
+	"go/token"
+	"math"
+	"sort"
+)
+
+// UnsupportedError indicates that an expression has a part that can't
+// be analysed
+type UnsupportedError struct {
+	Pos  Position
+	Expr string
+}
+
+func (e UnsupportedError) Error() string {
+	return fmt.Sprintf("%s: can't analyse: %s", e.Pos, e.Expr)
+}
+
+// Satisfiable returns whether there are values for the variables used
+// by e that make it true, along with an example of them.
+//
+// The analysis functions only support expressions made from
+// comparisons of a variable with a constant, variables used as bools
+// and the variables true and false, combined with &&, || and !.  Any
+// other part of an expression returns an UnsupportedError.  As the
+// variables true and false must be passed to an expression they are
+// included in an example if they are used.  An example is always
+// checked with EvalBool before it is returned.
+func Satisfiable(e *Expr) (map[string]*dlit.Literal, bool, error) {
+	return analyse([]*Expr{e}, []bool{true})
+}
+
+// Overlaps returns whether there are values for the variables used by
+// a and b that make both of them true, along with an example of them
+func Overlaps(a, b *Expr) (map[string]*dlit.Literal, bool, error) {
+	return analyse([]*Expr{a, b}, []bool{true, true})
+}
+
+// Implies returns whether b is true whenever a is true.  If it isn't,
+// an example of values for which a is true and b isn't is returned.
+func Implies(a, b *Expr) (map[string]*dlit.Literal, bool, error) {
+	vars, found, err := analyse([]*Expr{a, b}, []bool{true, false})
+	return vars, !found && err == nil, err
+}
+
+type formulaKind int
+
+const (
+	fConst formulaKind = iota
+	fAtom
+	fNot
+	fAnd
+	fOr
+)
+
+// formula is the boolean structure of an expression
+type formula struct {
+	kind  formulaKind
+	value bool       // for fConst
+	atom  int        // for fAtom, the index of the atom
+	args  []*formula // for fNot, fAnd and fOr
+}
+
+// atom is a comparison of a variable with a constant or, if op is
+// token.ILLEGAL, a variable used as a bool
+type atom struct {
+	varName   string
+	op        token.Token
+	value     *dlit.Literal
+	varOnLeft bool
+}
+
+// truth is the value of a formula when some variables may not have
+// been assigned
+type truth int
+
+const (
+	truthFalse truth = iota
+	truthTrue
+	truthUnknown
+)
+
+type analysis struct {
+	atoms []atom
+	// consts is the names of the variables true and false if used
+	consts map[string]bool
+}
+
+func analyse(exprs []*Expr, want []bool) (map[string]*dlit.Literal, bool, error) {
+	an := &analysis{consts: map[string]bool{}}
+	fs := make([]*formula, len(exprs))
+	for i, e := range exprs {
+		f, err := an.toFormula(e.Node)
+		if err != nil {
+			return nil, false, err
+		}
+		fs[i] = f
+	}
+	names, candidates := an.candidates()
+	vals := map[string]*dlit.Literal{}
+	for name := range an.consts {
+		vals[name] = dlit.MustNew(name == "true")
+	}
+
+	var search func(i int) bool
+	search = func(i int) bool {
+		for j, f := range fs {
+			t, hasErr := an.eval(f, vals)
+			if want[j] && (hasErr || t == truthFalse) {
+				return false
+			}
+			if i == len(names) && !want[j] && !hasErr && t == truthTrue {
+				return false
+			}
+		}
+		if i == len(names) {
+			return checkExample(exprs, want, vals)
+		}
+		for _, l := range candidates[i] {
+			vals[names[i]] = l
+			if search(i + 1) {
+				return true
+			}
+		}
+		delete(vals, names[i])
+		return false
+	}
+	if !search(0) {
+		return nil, false, nil
+	}
+	return vals, true, nil
+}
+
+// checkExample returns whether each expression is true for vals if it
+// is wanted to be and isn't true otherwise
+func checkExample(
+	exprs []*Expr,
+	want []bool,
+	vals map[string]*dlit.Literal,
+) bool {
+	for i, e := range exprs {
+		isTrue, err := e.EvalBool(vals)
+		if want[i] != (err == nil && isTrue) {
+			return false
+		}
+	}
+	return true
+}
+
+func (an *analysis) toFormula(n Node) (*formula, error) {
+	n = unparenNode(n)
+	if b, ok := boolConst(n); ok {
+		if v, isVar := n.(*VarNode); isVar {
+			an.consts[v.Name] = true
+		}
+		return &formula{kind: fConst, value: b}, nil
+	}
+	switch x := n.(type) {
+	case *VarNode:
+		return an.addAtom(atom{varName: x.Name, op: token.ILLEGAL}), nil
+	case *UnaryNode:
+		if x.Op == token.NOT {
+			f, err := an.toFormula(x.X)
+			if err != nil {
+				return nil, err
+			}
+			return &formula{kind: fNot, args: []*formula{f}}, nil
+		}
+	case *BinaryNode:
+		switch {
+		case x.Op == token.LAND || x.Op == token.LOR:
+			kind := fAnd
+			if x.Op == token.LOR {
+				kind = fOr
+			}
+			f := &formula{kind: kind}
+			for _, o := range flattenChain(x, x.Op) {
+				of, err := an.toFormula(o)
+				if err != nil {
+					return nil, err
+				}
+				f.args = append(f.args, of)
+			}
+			return f, nil
+		case isComparisonOp(x.Op):
+			if v, ok := unparenNode(x.X).(*VarNode); ok {
+				if l, ok := constValue(x.Y); ok {
+					return an.addAtom(atom{
+						varName:   v.Name,
+						op:        x.Op,
+						value:     l,
+						varOnLeft: true,
+					}), nil
+				}
+			}
+			if v, ok := unparenNode(x.Y).(*VarNode); ok {
+				if l, ok := constValue(x.X); ok {
+					return an.addAtom(atom{varName: v.Name, op: x.Op, value: l}), nil
+				}
+			}
+		}
+	}
+	return nil, UnsupportedError{Pos: n.Pos(), Expr: Format(n)}
+}
+
+func (an *analysis) addAtom(a atom) *formula {
+	an.atoms = append(an.atoms, a)
+	return &formula{kind: fAtom, atom: len(an.atoms) - 1}
+}
+
+// candidates returns the names of the variables to assign, sorted, and
+// the values to try for each.  The values for numbers are each constant
+// that a variable is compared with, a value between each pair of
+// constants and a value either side of them.  As the result of each
+// comparison is the same for every number between two constants, this
+// covers every possibility.  Other constants are tried along with a
+// string that isn't equal to any of them.
+func (an *analysis) candidates() ([]string, [][]*dlit.Literal) {
+	nums := map[string]map[float64]bool{}
+	strs := map[string]map[string]bool{}
+	isBool := map[string]bool{}
+	for _, a := range an.atoms {
+		if _, ok := nums[a.varName]; !ok {
+			nums[a.varName] = map[float64]bool{}
+			strs[a.varName] = map[string]bool{}
+		}
+		if a.op == token.ILLEGAL {
+			isBool[a.varName] = true
+		} else if x, ok := numValue(a.value); ok && !math.IsNaN(x) {
+			nums[a.varName][x] = true
+		} else {
+			strs[a.varName][a.value.String()] = true
+		}
+	}
+
+	names := make([]string, 0, len(nums))
+	for name := range nums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	candidates := make([][]*dlit.Literal, len(names))
+	for i, name := range names {
+		ls := numCandidates(nums[name])
+		if len(strs[name]) > 0 {
+			ss := make([]string, 0, len(strs[name]))
+			for s := range strs[name] {
+				ss = append(ss, s)
+			}
+			sort.Strings(ss)
+			for _, s := range ss {
+				ls = append(ls, dlit.NewString(s))
+			}
+			ls = append(ls, dlit.NewString(OtherString(strs[name])))
+		}
+		if isBool[name] {
+			ls = append(ls, dlit.MustNew(true), dlit.MustNew(false))
+		}
+		candidates[i] = ls
+	}
+	return names, candidates
+}
+
+func numCandidates(nums map[float64]bool) []*dlit.Literal {
+	if len(nums) == 0 {
+		return []*dlit.Literal{}
+	}
+	sorted := make([]float64, 0, len(nums))
+	for x := range nums {
+		sorted = append(sorted, x)
+	}
+	sort.Float64s(sorted)
+	ls := make([]*dlit.Literal, 0, len(sorted)*2+1)
+	for i, x := range sorted {
+		if i > 0 {
+			ls = append(ls, numLiteral((sorted[i-1]+x)/2))
+		}
+		ls = append(ls, numLiteral(x))
+	}
+	// Try the value either side of the constants after those in between
+	// them as they are less likely to be needed
+	ls = append(ls, numLiteral(sorted[0]-1), numLiteral(sorted[len(sorted)-1]+1))
+	return ls
+}
+
+// numLiteral returns x as an int if it is a whole number
+func numLiteral(x float64) *dlit.Literal {
+	if x == math.Trunc(x) && math.Abs(x) < 1<<53 {
+		return dlit.MustNew(int64(x))
+	}
+	return dlit.MustNew(x)
+}
+
+// eval returns the value of f for vals and whether evaluating any of
+// its comparisons returned an error.  As && and || evaluate both of
+// their operands, such an error makes the expression return an error.
+func (an *analysis) eval(f *formula, vals map[string]*dlit.Literal) (truth, bool) {
+	switch f.kind {
+	case fConst:
+		if f.value {
+			return truthTrue, false
+		}
+		return truthFalse, false
+	case fAtom:
+		return an.evalAtom(an.atoms[f.atom], vals)
+	case fNot:
+		t, hasErr := an.eval(f.args[0], vals)
+		switch t {
+		case truthTrue:
+			return truthFalse, hasErr
+		case truthFalse:
+			return truthTrue, hasErr
+		}
+		return truthUnknown, hasErr
+	}
+	// fAnd and fOr
+	isAnd := f.kind == fAnd
+	r := truthTrue
+	if !isAnd {
+		r = truthFalse
+	}
+	hasErr := false
+	for _, a := range f.args {
+		t, err := an.eval(a, vals)
+		hasErr = hasErr || err
+		switch {
+		case t == truthUnknown:
+			if (isAnd && r == truthTrue) || (!isAnd && r == truthFalse) {
+				r = truthUnknown
+			}
+		case isAnd && t == truthFalse:
+			r = truthFalse
+		case !isAnd && t == truthTrue:
+			r = truthTrue
+		}
+	}
+	return r, hasErr
+}
+
+// swapComparison returns the comparison operator that gives the same
+// result when its operands are swapped
+func swapComparison(op token.Token) token.Token {
+	switch op {
+	case token.LSS:
+		return token.GTR
+	case token.LEQ:
+		return token.GEQ
+	case token.GTR:
+		return token.LSS
+	case token.GEQ:
+		return token.LEQ
+	}
+	return op
+}
+
+func (an *analysis) evalAtom(a atom, vals map[string]*dlit.Literal) (truth, bool) {
+	l, ok := vals[a.varName]
+	if !ok {
+		return truthUnknown, false
+	}
+	v := litValue(l)
+	if a.op != token.ILLEGAL {
+		x, y := v, litValue(a.value)
+		if !a.varOnLeft {
+			x, y = y, x
+		}
+		v = binaryFns[a.op](x, y)
+	}
+	if v.Err() != nil {
+		return truthUnknown, true
+	}
+	b, isBool := v.Bool()
+	if !isBool {
+		return truthUnknown, true
+	}
+	if b {
+		return truthTrue, false
+	}
+	return truthFalse, false
+}
@@ -0,0 +1,211 @@
+package dexpr
+
+import (
+	"github.com/lawrencewoodman/dlit"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// exampleString returns vars as a sorted string so that examples can be
+// compared
+func exampleString(vars map[string]*dlit.Literal) string {
+	s := make([]string, 0, len(vars))
+	for name, l := range vars {
+		s = append(s, name+"="+l.String())
+	}
+	sort.Strings(s)
+	return strings.Join(s, " ")
+}
+
+func TestSatisfiable(t *testing.T) {
+	cases := []struct {
+		in          string
+		want        bool
+		wantExample string
+	}{
+		{in: "amount > 100", want: true, wantExample: "amount=101"},
+		{in: "amount > 100 && amount < 200", want: true,
+			wantExample: "amount=150"},
+		{in: "amount > 100 && amount < 100", want: false},
+		{in: "amount > 100 && amount <= 100.5", want: true,
+			wantExample: "amount=100.25"},
+		{in: "amount >= 100 && amount <= 100", want: true,
+			wantExample: "amount=100"},
+		{in: "amount > 100 && !(amount > 50)", want: false},
+		{in: "(amount > 100 && amount < 50) || country == \"FR\"", want: true,
+			wantExample: "amount=50 country=FR"},
+		{in: "country == \"FR\" && country == \"UK\"", want: false},
+		{in: "country != \"FR\" && country != \"UK\"", want: true,
+			wantExample: "country=other"},
+		{in: "100 < amount && 200 > amount && amount != 150", want: true,
+			wantExample: "amount=125"},
+		{in: "flag && !flag", want: false},
+		{in: "flag || x == -5", want: true, wantExample: "flag=true x=-5"},
+		{in: "true && x == 3", want: true, wantExample: "true=true x=3"},
+		{in: "false || x == 3", want: true, wantExample: "false=false x=3"},
+		{in: "false && x == 3", want: false},
+		// Comparing a string with a number returns an error
+		{in: "amount > 100 && amount == \"abc\"", want: false},
+	}
+	for _, c := range cases {
+		e := MustNew(c.in, map[string]CallFun{})
+		vars, got, err := Satisfiable(e)
+		if err != nil {
+			t.Errorf("Satisfiable(%s) err: %s", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("Satisfiable(%s) got: %t, want: %t", c.in, got, c.want)
+			continue
+		}
+		if !got {
+			continue
+		}
+		if s := exampleString(vars); s != c.wantExample {
+			t.Errorf("Satisfiable(%s) example: %s, want: %s", c.in, s,
+				c.wantExample)
+		}
+		if isTrue, err := e.EvalBool(vars); err != nil || !isTrue {
+			t.Errorf("EvalBool(%s) with example: %t, err: %v", c.in, isTrue, err)
+		}
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "amount > 100", b: "amount < 200", want: true},
+		{a: "amount > 100", b: "amount < 100", want: false},
+		{a: "amount >= 100", b: "amount <= 100", want: true},
+		{a: "country == \"FR\" && amount > 10", b: "country == \"UK\"",
+			want: false},
+		{a: "country == \"FR\" || amount > 10", b: "country == \"UK\"",
+			want: true},
+		{a: "tier == 2 && flag", b: "tier != 2 || !flag", want: false},
+	}
+	for _, c := range cases {
+		a := MustNew(c.a, map[string]CallFun{})
+		b := MustNew(c.b, map[string]CallFun{})
+		vars, got, err := Overlaps(a, b)
+		if err != nil {
+			t.Errorf("Overlaps(%s, %s) err: %s", c.a, c.b, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("Overlaps(%s, %s) got: %t, want: %t", c.a, c.b, got, c.want)
+			continue
+		}
+		if got {
+			aTrue, aErr := a.EvalBool(vars)
+			bTrue, bErr := b.EvalBool(vars)
+			if aErr != nil || bErr != nil || !aTrue || !bTrue {
+				t.Errorf("Overlaps(%s, %s) example doesn't make both true: %v",
+					c.a, c.b, vars)
+			}
+		}
+	}
+}
+
+func TestImplies(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "amount > 200", b: "amount > 100", want: true},
+		{a: "amount > 100", b: "amount > 200", want: false},
+		{a: "amount >= 100 && amount <= 100", b: "amount == 100", want: true},
+		{a: "country == \"FR\"", b: "country == \"FR\" || country == \"UK\"",
+			want: true},
+		{a: "country == \"FR\" || country == \"UK\"", b: "country == \"FR\"",
+			want: false},
+		{a: "x > 1 && x < 2", b: "x != 1.5", want: false},
+		// b is an error when y isn't a number so isn't true
+		{a: "x > 1", b: "x > 1 && y > 0", want: false},
+	}
+	for _, c := range cases {
+		a := MustNew(c.a, map[string]CallFun{})
+		b := MustNew(c.b, map[string]CallFun{})
+		vars, got, err := Implies(a, b)
+		if err != nil {
+			t.Errorf("Implies(%s, %s) err: %s", c.a, c.b, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("Implies(%s, %s) got: %t, want: %t", c.a, c.b, got, c.want)
+			continue
+		}
+		if !got {
+			aTrue, aErr := a.EvalBool(vars)
+			bTrue, bErr := b.EvalBool(vars)
+			if aErr != nil || !aTrue || (bErr == nil && bTrue) {
+				t.Errorf("Implies(%s, %s) example isn't a counterexample: %v",
+					c.a, c.b, vars)
+			}
+		}
+	}
+}
+
+func TestSatisfiable_errors(t *testing.T) {
+	cases := []struct {
+		in      string
+		wantErr error
+	}{
+		{in: "x > y",
+			wantErr: UnsupportedError{
+				Pos:  Position{Offset: 0, Line: 1, Column: 1},
+				Expr: "x > y",
+			},
+		},
+		{in: "a == 1 && (b + 1 > 3)",
+			wantErr: UnsupportedError{
+				Pos:  Position{Offset: 11, Line: 1, Column: 12},
+				Expr: "b + 1 > 3",
+			},
+		},
+		{in: "a == 1 || in(b, 1, 2)",
+			wantErr: UnsupportedError{
+				Pos:  Position{Offset: 10, Line: 1, Column: 11},
+				Expr: "in(b, 1, 2)",
+			},
+		},
+	}
+	for _, c := range cases {
+		_, _, err := Satisfiable(MustNew(c.in, map[string]CallFun{}))
+		if !reflect.DeepEqual(err, c.wantErr) {
+			t.Errorf("Satisfiable(%s) err: %v, want: %v", c.in, err, c.wantErr)
+		}
+	}
+	want := "1:12: can't analyse: b + 1 > 3"
+	if got := (UnsupportedError{
+		Pos:  Position{Offset: 11, Line: 1, Column: 12},
+		Expr: "b + 1 > 3",
+	}).Error(); got != want {
+		t.Errorf("Error got: %s, want: %s", got, want)
+	}
+}
+
+func TestNumCandidates(t *testing.T) {
+	cases := []struct {
+		nums map[float64]bool
+		want []string
+	}{
+		{nums: map[float64]bool{}, want: []string{}},
+		{nums: map[float64]bool{1.5: true}, want: []string{"1.5", "0.5", "2.5"}},
+		{nums: map[float64]bool{10: true, 5: true},
+			want: []string{"5", "7.5", "10", "4", "11"},
+		},
+	}
+	for _, c := range cases {
+		got := []string{}
+		for _, l := range numCandidates(c.nums) {
+			got = append(got, l.String())
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("numCandidates(%v) got: %v, want: %v", c.nums, got, c.want)
+		}
+	}
+}
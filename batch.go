@@ -0,0 +1,182 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"github.com/lawrencewoodman/dlit"
+	"sync"
+)
+
+// batchChunkSize is the number of rows read from a VarsIterator before
+// they are evaluated when using more than one worker
+const batchChunkSize = 1024
+
+// Batch evaluates an Expr over many sets of vars.  The slices returned
+// by its methods are reused by the next call, so copy them if they are
+// needed for longer.  A Batch must not be used by more than one goroutine
+// at a time, but separate Batches may share an Expr.
+type Batch struct {
+	Expr *Expr
+	// Workers is the number of goroutines used to evaluate the rows.
+	// If it is less than 2 the rows are evaluated in the calling goroutine.
+	Workers int
+
+	results []*dlit.Literal
+	bools   []bool
+	errs    []error
+	vars    []map[string]*dlit.Literal
+}
+
+// VarsIterator provides the sets of vars used by Batch.EvalIter
+type VarsIterator interface {
+	// Next advances to the next set of vars and returns false once
+	// there are no more or an error has occurred
+	Next() bool
+	// Vars returns the current set of vars.  If Batch.Workers is greater
+	// than 1 the returned map must not be changed by later calls to Next.
+	Vars() map[string]*dlit.Literal
+	// Err returns the error, if any, that caused Next to return false
+	Err() error
+}
+
+func NewBatch(expr *Expr, workers int) *Batch {
+	return &Batch{Expr: expr, Workers: workers}
+}
+
+// Eval evaluates the Expr for each set of vars.  The results are
+// returned in the same order as varsSets, along with the error for each
+// row, which is nil if the row was evaluated successfully.
+func (b *Batch) Eval(
+	varsSets []map[string]*dlit.Literal,
+) ([]*dlit.Literal, []error) {
+	b.reset()
+	b.evalRows(varsSets, b.evalRow)
+	return b.results, b.errs
+}
+
+// EvalBool evaluates the Expr as a bool for each set of vars.  The results
+// are returned in the same order as varsSets, along with the error for
+// each row, which is nil if the row was evaluated successfully.
+func (b *Batch) EvalBool(
+	varsSets []map[string]*dlit.Literal,
+) ([]bool, []error) {
+	b.reset()
+	b.evalRows(varsSets, b.evalBoolRow)
+	return b.bools, b.errs
+}
+
+// EvalIter evaluates the Expr for each set of vars provided by it in
+// the same way as Eval.  The error returned is that of the iterator.
+func (b *Batch) EvalIter(
+	it VarsIterator,
+) ([]*dlit.Literal, []error, error) {
+	b.reset()
+	b.iterRows(it, b.evalRow)
+	return b.results, b.errs, it.Err()
+}
+
+// EvalBoolIter evaluates the Expr as a bool for each set of vars provided
+// by it in the same way as EvalBool.  The error returned is that of the
+// iterator.
+func (b *Batch) EvalBoolIter(it VarsIterator) ([]bool, []error, error) {
+	b.reset()
+	b.iterRows(it, b.evalBoolRow)
+	return b.bools, b.errs, it.Err()
+}
+
+// rowFn evaluates vars and stores the results at index i
+type rowFn func(i int, vars map[string]*dlit.Literal)
+
+func (b *Batch) evalRow(i int, vars map[string]*dlit.Literal) {
+	l := b.Expr.Eval(vars)
+	b.results[i] = l
+	b.errs[i] = l.Err()
+}
+
+func (b *Batch) evalBoolRow(i int, vars map[string]*dlit.Literal) {
+	b.bools[i], b.errs[i] = b.Expr.EvalBool(vars)
+}
+
+func (b *Batch) iterRows(it VarsIterator, fn rowFn) {
+	if b.Workers < 2 {
+		for it.Next() {
+			b.grow(1)
+			fn(len(b.errs)-1, it.Vars())
+		}
+		return
+	}
+	for {
+		b.vars = b.vars[:0]
+		for len(b.vars) < batchChunkSize && it.Next() {
+			b.vars = append(b.vars, it.Vars())
+		}
+		if len(b.vars) == 0 {
+			break
+		}
+		b.evalRows(b.vars, fn)
+		// Don't hold on to the vars once they have been evaluated
+		for i := range b.vars {
+			b.vars[i] = nil
+		}
+	}
+}
+
+// evalRows appends the results of evaluating varsSets, splitting the
+// rows between the workers so that each writes to its own part of the
+// results
+func (b *Batch) evalRows(varsSets []map[string]*dlit.Literal, fn rowFn) {
+	start := len(b.errs)
+	b.grow(len(varsSets))
+	workers := b.Workers
+	if workers > len(varsSets) {
+		workers = len(varsSets)
+	}
+	if workers < 2 {
+		for i, vars := range varsSets {
+			fn(start+i, vars)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	chunkSize := (len(varsSets) + workers - 1) / workers
+	for lo := 0; lo < len(varsSets); lo += chunkSize {
+		hi := lo + chunkSize
+		if hi > len(varsSets) {
+			hi = len(varsSets)
+		}
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			for i := lo; i < hi; i++ {
+				fn(start+i, varsSets[i])
+			}
+		}(lo, hi)
+	}
+	wg.Wait()
+}
+
+// reset empties the results, keeping their capacity for reuse
+func (b *Batch) reset() {
+	b.results = b.results[:0]
+	b.bools = b.bools[:0]
+	b.errs = b.errs[:0]
+}
+
+// grow extends the results by n rows, reusing the existing capacity
+// where possible
+func (b *Batch) grow(n int) {
+	l := len(b.errs) + n
+	if l > cap(b.errs) {
+		b.results = append(make([]*dlit.Literal, 0, 2*l), b.results...)
+		b.bools = append(make([]bool, 0, 2*l), b.bools...)
+		b.errs = append(make([]error, 0, 2*l), b.errs...)
+	}
+	b.results = b.results[:l]
+	b.bools = b.bools[:l]
+	b.errs = b.errs[:l]
+}
@@ -0,0 +1,149 @@
+package dexpr
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lawrencewoodman/dlit"
+	"testing"
+)
+
+func TestBatchEval(t *testing.T) {
+	expr := MustNew("a * b + roundto(c, 1)", map[string]CallFun{
+		"roundto": roundTo,
+	})
+	varsSets := makeBatchVars(2500)
+	for _, workers := range []int{0, 1, 2, 3, 8, 5000} {
+		batch := NewBatch(expr, workers)
+		// Run twice to check that reusing the buffers works
+		for run := 0; run < 2; run++ {
+			got, gotErrs := batch.Eval(varsSets)
+			if len(got) != len(varsSets) || len(gotErrs) != len(varsSets) {
+				t.Fatalf("Eval - workers: %d, len(got): %d, len(gotErrs): %d, want: %d",
+					workers, len(got), len(gotErrs), len(varsSets))
+			}
+			for i, vars := range varsSets {
+				want := expr.Eval(vars)
+				if got[i].String() != want.String() {
+					t.Errorf("Eval - workers: %d, row: %d, got: %s, want: %s",
+						workers, i, got[i], want)
+				}
+				if gotErrs[i] != want.Err() {
+					t.Errorf("Eval - workers: %d, row: %d, gotErr: %s, wantErr: %s",
+						workers, i, gotErrs[i], want.Err())
+				}
+			}
+		}
+	}
+}
+
+func TestBatchEvalBool(t *testing.T) {
+	expr := MustNew("a > 500 && b != 3", map[string]CallFun{})
+	varsSets := makeBatchVars(2500)
+	for _, workers := range []int{0, 1, 4} {
+		batch := NewBatch(expr, workers)
+		got, gotErrs := batch.EvalBool(varsSets)
+		if len(got) != len(varsSets) || len(gotErrs) != len(varsSets) {
+			t.Fatalf("EvalBool - workers: %d, len(got): %d, len(gotErrs): %d, want: %d",
+				workers, len(got), len(gotErrs), len(varsSets))
+		}
+		for i, vars := range varsSets {
+			want, wantErr := expr.EvalBool(vars)
+			if got[i] != want || gotErrs[i] != wantErr {
+				t.Errorf("EvalBool - workers: %d, row: %d, got: %t, %v, want: %t, %v",
+					workers, i, got[i], gotErrs[i], want, wantErr)
+			}
+		}
+	}
+}
+
+func TestBatchEvalIter(t *testing.T) {
+	expr := MustNew("a - b", map[string]CallFun{})
+	varsSets := makeBatchVars(3000)
+	for _, workers := range []int{0, 3} {
+		batch := NewBatch(expr, workers)
+		got, gotErrs, err := batch.EvalIter(&sliceVarsIterator{varsSets: varsSets})
+		if err != nil {
+			t.Fatalf("EvalIter - workers: %d, err: %s", workers, err)
+		}
+		if len(got) != len(varsSets) || len(gotErrs) != len(varsSets) {
+			t.Fatalf("EvalIter - workers: %d, len(got): %d, len(gotErrs): %d, want: %d",
+				workers, len(got), len(gotErrs), len(varsSets))
+		}
+		for i, vars := range varsSets {
+			want := expr.Eval(vars)
+			if got[i].String() != want.String() || gotErrs[i] != want.Err() {
+				t.Errorf("EvalIter - workers: %d, row: %d, got: %s, want: %s",
+					workers, i, got[i], want)
+			}
+		}
+	}
+}
+
+func TestBatchEvalBoolIter_error(t *testing.T) {
+	wantErr := errors.New("can't read row")
+	expr := MustNew("a > 5", map[string]CallFun{})
+	varsSets := makeBatchVars(20)
+	for _, workers := range []int{0, 3} {
+		batch := NewBatch(expr, workers)
+		it := &sliceVarsIterator{varsSets: varsSets, failAt: 10, err: wantErr}
+		got, _, err := batch.EvalBoolIter(it)
+		if err != wantErr {
+			t.Errorf("EvalBoolIter - workers: %d, err: %v, want: %v",
+				workers, err, wantErr)
+		}
+		if len(got) != 10 {
+			t.Errorf("EvalBoolIter - workers: %d, len(got): %d, want: 10",
+				workers, len(got))
+		}
+	}
+}
+
+/**********************************
+ *    Helper functions
+ **********************************/
+func makeBatchVars(n int) []map[string]*dlit.Literal {
+	varsSets := make([]map[string]*dlit.Literal, n)
+	for i := range varsSets {
+		varsSets[i] = map[string]*dlit.Literal{
+			"a": dlit.MustNew(i),
+			"b": dlit.MustNew(i % 7),
+			"c": dlit.MustNew(float64(i) / 3),
+		}
+		// Make some rows fail
+		if i%100 == 0 {
+			delete(varsSets[i], "b")
+		} else if i%101 == 0 {
+			varsSets[i]["b"] = dlit.MustNew(fmt.Sprintf("b%d", i))
+		}
+	}
+	return varsSets
+}
+
+type sliceVarsIterator struct {
+	varsSets []map[string]*dlit.Literal
+	pos      int
+	failAt   int
+	err      error
+}
+
+func (it *sliceVarsIterator) Next() bool {
+	if it.err != nil && it.pos == it.failAt {
+		return false
+	}
+	if it.pos >= len(it.varsSets) {
+		return false
+	}
+	it.pos++
+	return true
+}
+
+func (it *sliceVarsIterator) Vars() map[string]*dlit.Literal {
+	return it.varsSets[it.pos-1]
+}
+
+func (it *sliceVarsIterator) Err() error {
+	if it.pos == it.failAt {
+		return it.err
+	}
+	return nil
+}
@@ -16,123 +16,50 @@ import (
 var trueLiteral = dlit.MustNew(true)
 var falseLiteral = dlit.MustNew(false)
 
+// binaryFns are the functions used to evaluate each binary operator
+var binaryFns = map[token.Token]binaryFn{
+	token.LSS:  opLss,
+	token.LEQ:  opLeq,
+	token.EQL:  opEql,
+	token.NEQ:  opNeq,
+	token.GTR:  opGtr,
+	token.GEQ:  opGeq,
+	token.LAND: opLand,
+	token.LOR:  opLor,
+	token.ADD:  opAdd,
+	token.SUB:  opSub,
+	token.MUL:  opMul,
+	token.QUO:  opQuo,
+}
+
 func binaryExprToenode(
-	callFuncs map[string]CallFun,
-	eltStore *eltStore,
+	c *compiler,
 	be *ast.BinaryExpr,
 ) enode {
-	lh := nodeToenode(callFuncs, eltStore, be.X)
-	rh := nodeToenode(callFuncs, eltStore, be.Y)
+	lh := nodeToenode(c, be.X)
+	rh := nodeToenode(c, be.Y)
 	if _, ok := lh.(enErr); ok {
 		return lh
 	} else if _, ok := rh.(enErr); ok {
 		return rh
 	}
 
-	switch be.Op {
-	case token.LSS:
-		return enFunc{
-			fn: func(vars map[string]*dlit.Literal) *dlit.Literal {
-				return callBinaryFn(opLss, lh, rh, vars)
-			},
-		}
-	case token.LEQ:
-		return enFunc{
-			fn: func(vars map[string]*dlit.Literal) *dlit.Literal {
-				return callBinaryFn(opLeq, lh, rh, vars)
-			},
-		}
-	case token.EQL:
-		return enFunc{
-			fn: func(vars map[string]*dlit.Literal) *dlit.Literal {
-				return callBinaryFn(opEql, lh, rh, vars)
-			},
-		}
-	case token.NEQ:
-		return enFunc{
-			fn: func(vars map[string]*dlit.Literal) *dlit.Literal {
-				return callBinaryFn(opNeq, lh, rh, vars)
-			},
-		}
-	case token.GTR:
-		return enFunc{
-			fn: func(vars map[string]*dlit.Literal) *dlit.Literal {
-				return callBinaryFn(opGtr, lh, rh, vars)
-			},
-		}
-	case token.GEQ:
-		return enFunc{
-			fn: func(vars map[string]*dlit.Literal) *dlit.Literal {
-				return callBinaryFn(opGeq, lh, rh, vars)
-			},
-		}
-	case token.LAND:
-		return enFunc{
-			fn: func(vars map[string]*dlit.Literal) *dlit.Literal {
-				return callBinaryFn(opLand, lh, rh, vars)
-			},
-		}
-	case token.LOR:
-		return enFunc{
-			fn: func(vars map[string]*dlit.Literal) *dlit.Literal {
-				return callBinaryFn(opLor, lh, rh, vars)
-			},
-		}
-	case token.ADD:
-		return enFunc{
-			fn: func(vars map[string]*dlit.Literal) *dlit.Literal {
-				return callBinaryFn(opAdd, lh, rh, vars)
-			},
-		}
-	case token.SUB:
-		return enFunc{
-			fn: func(vars map[string]*dlit.Literal) *dlit.Literal {
-				return callBinaryFn(opSub, lh, rh, vars)
-			},
-		}
-	case token.MUL:
-		return enFunc{
-			fn: func(vars map[string]*dlit.Literal) *dlit.Literal {
-				return callBinaryFn(opMul, lh, rh, vars)
-			},
-		}
-	case token.QUO:
-		return enFunc{
-			fn: func(vars map[string]*dlit.Literal) *dlit.Literal {
-				return callBinaryFn(opQuo, lh, rh, vars)
-			},
-		}
+	if fn, ok := binaryFns[be.Op]; ok {
+		return enBinary{op: be.Op, fn: fn, lh: lh, rh: rh}
 	}
 	return enErr{err: InvalidOpError(be.Op)}
 }
 
-func callBinaryFn(
-	fn binaryFn,
-	lh enode,
-	rh enode,
-	vars map[string]*dlit.Literal,
-) *dlit.Literal {
-	lhV := lh.Eval(vars)
-	rhV := rh.Eval(vars)
-	if lhV.Err() != nil {
-		return lhV
-	}
-	if rhV.Err() != nil {
-		return rhV
-	}
-	return fn(lhV, rhV)
-}
-
-type binaryFn func(*dlit.Literal, *dlit.Literal) *dlit.Literal
+type binaryFn func(value, value) value
 
-func opLss(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
+func opLss(lh value, rh value) value {
 	lhInt, lhIsInt := lh.Int()
 	if lhIsInt {
 		if rhInt, rhIsInt := rh.Int(); rhIsInt {
 			if lhInt < rhInt {
-				return trueLiteral
+				return trueValue
 			} else {
-				return falseLiteral
+				return falseValue
 			}
 		}
 	}
@@ -141,23 +68,23 @@ func opLss(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
 	if lhIsFloat {
 		if rhFloat, rhIsFloat := rh.Float(); rhIsFloat {
 			if lhFloat < rhFloat {
-				return trueLiteral
+				return trueValue
 			} else {
-				return falseLiteral
+				return falseValue
 			}
 		}
 	}
-	return dlit.MustNew(ErrIncompatibleTypes)
+	return errValue(ErrIncompatibleTypes)
 }
 
-func opLeq(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
+func opLeq(lh value, rh value) value {
 	lhInt, lhIsInt := lh.Int()
 	if lhIsInt {
 		if rhInt, rhIsInt := rh.Int(); rhIsInt {
 			if lhInt <= rhInt {
-				return trueLiteral
+				return trueValue
 			} else {
-				return falseLiteral
+				return falseValue
 			}
 		}
 	}
@@ -166,23 +93,23 @@ func opLeq(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
 	if lhIsFloat {
 		if rhFloat, rhIsFloat := rh.Float(); rhIsFloat {
 			if lhFloat <= rhFloat {
-				return trueLiteral
+				return trueValue
 			} else {
-				return falseLiteral
+				return falseValue
 			}
 		}
 	}
-	return dlit.MustNew(ErrIncompatibleTypes)
+	return errValue(ErrIncompatibleTypes)
 }
 
-func opGtr(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
+func opGtr(lh value, rh value) value {
 	lhInt, lhIsInt := lh.Int()
 	if lhIsInt {
 		if rhInt, rhIsInt := rh.Int(); rhIsInt {
 			if lhInt > rhInt {
-				return trueLiteral
+				return trueValue
 			} else {
-				return falseLiteral
+				return falseValue
 			}
 		}
 	}
@@ -191,23 +118,23 @@ func opGtr(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
 	if lhIsFloat {
 		if rhFloat, rhIsFloat := rh.Float(); rhIsFloat {
 			if lhFloat > rhFloat {
-				return trueLiteral
+				return trueValue
 			} else {
-				return falseLiteral
+				return falseValue
 			}
 		}
 	}
-	return dlit.MustNew(ErrIncompatibleTypes)
+	return errValue(ErrIncompatibleTypes)
 }
 
-func opGeq(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
+func opGeq(lh value, rh value) value {
 	lhInt, lhIsInt := lh.Int()
 	if lhIsInt {
 		if rhInt, rhIsInt := rh.Int(); rhIsInt {
 			if lhInt >= rhInt {
-				return trueLiteral
+				return trueValue
 			} else {
-				return falseLiteral
+				return falseValue
 			}
 		}
 	}
@@ -216,23 +143,23 @@ func opGeq(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
 	if lhIsFloat {
 		if rhFloat, rhIsFloat := rh.Float(); rhIsFloat {
 			if lhFloat >= rhFloat {
-				return trueLiteral
+				return trueValue
 			} else {
-				return falseLiteral
+				return falseValue
 			}
 		}
 	}
-	return dlit.MustNew(ErrIncompatibleTypes)
+	return errValue(ErrIncompatibleTypes)
 }
 
-func opEql(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
+func opEql(lh value, rh value) value {
 	lhInt, lhIsInt := lh.Int()
 	if lhIsInt {
 		if rhInt, rhIsInt := rh.Int(); rhIsInt {
 			if lhInt == rhInt {
-				return trueLiteral
+				return trueValue
 			} else {
-				return falseLiteral
+				return falseValue
 			}
 		}
 	}
@@ -241,9 +168,9 @@ func opEql(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
 	if lhIsFloat {
 		if rhFloat, rhIsFloat := rh.Float(); rhIsFloat {
 			if lhFloat == rhFloat {
-				return trueLiteral
+				return trueValue
 			} else {
-				return falseLiteral
+				return falseValue
 			}
 		}
 	}
@@ -252,27 +179,27 @@ func opEql(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
 	// are cast to bools you would find that "True" == 1.0 because they would
 	// both convert to true bools
 	if lhErr := lh.Err(); lhErr != nil {
-		return dlit.MustNew(ErrIncompatibleTypes)
+		return errValue(ErrIncompatibleTypes)
 	}
 
 	if rhErr := rh.Err(); rhErr != nil {
-		return dlit.MustNew(ErrIncompatibleTypes)
+		return errValue(ErrIncompatibleTypes)
 	}
 
 	if lh.String() == rh.String() {
-		return trueLiteral
+		return trueValue
 	}
-	return falseLiteral
+	return falseValue
 }
 
-func opNeq(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
+func opNeq(lh value, rh value) value {
 	lhInt, lhIsInt := lh.Int()
 	if lhIsInt {
 		if rhInt, rhIsInt := rh.Int(); rhIsInt {
 			if lhInt != rhInt {
-				return trueLiteral
+				return trueValue
 			} else {
-				return falseLiteral
+				return falseValue
 			}
 		}
 	}
@@ -281,9 +208,9 @@ func opNeq(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
 	if lhIsFloat {
 		if rhFloat, rhIsFloat := rh.Float(); rhIsFloat {
 			if lhFloat != rhFloat {
-				return trueLiteral
+				return trueValue
 			} else {
-				return falseLiteral
+				return falseValue
 			}
 		}
 	}
@@ -293,54 +220,54 @@ func opNeq(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
 	// both convert to true bools
 
 	if lhErr := lh.Err(); lhErr != nil {
-		return dlit.MustNew(ErrIncompatibleTypes)
+		return errValue(ErrIncompatibleTypes)
 	}
 
 	if rhErr := rh.Err(); rhErr != nil {
-		return dlit.MustNew(ErrIncompatibleTypes)
+		return errValue(ErrIncompatibleTypes)
 	}
 
 	if lh.String() != rh.String() {
-		return trueLiteral
+		return trueValue
 	}
-	return falseLiteral
+	return falseValue
 }
 
-func opLand(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
+func opLand(lh value, rh value) value {
 	lhBool, lhIsBool := lh.Bool()
 	if lhIsBool {
 		if rhBool, rhIsBool := rh.Bool(); rhIsBool {
 			if lhBool && rhBool {
-				return trueLiteral
+				return trueValue
 			} else {
-				return falseLiteral
+				return falseValue
 			}
 		}
 	}
-	return dlit.MustNew(ErrIncompatibleTypes)
+	return errValue(ErrIncompatibleTypes)
 }
 
-func opLor(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
+func opLor(lh value, rh value) value {
 	lhBool, lhIsBool := lh.Bool()
 	if lhIsBool {
 		if rhBool, rhIsBool := rh.Bool(); rhIsBool {
 			if lhBool || rhBool {
-				return trueLiteral
+				return trueValue
 			} else {
-				return falseLiteral
+				return falseValue
 			}
 		}
 	}
-	return dlit.MustNew(ErrIncompatibleTypes)
+	return errValue(ErrIncompatibleTypes)
 }
 
-func opAdd(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
+func opAdd(lh value, rh value) value {
 	lhInt, lhIsInt := lh.Int()
 	rhInt, rhIsInt := rh.Int()
 	if lhIsInt && rhIsInt {
 		r := lhInt + rhInt
 		if (r < lhInt) == (rhInt < 0) {
-			return dlit.MustNew(r)
+			return intValue(r)
 		}
 		// If overflow then use Float
 	}
@@ -350,20 +277,20 @@ func opAdd(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
 	if lhIsFloat && rhIsFloat {
 		r := lhFloat + rhFloat
 		if !math.IsInf(r, 0) {
-			return dlit.MustNew(r)
+			return floatValue(r)
 		}
-		return dlit.MustNew(ErrUnderflowOverflow)
+		return errValue(ErrUnderflowOverflow)
 	}
-	return dlit.MustNew(ErrIncompatibleTypes)
+	return errValue(ErrIncompatibleTypes)
 }
 
-func opSub(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
+func opSub(lh value, rh value) value {
 	lhInt, lhIsInt := lh.Int()
 	rhInt, rhIsInt := rh.Int()
 	if lhIsInt && rhIsInt {
 		r := lhInt - rhInt
 		if (r > lhInt) == (rhInt < 0) {
-			return dlit.MustNew(r)
+			return intValue(r)
 		}
 		// If overflow then use Float
 	}
@@ -373,26 +300,26 @@ func opSub(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
 	if lhIsFloat && rhIsFloat {
 		r := lhFloat - rhFloat
 		if !math.IsInf(r, 0) {
-			return dlit.MustNew(r)
+			return floatValue(r)
 		}
-		return dlit.MustNew(ErrUnderflowOverflow)
+		return errValue(ErrUnderflowOverflow)
 	}
-	return dlit.MustNew(ErrIncompatibleTypes)
+	return errValue(ErrIncompatibleTypes)
 }
 
-func opMul(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
+func opMul(lh value, rh value) value {
 	lhInt, lhIsInt := lh.Int()
 	rhInt, rhIsInt := rh.Int()
 	if lhIsInt && rhIsInt {
 		// Overflow detection inspired by suggestion from Rob Pike on Go-nuts group:
 		//   https://groups.google.com/d/msg/Golang-nuts/h5oSN5t3Au4/KaNQREhZh0QJ
 		if lhInt == 0 || rhInt == 0 || lhInt == 1 || rhInt == 1 {
-			return dlit.MustNew(lhInt * rhInt)
+			return intValue(lhInt * rhInt)
 		}
 		if lhInt != math.MinInt64 && rhInt != math.MinInt64 {
 			r := lhInt * rhInt
 			if r/rhInt == lhInt {
-				return dlit.MustNew(r)
+				return intValue(r)
 			}
 		}
 		// If overflow then use Float
@@ -403,22 +330,22 @@ func opMul(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
 	if lhIsFloat && rhIsFloat {
 		r := lhFloat * rhFloat
 		if !math.IsInf(r, 0) {
-			return dlit.MustNew(r)
+			return floatValue(r)
 		}
-		return dlit.MustNew(ErrUnderflowOverflow)
+		return errValue(ErrUnderflowOverflow)
 	}
-	return dlit.MustNew(ErrIncompatibleTypes)
+	return errValue(ErrIncompatibleTypes)
 }
 
-func opQuo(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
+func opQuo(lh value, rh value) value {
 	lhInt, lhIsInt := lh.Int()
 	rhInt, rhIsInt := rh.Int()
 
 	if rhIsInt && rhInt == 0 {
-		return dlit.MustNew(ErrDivByZero)
+		return errValue(ErrDivByZero)
 	}
 	if lhIsInt && rhIsInt && lhInt%rhInt == 0 {
-		return dlit.MustNew(lhInt / rhInt)
+		return intValue(lhInt / rhInt)
 	}
 
 	lhFloat, lhIsFloat := lh.Float()
@@ -426,9 +353,9 @@ func opQuo(lh *dlit.Literal, rh *dlit.Literal) *dlit.Literal {
 	if lhIsFloat && rhIsFloat {
 		r := lhFloat / rhFloat
 		if !math.IsInf(r, 0) {
-			return dlit.MustNew(r)
+			return floatValue(r)
 		}
-		return dlit.MustNew(ErrUnderflowOverflow)
+		return errValue(ErrUnderflowOverflow)
 	}
-	return dlit.MustNew(ErrIncompatibleTypes)
+	return errValue(ErrIncompatibleTypes)
 }
@@ -81,7 +81,7 @@ func BenchmarkOpEql(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		for _, c := range cases {
 			b.StartTimer()
-			got := opEql(c.lh, c.rh)
+			got := opEql(litValue(c.lh), litValue(c.rh))
 			b.StopTimer()
 			if got.String() != c.want.String() {
 				b.Errorf("opEql(%s, %s) - got: %s, want: %s", c.lh, c.rh, got, c.want)
@@ -162,7 +162,7 @@ func BenchmarkOpNeq(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		for _, c := range cases {
 			b.StartTimer()
-			got := opNeq(c.lh, c.rh)
+			got := opNeq(litValue(c.lh), litValue(c.rh))
 			b.StopTimer()
 			if got.String() != c.want.String() {
 				b.Errorf("opNeq(%s, %s) - got: %s, want: %s", c.lh, c.rh, got, c.want)
@@ -200,7 +200,7 @@ func BenchmarkOpLand(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		for _, c := range cases {
 			b.StartTimer()
-			got := opLand(c.lh, c.rh)
+			got := opLand(litValue(c.lh), litValue(c.rh))
 			b.StopTimer()
 			if got.String() != c.want.String() {
 				b.Errorf("opLand(%s, %s) - got: %s, want: %s", c.lh, c.rh, got, c.want)
@@ -241,7 +241,7 @@ func BenchmarkOpLor(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		for _, c := range cases {
 			b.StartTimer()
-			got := opLor(c.lh, c.rh)
+			got := opLor(litValue(c.lh), litValue(c.rh))
 			b.StopTimer()
 			if got.String() != c.want.String() {
 				b.Errorf("opLor(%s, %s) - got: %s, want: %s", c.lh, c.rh, got, c.want)
@@ -282,7 +282,7 @@ func BenchmarkOpLss(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		for _, c := range cases {
 			b.StartTimer()
-			got := opLss(c.lh, c.rh)
+			got := opLss(litValue(c.lh), litValue(c.rh))
 			b.StopTimer()
 			if got.String() != c.want.String() {
 				b.Errorf("opLss(%s, %s) - got: %s, want: %s", c.lh, c.rh, got, c.want)
@@ -326,7 +326,7 @@ func BenchmarkOpLeq(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		for _, c := range cases {
 			b.StartTimer()
-			got := opLeq(c.lh, c.rh)
+			got := opLeq(litValue(c.lh), litValue(c.rh))
 			b.StopTimer()
 			if got.String() != c.want.String() {
 				b.Errorf("opLeq(%s, %s) - got: %s, want: %s", c.lh, c.rh, got, c.want)
@@ -373,7 +373,7 @@ func BenchmarkOpGtr(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		for _, c := range cases {
 			b.StartTimer()
-			got := opGtr(c.lh, c.rh)
+			got := opGtr(litValue(c.lh), litValue(c.rh))
 			b.StopTimer()
 			if got.String() != c.want.String() {
 				b.Errorf("opGtr(%s, %s) - got: %s, want: %s", c.lh, c.rh, got, c.want)
@@ -420,7 +420,7 @@ func BenchmarkOpGeq(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		for _, c := range cases {
 			b.StartTimer()
-			got := opGeq(c.lh, c.rh)
+			got := opGeq(litValue(c.lh), litValue(c.rh))
 			b.StopTimer()
 			if got.String() != c.want.String() {
 				b.Errorf("opGeq(%s, %s) - got: %s, want: %s", c.lh, c.rh, got, c.want)
@@ -0,0 +1,554 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/lawrencewoodman/dexpr/stdfuncs"
+	"github.com/lawrencewoodman/dlit"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const filterUsage = `Usage: dexpr filter [flags] [file]
+
+Reads records from file, or stdin if there isn't one, and writes those
+matching -where to stdout along with any computed columns.  For CSV the
+header row gives the names of the variables.
+
+`
+
+// record is a record read from the input.  raws holds the JSON of each
+// value if the record was read from JSON Lines.
+type record struct {
+	names []string
+	lits  []*dlit.Literal
+	raws  []json.RawMessage
+}
+
+type recordReader interface {
+	// Read returns the next record or io.EOF if there aren't any more
+	Read() (*record, error)
+}
+
+type recordWriter interface {
+	Write(*record) error
+	Flush() error
+}
+
+// column is a computed column
+type column struct {
+	name string
+	expr *dexpr.Expr
+}
+
+type columnsFlag []string
+
+func (c *columnsFlag) String() string {
+	return strings.Join(*c, ",")
+}
+
+func (c *columnsFlag) Set(s string) error {
+	*c = append(*c, s)
+	return nil
+}
+
+func runFilter(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("filter", stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, filterUsage)
+		fs.PrintDefaults()
+	}
+	var cols columnsFlag
+	where := fs.String("where", "", "only output records for which `expr` is true")
+	fs.Var(&cols, "col",
+		"add a column `name=expr`, can be repeated and can use earlier columns")
+	inFormat := fs.String("in", "",
+		"input `format`: csv or jsonl, from the file extension if empty")
+	outFormat := fs.String("out", "", "output `format`: csv or jsonl, as input if empty")
+	onError := fs.String("on-error", "fail",
+		"what to do when a record has an error: fail, skip or column")
+	errorCol := fs.String("error-col", "error",
+		"`name` of the column for errors with -on-error=column")
+	noStd := fs.Bool("nostd", false, "don't load the standard function library")
+	summary := fs.Bool("summary", true, "write a summary of the records to stderr")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+	if *onError != "fail" && *onError != "skip" && *onError != "column" {
+		fmt.Fprintf(stderr, "error: invalid -on-error: %s\n", *onError)
+		return 2
+	}
+
+	funcs := map[string]dexpr.CallFun{}
+	if !*noStd {
+		funcs = stdfuncs.CallFuncs()
+	}
+	var whereExpr *dexpr.Expr
+	if *where != "" {
+		var err error
+		if whereExpr, err = dexpr.New(*where, funcs); err != nil {
+			fmt.Fprintf(stderr, "error: -where: %s\n", err)
+			return 2
+		}
+	}
+	columns, err := makeColumns(cols, funcs)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: -col: %s\n", err)
+		return 2
+	}
+
+	in := stdin
+	filename := ""
+	if fs.NArg() == 1 {
+		filename = fs.Arg(0)
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %s\n", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+	if *inFormat == "" {
+		*inFormat = "csv"
+		if ext := filepath.Ext(filename); ext == ".jsonl" || ext == ".json" {
+			*inFormat = "jsonl"
+		}
+	}
+	if *outFormat == "" {
+		*outFormat = *inFormat
+	}
+	r, err := newRecordReader(*inFormat, in)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %s\n", err)
+		return 2
+	}
+	out := bufio.NewWriter(stdout)
+	defer out.Flush()
+	w, err := newRecordWriter(*outFormat, out)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %s\n", err)
+		return 2
+	}
+
+	f := &filter{
+		where:    whereExpr,
+		columns:  columns,
+		onError:  *onError,
+		errorCol: *errorCol,
+		errs:     map[string]int{},
+	}
+	status := 0
+	if err := f.run(r, w); err != nil {
+		fmt.Fprintf(stderr, "error: %s\n", err)
+		status = 1
+	}
+	if *summary {
+		f.writeSummary(stderr)
+	}
+	return status
+}
+
+func makeColumns(
+	cols []string,
+	funcs map[string]dexpr.CallFun,
+) ([]column, error) {
+	r := make([]column, len(cols))
+	for i, c := range cols {
+		parts := strings.SplitN(c, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || !token.IsIdentifier(name) {
+			return nil, fmt.Errorf("must be name=expr: %s", c)
+		}
+		expr, err := dexpr.New(parts[1], funcs)
+		if err != nil {
+			return nil, err
+		}
+		r[i] = column{name: name, expr: expr}
+	}
+	return r, nil
+}
+
+// filter evaluates the expressions for each record
+type filter struct {
+	where    *dexpr.Expr
+	columns  []column
+	onError  string
+	errorCol string
+	read     int
+	written  int
+	skipped  int
+	// errs is the number of errors for each expression, by the name
+	// of its flag
+	errs map[string]int
+}
+
+// recordError indicates an error evaluating an expression for a record
+type recordError struct {
+	record int
+	flag   string
+	err    error
+}
+
+func (e recordError) Error() string {
+	return fmt.Sprintf("record: %d, %s: %s", e.record, e.flag, e.err)
+}
+
+func (f *filter) run(r recordReader, w recordWriter) error {
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		f.read++
+		out, err := f.process(rec)
+		if err != nil {
+			return err
+		}
+		if out != nil {
+			if err := w.Write(out); err != nil {
+				return fmt.Errorf("record: %d, %s", f.read, err)
+			}
+			f.written++
+		}
+	}
+	return w.Flush()
+}
+
+// process returns the record to output for rec, or nil if there isn't
+// one, or an error if the filter should stop
+func (f *filter) process(rec *record) (*record, error) {
+	vars := make(map[string]*dlit.Literal, len(rec.names)+len(f.columns))
+	for i, name := range rec.names {
+		if rec.lits[i] != nil {
+			vars[name] = rec.lits[i]
+		}
+	}
+	out := &record{
+		names: append([]string{}, rec.names...),
+		lits:  append([]*dlit.Literal{}, rec.lits...),
+	}
+	if rec.raws != nil {
+		out.raws = append([]json.RawMessage{}, rec.raws...)
+	}
+	errs := []recordError{}
+	for _, c := range f.columns {
+		l := c.expr.Eval(vars)
+		if err := l.Err(); err != nil {
+			f.errs["col "+c.name]++
+			errs = append(errs, recordError{f.read, "col " + c.name, err})
+			l = nil
+		} else {
+			vars[c.name] = l
+		}
+		out.set(c.name, l)
+	}
+	if f.where != nil {
+		isMatch, err := f.where.EvalBool(vars)
+		if err != nil {
+			f.errs["where"]++
+			errs = append(errs, recordError{f.read, "where", err})
+		} else if !isMatch {
+			return nil, nil
+		}
+	}
+	if len(errs) == 0 {
+		if f.onError == "column" {
+			out.set(f.errorCol, dlit.NewString(""))
+		}
+		return out, nil
+	}
+	switch f.onError {
+	case "skip":
+		f.skipped++
+		return nil, nil
+	case "column":
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.flag + ": " + err.err.Error()
+		}
+		out.set(f.errorCol, dlit.NewString(strings.Join(msgs, "; ")))
+		return out, nil
+	}
+	return nil, errs[0]
+}
+
+func (f *filter) writeSummary(w io.Writer) {
+	total := 0
+	for _, n := range f.errs {
+		total += n
+	}
+	fmt.Fprintf(w, "records read: %d, written: %d, skipped: %d, errors: %d\n",
+		f.read, f.written, f.skipped, total)
+	if f.where != nil && f.errs["where"] > 0 {
+		fmt.Fprintf(w, "  where: %d\n", f.errs["where"])
+	}
+	for _, c := range f.columns {
+		if n := f.errs["col "+c.name]; n > 0 {
+			fmt.Fprintf(w, "  col %s: %d\n", c.name, n)
+		}
+	}
+}
+
+// set sets the value of name, adding it if it doesn't exist.  A nil l
+// is written as an empty value.
+func (r *record) set(name string, l *dlit.Literal) {
+	for i, n := range r.names {
+		if n == name {
+			r.lits[i] = l
+			if r.raws != nil {
+				r.raws[i] = nil
+			}
+			return
+		}
+	}
+	r.names = append(r.names, name)
+	r.lits = append(r.lits, l)
+	if r.raws != nil {
+		r.raws = append(r.raws, nil)
+	}
+}
+
+func newRecordReader(format string, in io.Reader) (recordReader, error) {
+	switch format {
+	case "csv":
+		return &csvReader{r: csv.NewReader(in)}, nil
+	case "jsonl":
+		s := bufio.NewScanner(in)
+		s.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		return &jsonlReader{s: s}, nil
+	}
+	return nil, fmt.Errorf("unknown format: %s", format)
+}
+
+func newRecordWriter(format string, out io.Writer) (recordWriter, error) {
+	switch format {
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(out)}, nil
+	case "jsonl":
+		return &jsonlWriter{w: out}, nil
+	}
+	return nil, fmt.Errorf("unknown format: %s", format)
+}
+
+type csvReader struct {
+	r      *csv.Reader
+	header []string
+}
+
+func (cr *csvReader) Read() (*record, error) {
+	if cr.header == nil {
+		header, err := cr.r.Read()
+		if err != nil {
+			return nil, err
+		}
+		cr.header = header
+	}
+	fields, err := cr.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	rec := &record{
+		names: cr.header,
+		lits:  make([]*dlit.Literal, len(fields)),
+	}
+	for i, field := range fields {
+		rec.lits[i] = dlit.NewString(field)
+	}
+	return rec, nil
+}
+
+type jsonlReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func (jr *jsonlReader) Read() (*record, error) {
+	for jr.s.Scan() {
+		jr.line++
+		line := bytes.TrimSpace(jr.s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		rec, err := decodeJSONRecord(line)
+		if err != nil {
+			return nil, fmt.Errorf("line: %d, %s", jr.line, err)
+		}
+		return rec, nil
+	}
+	if err := jr.s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+var errNotJSONObject = errors.New("not a JSON object")
+
+// decodeJSONRecord decodes a JSON object keeping the order of its keys
+func decodeJSONRecord(b []byte) (*record, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil {
+		return nil, err
+	} else if tok != json.Delim('{') {
+		return nil, errNotJSONObject
+	}
+	rec := &record{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		rec.names = append(rec.names, tok.(string))
+		rec.lits = append(rec.lits, jsonToLiteral(raw))
+		rec.raws = append(rec.raws, raw)
+	}
+	return rec, nil
+}
+
+// jsonToLiteral returns the literal for raw, or nil if it is null
+func jsonToLiteral(raw json.RawMessage) *dlit.Literal {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return dlit.NewString(string(raw))
+	}
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return dlit.NewString(x)
+	case json.Number:
+		return dlit.NewString(x.String())
+	case bool:
+		return dlit.MustNew(x)
+	}
+	return dlit.NewString(string(raw))
+}
+
+// csvWriter writes records as CSV with a header taken from the fields
+// of the first record.  A later record that is missing a field has it
+// written as empty.
+type csvWriter struct {
+	w      *csv.Writer
+	header []string
+}
+
+// csvFieldError indicates that a record has a field that isn't in the
+// header, which can happen if the records are read from JSON Lines
+type csvFieldError string
+
+func (e csvFieldError) Error() string {
+	return fmt.Sprintf("field not in csv header: %s", string(e))
+}
+
+func (cw *csvWriter) Write(rec *record) error {
+	if cw.header == nil {
+		cw.header = rec.names
+		if err := cw.w.Write(cw.header); err != nil {
+			return err
+		}
+	}
+	fields := make([]string, len(cw.header))
+	for j, n := range rec.names {
+		i := indexOf(cw.header, n)
+		if i < 0 {
+			return csvFieldError(n)
+		}
+		if rec.lits[j] != nil {
+			fields[i] = rec.lits[j].String()
+		}
+	}
+	return cw.w.Write(fields)
+}
+
+// indexOf returns the index of s in strs or -1 if it isn't there
+func indexOf(strs []string, s string) int {
+	for i, str := range strs {
+		if str == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func (cw *csvWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type jsonlWriter struct {
+	w io.Writer
+}
+
+func (jw *jsonlWriter) Write(rec *record) error {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, name := range rec.names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(name)
+		b.Write(k)
+		b.WriteByte(':')
+		if rec.raws != nil && rec.raws[i] != nil {
+			b.Write(rec.raws[i])
+		} else {
+			b.Write(literalToJSON(rec.lits[i]))
+		}
+	}
+	b.WriteString("}\n")
+	_, err := jw.w.Write(b.Bytes())
+	return err
+}
+
+func (jw *jsonlWriter) Flush() error {
+	return nil
+}
+
+// jsonNumber matches a number as written in JSON
+var jsonNumber = regexp.MustCompile(
+	`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`,
+)
+
+// literalToJSON returns the JSON for l, with numbers and bools
+// unquoted and null if l is nil.  A number is only unquoted if it is
+// written as JSON would write it, so that values such as 01234, +5 and
+// NaN are kept as strings.
+func literalToJSON(l *dlit.Literal) []byte {
+	if l == nil {
+		return []byte("null")
+	}
+	s := l.String()
+	if s == "true" || s == "false" || jsonNumber.MatchString(s) {
+		return []byte(s)
+	}
+	b, _ := json.Marshal(s)
+	return b
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	csvIn := "name,age,income\n" +
+		"fred,34,1000\n" +
+		"mary,56,2500\n" +
+		"bob,21,none\n"
+	jsonIn := `{"name":"fred","age":34,"tags":["a"]}` + "\n" +
+		"\n" +
+		`{"name":"mary","age":56,"tags":null}` + "\n"
+	cases := []struct {
+		args        []string
+		in          string
+		want        string
+		wantSummary string
+		wantStatus  int
+	}{
+		{args: []string{"-where", "age > 30"},
+			in:          csvIn,
+			want:        "name,age,income\nfred,34,1000\nmary,56,2500\n",
+			wantSummary: "records read: 3, written: 2, skipped: 0, errors: 0\n",
+		},
+		{args: []string{"-col", "older=age+10", "-col", "big=older > 60",
+			"-where", "big"},
+			in:          csvIn,
+			want:        "name,age,income,older,big\nmary,56,2500,66,true\n",
+			wantSummary: "records read: 3, written: 1, skipped: 0, errors: 0\n",
+		},
+		{args: []string{"-col", "tax=income*0.2"},
+			in:   csvIn,
+			want: "name,age,income,tax\nfred,34,1000,200\nmary,56,2500,500\n",
+			wantSummary: "error: record: 3, col tax: invalid expression: " +
+				"income*0.2 (incompatible types)\n" +
+				"records read: 3, written: 2, skipped: 0, errors: 1\n" +
+				"  col tax: 1\n",
+			wantStatus: 1,
+		},
+		{args: []string{"-col", "tax=income*0.2", "-on-error", "skip"},
+			in:   csvIn,
+			want: "name,age,income,tax\nfred,34,1000,200\nmary,56,2500,500\n",
+			wantSummary: "records read: 3, written: 2, skipped: 1, errors: 1\n" +
+				"  col tax: 1\n",
+		},
+		{args: []string{"-col", "tax=income*0.2", "-on-error", "column",
+			"-where", "upper(name) != \"MARY\"", "-out", "jsonl"},
+			in: csvIn,
+			want: `{"name":"fred","age":34,"income":1000,"tax":200,"error":""}` +
+				"\n" +
+				`{"name":"bob","age":21,"income":"none","tax":null,` +
+				`"error":"col tax: invalid expression: income*0.2 ` +
+				`(incompatible types)"}` + "\n",
+			wantSummary: "records read: 3, written: 2, skipped: 0, errors: 1\n" +
+				"  col tax: 1\n",
+		},
+		{args: []string{"-in", "jsonl", "-col", "next=age+1"},
+			in: jsonIn,
+			want: `{"name":"fred","age":34,"tags":["a"],"next":35}` + "\n" +
+				`{"name":"mary","age":56,"tags":null,"next":57}` + "\n",
+			wantSummary: "records read: 2, written: 2, skipped: 0, errors: 0\n",
+		},
+		{args: []string{"-in", "jsonl", "-out", "csv", "-where",
+			"name == \"mary\""},
+			in:          jsonIn,
+			want:        "name,age,tags\nmary,56,\n",
+			wantSummary: "records read: 2, written: 1, skipped: 0, errors: 0\n",
+		},
+		{args: []string{"-in", "jsonl", "-where", "tags == 5",
+			"-on-error", "skip"},
+			in:   jsonIn,
+			want: "",
+			wantSummary: "records read: 2, written: 0, skipped: 1, errors: 1\n" +
+				"  where: 1\n",
+		},
+		{args: []string{"-out", "jsonl"},
+			in:          "zip,n,x,y\n01234,+5,NaN,-1.5e3\n",
+			want:        `{"zip":"01234","n":"+5","x":"NaN","y":-1.5e3}` + "\n",
+			wantSummary: "records read: 1, written: 1, skipped: 0, errors: 0\n",
+		},
+		{args: []string{"-in", "jsonl", "-out", "csv"},
+			in:   `{"name":"fred"}` + "\n" + `{"name":"mary","age":56}` + "\n",
+			want: "name\nfred\n",
+			wantSummary: "error: record: 2, field not in csv header: age\n" +
+				"records read: 2, written: 1, skipped: 0, errors: 0\n",
+			wantStatus: 1,
+		},
+	}
+	for _, c := range cases {
+		var out, errOut bytes.Buffer
+		status := run(append([]string{"filter"}, c.args...),
+			strings.NewReader(c.in), &out, &errOut)
+		if status != c.wantStatus {
+			t.Errorf("run(%v) status: %d, want: %d", c.args, status, c.wantStatus)
+		}
+		if got := out.String(); got != c.want {
+			t.Errorf("run(%v) got:\n%s\nwant:\n%s", c.args, got, c.want)
+		}
+		if gotSummary := errOut.String(); gotSummary != c.wantSummary {
+			t.Errorf("run(%v) stderr:\n%s\nwant:\n%s", c.args, gotSummary,
+				c.wantSummary)
+		}
+	}
+}
+
+func TestFilter_errors(t *testing.T) {
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"-where", "a >"},
+			want: "error: -where: invalid expression: a > (syntax error)\n"},
+		{args: []string{"-col", "5a=1"},
+			want: "error: -col: must be name=expr: 5a=1\n"},
+		{args: []string{"-on-error", "ignore"},
+			want: "error: invalid -on-error: ignore\n"},
+		{args: []string{"-in", "xml"}, want: "error: unknown format: xml\n"},
+	}
+	for _, c := range cases {
+		var out, errOut bytes.Buffer
+		status := run(append([]string{"filter"}, c.args...),
+			strings.NewReader(""), &out, &errOut)
+		if status != 2 {
+			t.Errorf("run(%v) status: %d, want: 2", c.args, status)
+		}
+		if got := errOut.String(); got != c.want {
+			t.Errorf("run(%v) stderr: %s, want: %s", c.args, got, c.want)
+		}
+	}
+}
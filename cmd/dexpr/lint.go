@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/lawrencewoodman/dexpr/stdfuncs"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const lintUsage = `Usage: dexpr lint [flags] [file ...]
+
+Checks the rules in each rule file, or stdin if there aren't any, for
+likely mistakes.  Each rule is written as name = expr at the start of a
+line and may continue over following indented lines.  The exit status
+is 1 if there are any warnings or errors.
+
+`
+
+func runLint(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("lint", stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, lintUsage)
+		fs.PrintDefaults()
+	}
+	maxDepth := fs.Int("maxdepth", 0,
+		"how deeply brackets may be nested, the default if 0")
+	noStd := fs.Bool("nostd", false, "don't load the standard function library")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	funcs := map[string]dexpr.CallFun{}
+	if !*noStd {
+		funcs = stdfuncs.CallFuncs()
+	}
+	linter := dexpr.Linter{MaxDepth: *maxDepth}
+
+	status := 0
+	lintFile := func(filename string, r io.Reader) {
+		src, err := ioutil.ReadAll(r)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %s\n", err)
+			status = 2
+			return
+		}
+		if lintRules(stdout, linter, funcs, filename, string(src)) &&
+			status == 0 {
+			status = 1
+		}
+	}
+	if fs.NArg() == 0 {
+		lintFile("<stdin>", stdin)
+		return status
+	}
+	for _, filename := range fs.Args() {
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %s\n", err)
+			status = 2
+			continue
+		}
+		lintFile(filename, f)
+		f.Close()
+	}
+	return status
+}
+
+// lintRules writes the diagnostics for the rules in src and returns
+// whether any were warnings or errors
+func lintRules(
+	w io.Writer,
+	linter dexpr.Linter,
+	funcs map[string]dexpr.CallFun,
+	filename string,
+	src string,
+) bool {
+	rules, err := dexpr.ParseRules(src)
+	if err != nil {
+		if ferr, ok := err.(dexpr.RuleFileError); ok {
+			fmt.Fprintf(w, "%s:%s: error: %s\n", filename, ferr.Pos, ferr.Msg)
+		} else {
+			fmt.Fprintf(w, "%s: error: %s\n", filename, err)
+		}
+		return true
+	}
+	failed := false
+	for _, r := range rules {
+		for _, d := range linter.LintSource(r.Expr, funcs) {
+			fmt.Fprintf(w, "%s:%s: %s: %s: %s [%s]\n",
+				filename, r.FilePos(d.Pos), d.Severity, r.Name, d.Msg, d.Code)
+			if d.Severity >= dexpr.SeverityWarning {
+				failed = true
+			}
+		}
+	}
+	return failed
+}
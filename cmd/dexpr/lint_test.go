@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	cases := []struct {
+		args       []string
+		in         string
+		want       string
+		wantStatus int
+	}{
+		{in: "isAdult = age >= 18\nisRich = income > 1000000\n",
+			want:       "",
+			wantStatus: 0,
+		},
+		{in: "# Checks\n" +
+			"same = a == a\n" +
+			"ok = (a > 5)\n" +
+			"rate = income /\n" +
+			"  0 > 5\n",
+			want: "<stdin>:2:8: warning: same: a == a compares an operand " +
+				"with itself so is always true [self-compare]\n" +
+				"<stdin>:3:6: info: ok: parentheses around a > 5 aren't needed " +
+				"[redundant-parens]\n" +
+				"<stdin>:4:8: error: rate: income / 0 always divides by zero " +
+				"[div-by-zero]\n",
+			wantStatus: 1,
+		},
+		{in: "ok = (a > 5)\n",
+			want: "<stdin>:1:6: info: ok: parentheses around a > 5 aren't needed " +
+				"[redundant-parens]\n",
+			wantStatus: 0,
+		},
+		{in: "a = roundto(b, 2) > 2 &&\n  c >\n",
+			want: "<stdin>:1:5: error: a: invalid expression: " +
+				"roundto(b, 2) > 2 &&\n  c > (syntax error) [invalid]\n",
+			wantStatus: 1,
+		},
+		{args: []string{"-maxdepth", "1"},
+			in: "a = ((b))\n",
+			want: "<stdin>:1:5: info: a: parentheses around b aren't needed " +
+				"[redundant-parens]\n" +
+				"<stdin>:1:6: info: a: nested 2 deep, more than 1 [deep-nesting]\n" +
+				"<stdin>:1:6: info: a: parentheses around b aren't needed " +
+				"[redundant-parens]\n",
+			wantStatus: 0,
+		},
+		{in: "a = 1\nb == 2\n",
+			want:       "<stdin>:2:1: error: expected: name = expr\n",
+			wantStatus: 1,
+		},
+	}
+	for _, c := range cases {
+		var out, errOut bytes.Buffer
+		status := run(append([]string{"lint"}, c.args...),
+			strings.NewReader(c.in), &out, &errOut)
+		if status != c.wantStatus || errOut.Len() != 0 {
+			t.Errorf("run(%q) status: %d, stderr: %s, want status: %d",
+				c.in, status, &errOut, c.wantStatus)
+		}
+		if got := out.String(); got != c.want {
+			t.Errorf("run(%q) got:\n%s\nwant:\n%s", c.in, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/lawrencewoodman/dexpr/lsp"
+	"github.com/lawrencewoodman/dexpr/stdfuncs"
+	"io"
+	"strings"
+)
+
+const lspUsage = `Usage: dexpr lsp [flags]
+
+Runs a Language Server Protocol server for rule files over stdin and
+stdout.
+
+`
+
+func runLsp(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("lsp", stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, lspUsage)
+		fs.PrintDefaults()
+	}
+	noStd := fs.Bool("nostd", false, "don't load the standard function library")
+	vars := fs.String("vars", "",
+		"comma separated `names` of the variables the rules may use")
+	maxWidth := fs.Int("maxwidth", 80,
+		"width beyond which formatting splits && and || chains, none if 0")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg := lsp.Config{
+		CallFuncs: map[string]dexpr.CallFun{},
+		FuncInfo:  map[string]lsp.FuncInfo{},
+		Vars:      map[string]string{},
+		Formatter: dexpr.Formatter{MaxWidth: *maxWidth, Indent: "    "},
+	}
+	if !*noStd {
+		for _, f := range stdfuncs.All {
+			cfg.CallFuncs[f.Name] = f.Fn
+			cfg.FuncInfo[f.Name] = lsp.FuncInfo{Signature: f.Signature, Doc: f.Doc}
+		}
+	}
+	for _, name := range strings.Split(*vars, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.Vars[name] = ""
+		}
+	}
+	if err := lsp.NewServer(cfg).Serve(stdin, stdout); err != nil {
+		fmt.Fprintf(stderr, "error: %s\n", err)
+		return 1
+	}
+	return 0
+}
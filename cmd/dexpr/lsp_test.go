@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLsp(t *testing.T) {
+	requests := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	}
+	var in bytes.Buffer
+	for _, r := range requests {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(r), r)
+	}
+	var out, errOut bytes.Buffer
+	status := run([]string{"lsp"}, &in, &out, &errOut)
+	if status != 0 || errOut.Len() != 0 {
+		t.Errorf("run status: %d, stderr: %s", status, &errOut)
+	}
+	got := out.String()
+	if !strings.Contains(got, `"hoverProvider":true`) ||
+		!strings.HasSuffix(got, `{"jsonrpc":"2.0","id":2,"result":null}`) {
+		t.Errorf("run got: %s", got)
+	}
+}
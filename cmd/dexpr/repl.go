@@ -0,0 +1,338 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/lawrencewoodman/dexpr/stdfuncs"
+	"github.com/lawrencewoodman/dlit"
+	"go/scanner"
+	"go/token"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const replHelp = `Enter an expression to evaluate it or one of the following commands:
+  :set name = expr   set variable name to the value of expr
+  :unset name        remove variable name
+  :vars              list the variables
+  :funcs             list the functions
+  :load std          load the standard function library
+  :explain expr      show the value of each part of expr
+  :history           list the history, use !n to repeat entry n
+  :help              show this help
+  :quit              leave the repl
+An expression continues onto the next line if a line ends with \, an
+operator or within brackets.
+`
+
+type repl struct {
+	in          *bufio.Scanner
+	out         io.Writer
+	vars        map[string]*dlit.Literal
+	funcs       map[string]dexpr.CallFun
+	history     []string
+	historyFile string
+}
+
+func runRepl(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("repl", stderr)
+	noStd := fs.Bool("nostd", false, "don't load the standard function library")
+	historyFile := fs.String("history", defaultHistoryFile(),
+		"file to keep the history in, none if empty")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	r := &repl{
+		in:          bufio.NewScanner(stdin),
+		out:         stdout,
+		vars:        map[string]*dlit.Literal{},
+		funcs:       map[string]dexpr.CallFun{},
+		historyFile: *historyFile,
+	}
+	if !*noStd {
+		r.loadStd()
+	}
+	if err := r.loadHistory(); err != nil {
+		fmt.Fprintf(stderr, "error: %s\n", err)
+	}
+	r.run()
+	return 0
+}
+
+// run reads and executes entries until :quit or the end of the input
+func (r *repl) run() {
+	for {
+		entry, ok := r.readEntry()
+		if !ok {
+			return
+		}
+		if entry == "" {
+			continue
+		}
+		if strings.HasPrefix(entry, "!") {
+			n, err := strconv.Atoi(entry[1:])
+			if err != nil || n < 1 || n > len(r.history) {
+				fmt.Fprintf(r.out, "error: no history entry: %s\n", entry[1:])
+				continue
+			}
+			entry = r.history[n-1]
+			fmt.Fprintln(r.out, entry)
+		}
+		r.addHistory(entry)
+		if !r.exec(entry) {
+			return
+		}
+	}
+}
+
+// readEntry reads an entry which may continue over several lines
+func (r *repl) readEntry() (string, bool) {
+	prompt := "> "
+	lines := []string{}
+	for {
+		fmt.Fprint(r.out, prompt)
+		if !r.in.Scan() {
+			if len(lines) > 0 {
+				return strings.Join(lines, "\n"), true
+			}
+			fmt.Fprintln(r.out)
+			return "", false
+		}
+		line := r.in.Text()
+		if strings.HasSuffix(line, "\\") {
+			lines = append(lines, strings.TrimSuffix(line, "\\"))
+			prompt = "... "
+			continue
+		}
+		lines = append(lines, line)
+		entry := strings.TrimSpace(strings.Join(lines, "\n"))
+		if strings.HasPrefix(entry, ":") && !strings.HasPrefix(entry, ":set") &&
+			!strings.HasPrefix(entry, ":explain") {
+			return entry, true
+		}
+		if !isIncomplete(entry) {
+			return entry, true
+		}
+		prompt = "... "
+	}
+}
+
+// isIncomplete returns whether src ends with an operator or has
+// brackets that haven't been closed
+func isIncomplete(src string) bool {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	s.Init(file, []byte(src), nil, 0)
+	depth := 0
+	last := token.ILLEGAL
+	for {
+		_, tok, _ := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		switch tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		}
+		if tok != token.SEMICOLON {
+			last = tok
+		}
+	}
+	if depth > 0 {
+		return true
+	}
+	switch last {
+	case token.ADD, token.SUB, token.MUL, token.QUO, token.LAND, token.LOR,
+		token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ,
+		token.NOT, token.COMMA, token.ASSIGN:
+		return true
+	}
+	return false
+}
+
+// exec executes an entry and returns false if the repl should stop
+func (r *repl) exec(entry string) bool {
+	if !strings.HasPrefix(entry, ":") {
+		r.eval(entry)
+		return true
+	}
+	cmd, rest := entry, ""
+	if i := strings.IndexAny(entry, " \t\n"); i >= 0 {
+		cmd, rest = entry[:i], strings.TrimSpace(entry[i+1:])
+	}
+	switch cmd {
+	case ":quit", ":q":
+		return false
+	case ":help":
+		fmt.Fprint(r.out, replHelp)
+	case ":set":
+		r.set(rest)
+	case ":unset":
+		delete(r.vars, rest)
+	case ":vars":
+		for _, name := range sortedVarNames(r.vars) {
+			fmt.Fprintf(r.out, "%s = %s\n", name, dexpr.FormatValue(r.vars[name]))
+		}
+	case ":funcs":
+		r.listFuncs()
+	case ":load":
+		if rest != "std" {
+			fmt.Fprintf(r.out, "error: unknown library: %s\n", rest)
+			break
+		}
+		r.loadStd()
+	case ":explain":
+		expr, err := dexpr.New(rest, r.funcs)
+		if err != nil {
+			r.printError(rest, err)
+			break
+		}
+		fmt.Fprint(r.out, expr.Explain(r.vars))
+	case ":history":
+		for i, h := range r.history {
+			fmt.Fprintf(r.out, "%4d  %s\n", i+1,
+				strings.Replace(h, "\n", "\n      ", -1))
+		}
+	default:
+		fmt.Fprintf(r.out, "error: unknown command: %s, use :help\n", cmd)
+	}
+	return true
+}
+
+func (r *repl) eval(src string) {
+	expr, err := dexpr.New(src, r.funcs)
+	if err != nil {
+		r.printError(src, err)
+		return
+	}
+	l := expr.Eval(r.vars)
+	if err := l.Err(); err != nil {
+		r.printError(src, err)
+		return
+	}
+	fmt.Fprintln(r.out, dexpr.FormatValue(l))
+}
+
+// set handles :set name = expr
+func (r *repl) set(args string) {
+	parts := strings.SplitN(args, "=", 2)
+	if len(parts) != 2 {
+		fmt.Fprintln(r.out, "error: use :set name = expr")
+		return
+	}
+	name := strings.TrimSpace(parts[0])
+	src := strings.TrimSpace(parts[1])
+	if !token.IsIdentifier(name) {
+		fmt.Fprintf(r.out, "error: invalid variable name: %s\n", name)
+		return
+	}
+	expr, err := dexpr.New(src, r.funcs)
+	if err != nil {
+		r.printError(src, err)
+		return
+	}
+	l := expr.Eval(r.vars)
+	if err := l.Err(); err != nil {
+		r.printError(src, err)
+		return
+	}
+	r.vars[name] = l
+}
+
+// printError prints err and if it has a position, the line of src
+// that it is on with a marker below the position
+func (r *repl) printError(src string, err error) {
+	fmt.Fprintf(r.out, "error: %s\n", err)
+	var derr dexpr.DialectError
+	if !errors.As(err, &derr) {
+		return
+	}
+	lines := strings.Split(src, "\n")
+	if derr.Pos.Line < 1 || derr.Pos.Line > len(lines) {
+		return
+	}
+	fmt.Fprintf(r.out, "  %s\n  %s^\n", lines[derr.Pos.Line-1],
+		strings.Repeat(" ", derr.Pos.Column-1))
+}
+
+func (r *repl) loadStd() {
+	for name, fn := range stdfuncs.CallFuncs() {
+		r.funcs[name] = fn
+	}
+}
+
+func (r *repl) listFuncs() {
+	for _, name := range sortedFuncNames(r.funcs) {
+		if f, ok := stdfuncs.Lookup(name); ok {
+			fmt.Fprintf(r.out, "%-22s %s\n", f.Signature, f.Doc)
+		} else {
+			fmt.Fprintln(r.out, name)
+		}
+	}
+}
+
+func (r *repl) loadHistory() error {
+	if r.historyFile == "" {
+		return nil
+	}
+	b, err := os.ReadFile(r.historyFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if entry, err := strconv.Unquote(line); err == nil {
+			r.history = append(r.history, entry)
+		}
+	}
+	return nil
+}
+
+// addHistory adds entry to the history and appends it to the
+// history file if there is one
+func (r *repl) addHistory(entry string) {
+	r.history = append(r.history, entry)
+	if r.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(r.historyFile,
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, strconv.Quote(entry))
+}
+
+func sortedVarNames(vars map[string]*dlit.Literal) []string {
+	r := make([]string, 0, len(vars))
+	for name := range vars {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func sortedFuncNames(funcs map[string]dexpr.CallFun) []string {
+	r := make([]string, 0, len(funcs))
+	for name := range funcs {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return r
+}
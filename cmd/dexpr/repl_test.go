@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRepl(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{in: "1 + 2\n", want: "> 3\n> \n"},
+		{in: ":set x = 5\n:set s = \"fred\"\nx * 2\n:vars\n",
+			want: "> > > 10\n> s = \"fred\"\nx = 5\n> \n",
+		},
+		{in: "roundto(2.567, 1) +\n  1\n", want: "> ... 3.6\n> \n"},
+		{in: "max(1,\n7,\n3)\n", want: "> ... ... 7\n> \n"},
+		{in: "3 * \\\n2\n", want: "> ... 6\n> \n"},
+		{in: "y + 1\n",
+			want: "> error: invalid expression: y + 1 " +
+				"(variable doesn't exist: y)\n> \n",
+		},
+		{in: ":set x = 7\n:explain x > 5 && lower(\"A\") == \"a\"\n",
+			want: "> > x > 5 && lower(\"A\") == \"a\" = true\n" +
+				"  x > 5 = true\n" +
+				"    x = 7\n" +
+				"    5 = 5\n" +
+				"  lower(\"A\") == \"a\" = true\n" +
+				"    lower(\"A\") = \"a\"\n" +
+				"      \"A\" = \"A\"\n" +
+				"    \"a\" = \"a\"\n" +
+				"> \n",
+		},
+		{in: "2 + 2\n7\n:history\n!1\n:q\n4\n",
+			want: "> 4\n> 7\n>    1  2 + 2\n   2  7\n   3  :history\n" +
+				"> 2 + 2\n4\n> ",
+		},
+		{in: ":set 5x = 1\n:bob\n!9\n",
+			want: "> error: invalid variable name: 5x\n" +
+				"> error: unknown command: :bob, use :help\n" +
+				"> error: no history entry: 9\n> \n",
+		},
+	}
+	for _, c := range cases {
+		var out, errOut bytes.Buffer
+		status := run([]string{"repl", "-history", ""},
+			strings.NewReader(c.in), &out, &errOut)
+		if status != 0 || errOut.Len() != 0 {
+			t.Errorf("run(%q) status: %d, stderr: %s", c.in, status, &errOut)
+		}
+		if got := out.String(); got != c.want {
+			t.Errorf("run(%q) got:\n%s\nwant:\n%s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestRepl_nostd(t *testing.T) {
+	var out, errOut bytes.Buffer
+	in := "abs(-2)\n:load std\nabs(-2)\n"
+	run([]string{"repl", "-nostd", "-history", ""},
+		strings.NewReader(in), &out, &errOut)
+	want := "> error: invalid expression: abs(-2) " +
+		"(function doesn't exist: abs)\n> > 2\n> \n"
+	if got := out.String(); got != want {
+		t.Errorf("run(%q) got:\n%s\nwant:\n%s", in, got, want)
+	}
+}
+
+func TestRepl_historyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dexpr")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	historyFile := filepath.Join(dir, "history")
+	var out, errOut bytes.Buffer
+	run([]string{"repl", "-history", historyFile},
+		strings.NewReader("1 +\n2\n"), &out, &errOut)
+	out.Reset()
+	run([]string{"repl", "-history", historyFile},
+		strings.NewReader(":history\n"), &out, &errOut)
+	want := ">    1  1 +\n      2\n   2  :history\n> \n"
+	if got := out.String(); got != want {
+		t.Errorf("history got:\n%s\nwant:\n%s", got, want)
+	}
+}
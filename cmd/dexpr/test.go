@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package main
+
+import (
+	"fmt"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/lawrencewoodman/dexpr/dexprtest"
+	"github.com/lawrencewoodman/dexpr/stdfuncs"
+	"io"
+	"os"
+)
+
+const testUsage = `Usage: dexpr test [flags] [file ...]
+
+Runs the cases in each test file, or stdin if there aren't any, and
+reports those whose result isn't as expected.  Each case is written as:
+
+  expr price * quantity
+  var price = 1.5
+  var quantity = 4
+  want 6
+
+with an error line such as "error div-by-zero" in place of the want
+line if an error is expected.  The exit status is 1 if any cases fail
+and 2 if any of the files can't be read or parsed.
+
+`
+
+func runTest(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("test", stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, testUsage)
+		fs.PrintDefaults()
+	}
+	noStd := fs.Bool("nostd", false, "don't load the standard function library")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	funcs := map[string]dexpr.CallFun{}
+	if !*noStd {
+		funcs = stdfuncs.CallFuncs()
+	}
+
+	numCases := 0
+	numFailed := 0
+	// numBadFiles is the number of files that couldn't be read or parsed
+	numBadFiles := 0
+	testFile := func(filename string, r io.Reader) {
+		cases, err := dexprtest.Parse(filename, r)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %s\n", err)
+			numBadFiles++
+			return
+		}
+		failures := dexprtest.Run(cases, funcs)
+		for _, f := range failures {
+			fmt.Fprintln(stdout, f)
+		}
+		numCases += len(cases)
+		numFailed += len(failures)
+	}
+	if fs.NArg() == 0 {
+		testFile("<stdin>", stdin)
+	} else {
+		for _, filename := range fs.Args() {
+			f, err := os.Open(filename)
+			if err != nil {
+				fmt.Fprintf(stderr, "error: %s\n", err)
+				numBadFiles++
+				continue
+			}
+			testFile(filename, f)
+			f.Close()
+		}
+	}
+	fmt.Fprintf(stdout, "cases: %d, failed: %d", numCases, numFailed)
+	if numBadFiles > 0 {
+		fmt.Fprintf(stdout, ", files with errors: %d\n", numBadFiles)
+		return 2
+	}
+	fmt.Fprintln(stdout)
+	if numFailed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTest(t *testing.T) {
+	cases := []struct {
+		args       []string
+		in         string
+		want       string
+		wantErrOut string
+		wantStatus int
+	}{
+		{in: "expr roundto(x, 1)\nvar x = 2.25\nwant 2.3\n\n" +
+			"expr x / 0\nvar x = 2\nerror div-by-zero\n",
+			want:       "cases: 2, failed: 0\n",
+			wantStatus: 0,
+		},
+		{in: "expr x * 2\nvar x = 2\nwant 5\n\n" +
+			"expr x / 0\nvar x = 2\nerror div-by-zero\n",
+			want: "<stdin>:1: expr x * 2\n  got:  4\n  want: 5\n" +
+				"cases: 2, failed: 1\n",
+			wantStatus: 1,
+		},
+		{args: []string{"-nostd"},
+			in: "expr roundto(x, 1)\nvar x = 2.25\nwant 2.3\n",
+			want: "<stdin>:1: expr roundto(x, 1)\n" +
+				"  got:  error: invalid expression: roundto(x, 1) " +
+				"(function doesn't exist: roundto)\n" +
+				"  want: 2.3\n" +
+				"cases: 1, failed: 1\n",
+			wantStatus: 1,
+		},
+		{in: "want 5\n",
+			want:       "cases: 0, failed: 0, files with errors: 1\n",
+			wantErrOut: "error: <stdin>:1: want line isn't part of a case\n",
+			wantStatus: 2,
+		},
+		{args: []string{"/nonexistent/cases.txt"},
+			want: "cases: 0, failed: 0, files with errors: 1\n",
+			wantErrOut: "error: open /nonexistent/cases.txt: " +
+				"no such file or directory\n",
+			wantStatus: 2,
+		},
+	}
+	for _, c := range cases {
+		var out, errOut bytes.Buffer
+		status := run(append([]string{"test"}, c.args...),
+			strings.NewReader(c.in), &out, &errOut)
+		if status != c.wantStatus {
+			t.Errorf("run(%v) status: %d, want: %d", c.args, status, c.wantStatus)
+		}
+		if got := out.String(); got != c.want {
+			t.Errorf("run(%v) got: %q, want: %q", c.args, got, c.want)
+		}
+		if got := errOut.String(); got != c.wantErrOut {
+			t.Errorf("run(%v) stderr: %q, want: %q", c.args, got, c.wantErrOut)
+		}
+	}
+}
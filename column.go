@@ -0,0 +1,310 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"fmt"
+	"github.com/lawrencewoodman/dlit"
+)
+
+// Columns holds named columns of data, each of the same length, to be
+// evaluated by Expr.EvalColumns.  Each row of the columns is treated
+// in the same way as a set of vars passed to Expr.Eval.
+type Columns struct {
+	n    int
+	cols map[string][]value
+}
+
+// Column is the result of Expr.EvalColumns.  Each row holds the result
+// that Expr.Eval would return for the same row of vars.
+type Column struct {
+	expr   *Expr
+	values []value
+	valid  []uint64
+}
+
+// columnEval holds the state of an evaluation by Expr.EvalColumns
+type columnEval struct {
+	cols *Columns
+	free [][]value
+}
+
+// ColumnLengthError indicates that a column added to Columns has
+// a different length to the other columns
+type ColumnLengthError struct {
+	Name   string
+	Len    int
+	Expect int
+}
+
+func (e ColumnLengthError) Error() string {
+	return fmt.Sprintf("column: %s, has length: %d, expected: %d",
+		e.Name, e.Len, e.Expect)
+}
+
+// NewColumns returns an empty Columns for columns of length n
+func NewColumns(n int) *Columns {
+	return &Columns{n: n, cols: map[string][]value{}}
+}
+
+// Len returns the number of rows in each column
+func (c *Columns) Len() int {
+	return c.n
+}
+
+func (c *Columns) AddInt64(name string, col []int64) error {
+	vs, err := c.newColumn(name, len(col))
+	if err != nil {
+		return err
+	}
+	for i, x := range col {
+		vs[i] = intValue(x)
+	}
+	return nil
+}
+
+func (c *Columns) AddFloat64(name string, col []float64) error {
+	vs, err := c.newColumn(name, len(col))
+	if err != nil {
+		return err
+	}
+	for i, x := range col {
+		vs[i] = floatValue(x)
+	}
+	return nil
+}
+
+func (c *Columns) AddBool(name string, col []bool) error {
+	vs, err := c.newColumn(name, len(col))
+	if err != nil {
+		return err
+	}
+	for i, x := range col {
+		vs[i] = boolValue(x)
+	}
+	return nil
+}
+
+func (c *Columns) AddString(name string, col []string) error {
+	vs, err := c.newColumn(name, len(col))
+	if err != nil {
+		return err
+	}
+	for i, x := range col {
+		vs[i] = litValue(dlit.NewString(x))
+	}
+	return nil
+}
+
+func (c *Columns) AddLiteral(name string, col []*dlit.Literal) error {
+	vs, err := c.newColumn(name, len(col))
+	if err != nil {
+		return err
+	}
+	for i, x := range col {
+		vs[i] = litValue(x)
+	}
+	return nil
+}
+
+func (c *Columns) newColumn(name string, n int) ([]value, error) {
+	if n != c.n {
+		return nil, ColumnLengthError{Name: name, Len: n, Expect: c.n}
+	}
+	vs := make([]value, n)
+	c.cols[name] = vs
+	return vs, nil
+}
+
+// EvalColumns evaluates the expression over whole columns at a time,
+// one operation after another, rather than row by row.  The results are
+// the same as calling Eval for each row.  If the expression has Limits
+// they apply to each row, so the rows are evaluated one at a time.
+func (expr *Expr) EvalColumns(cols *Columns) *Column {
+	var vs []value
+	if expr.Limits == (Limits{}) {
+		vs = expr.en.evalColumn(&columnEval{cols: cols})
+	} else {
+		vs = expr.evalRows(cols)
+	}
+	valid := make([]uint64, (len(vs)+63)/64)
+	for i, v := range vs {
+		if v.Err() == nil {
+			valid[i/64] |= 1 << uint(i%64)
+		}
+	}
+	return &Column{expr: expr, values: vs, valid: valid}
+}
+
+// evalRows evaluates each row of cols in the same way as Eval
+func (expr *Expr) evalRows(cols *Columns) []value {
+	vs := make([]value, cols.n)
+	vars := make(map[string]*dlit.Literal, len(cols.cols))
+	for i := range vs {
+		for name, col := range cols.cols {
+			vars[name] = col[i].Literal()
+		}
+		vs[i] = expr.en.evalValue(vars, expr.newEvalState(nil, expr.Limits))
+	}
+	return vs
+}
+
+// Len returns the number of rows in the column
+func (c *Column) Len() int {
+	return len(c.values)
+}
+
+// Valid returns whether row i was evaluated without an error
+func (c *Column) Valid(i int) bool {
+	return c.valid[i/64]&(1<<uint(i%64)) != 0
+}
+
+// Validity returns a bitmap with a bit set for each row that was
+// evaluated without an error.  Row i is held in bit i%64 of word i/64.
+func (c *Column) Validity() []uint64 {
+	return c.valid
+}
+
+// Err returns the error for row i, if there is one, in the same form
+// as Expr.Eval
+func (c *Column) Err(i int) error {
+	if err := c.values[i].Err(); err != nil {
+		return InvalidExprError{c.expr.Expr, err}
+	}
+	return nil
+}
+
+// Literal returns row i as a *dlit.Literal in the same form as Expr.Eval
+func (c *Column) Literal(i int) *dlit.Literal {
+	if err := c.Err(i); err != nil {
+		return dlit.MustNew(err)
+	}
+	return c.values[i].Literal()
+}
+
+func (c *Column) Int(i int) (int64, bool) {
+	return c.values[i].Int()
+}
+
+func (c *Column) Float(i int) (float64, bool) {
+	return c.values[i].Float()
+}
+
+func (c *Column) Bool(i int) (bool, bool) {
+	return c.values[i].Bool()
+}
+
+// alloc returns a column buffer, reusing one that has been released
+// if possible
+func (ce *columnEval) alloc() []value {
+	if n := len(ce.free); n > 0 {
+		vs := ce.free[n-1]
+		ce.free = ce.free[:n-1]
+		return vs
+	}
+	return make([]value, ce.cols.n)
+}
+
+// release returns a column buffer so that it can be reused
+func (ce *columnEval) release(vs []value) {
+	ce.free = append(ce.free, vs)
+}
+
+func (ee enErr) evalColumn(ce *columnEval) []value {
+	r := ce.alloc()
+	for i := range r {
+		r[i] = errValue(ee.err)
+	}
+	return r
+}
+
+func (el enLit) evalColumn(ce *columnEval) []value {
+	r := ce.alloc()
+	for i := range r {
+		r[i] = el.v
+	}
+	return r
+}
+
+func (ev enVar) evalColumn(ce *columnEval) []value {
+	r := ce.alloc()
+	if col, ok := ce.cols.cols[string(ev)]; ok {
+		copy(r, col)
+		return r
+	}
+	err := VarNotExistError(ev)
+	for i := range r {
+		r[i] = errValue(err)
+	}
+	return r
+}
+
+func (eb enBinary) evalColumn(ce *columnEval) []value {
+	lhVs := eb.lh.evalColumn(ce)
+	rhVs := eb.rh.evalColumn(ce)
+	for i, lhV := range lhVs {
+		rhV := rhVs[i]
+		if lhV.Err() != nil {
+			continue
+		}
+		if rhV.Err() != nil {
+			lhVs[i] = rhV
+			continue
+		}
+		lhVs[i] = eb.fn(lhV, rhV)
+	}
+	ce.release(rhVs)
+	return lhVs
+}
+
+func (eu enUnary) evalColumn(ce *columnEval) []value {
+	rhVs := eu.rh.evalColumn(ce)
+	for i, rhV := range rhVs {
+		if rhV.Err() == nil {
+			rhVs[i] = eu.fn(rhV)
+		}
+	}
+	return rhVs
+}
+
+func (ec enCall) evalColumn(ce *columnEval) []value {
+	args := make([][]value, len(ec.args))
+	for i, arg := range ec.args {
+		args[i] = arg.evalColumn(ce)
+	}
+	r := ce.alloc()
+	for i := range r {
+		lits := make([]*dlit.Literal, len(args))
+		for j, arg := range args {
+			lits[j] = arg[i].Literal()
+		}
+		r[i] = litValue(callFun(ec.funcs, nil, ec.name, lits))
+	}
+	for _, arg := range args {
+		ce.release(arg)
+	}
+	return r
+}
+
+// evalColumn evaluates en without recording a Trace, as an enTrace
+// is only evaluated by Explain
+func (et enTrace) evalColumn(ce *columnEval) []value {
+	return et.en.evalColumn(ce)
+}
+
+func (ec enCond) evalColumn(ce *columnEval) []value {
+	vs := ec.en.evalColumn(ce)
+	for _, v := range vs {
+		ec.cover.record(ec.cond, v)
+	}
+	return vs
+}
+
+func (ec enCovered) evalColumn(ce *columnEval) []value {
+	ec.cover.evaluated(ec.expr, ce.cols.n)
+	return ec.en.evalColumn(ce)
+}
@@ -0,0 +1,148 @@
+package dexpr
+
+import (
+	"github.com/lawrencewoodman/dlit"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEvalColumns(t *testing.T) {
+	ints := []int64{0, 1, -7, 9, math.MaxInt64, math.MinInt64, 3, 4}
+	floats := []float64{0, 2.5, -1.25, 9, 1e300, math.MaxFloat64, 3.5, 0.1}
+	strs := []string{"4", "fred", "2.5", "", "true", "9", "-3", "hello"}
+	bools := []bool{true, false, true, false, true, false, true, true}
+	cols := NewColumns(len(ints))
+	if err := cols.AddInt64("i", ints); err != nil {
+		t.Fatalf("AddInt64: %s", err)
+	}
+	if err := cols.AddFloat64("f", floats); err != nil {
+		t.Fatalf("AddFloat64: %s", err)
+	}
+	if err := cols.AddString("s", strs); err != nil {
+		t.Fatalf("AddString: %s", err)
+	}
+	if err := cols.AddBool("b", bools); err != nil {
+		t.Fatalf("AddBool: %s", err)
+	}
+	cases := []string{
+		"i + f",
+		"i - f * 2",
+		"i * i",
+		"i / f",
+		"f / i",
+		"-i",
+		"-f + 3",
+		"i < f",
+		"i <= s",
+		"s == \"fred\"",
+		"s != i",
+		"f > 2 && b",
+		"!b || i >= 3",
+		"s + 1",
+		"missing + i",
+		"roundto(f, 1) == roundto(s, 1)",
+		"[]lit{7,9,2}[1] * i",
+		"\"Hello world\"[6] == s",
+	}
+	funcs := map[string]CallFun{"roundto": roundTo}
+	for _, c := range cases {
+		expr := MustNew(c, funcs)
+		got := expr.EvalColumns(cols)
+		if got.Len() != cols.Len() {
+			t.Fatalf("EvalColumns in: %s, Len: %d, want: %d", c, got.Len(), cols.Len())
+		}
+		for i := range ints {
+			vars := map[string]*dlit.Literal{
+				"i": dlit.MustNew(ints[i]),
+				"f": dlit.MustNew(floats[i]),
+				"s": dlit.NewString(strs[i]),
+				"b": dlit.MustNew(bools[i]),
+			}
+			want := expr.Eval(vars)
+			if got.Literal(i).String() != want.String() {
+				t.Errorf("EvalColumns in: %s, row: %d, got: %s, want: %s",
+					c, i, got.Literal(i), want)
+			}
+			if got.Valid(i) != (want.Err() == nil) {
+				t.Errorf("EvalColumns in: %s, row: %d, Valid: %t, want err: %v",
+					c, i, got.Valid(i), want.Err())
+			}
+			if (got.Err(i) == nil) != (want.Err() == nil) ||
+				got.Err(i) != nil && got.Err(i).Error() != want.Err().Error() {
+				t.Errorf("EvalColumns in: %s, row: %d, Err: %v, want: %v",
+					c, i, got.Err(i), want.Err())
+			}
+		}
+	}
+}
+
+func TestEvalColumns_limits(t *testing.T) {
+	cols := NewColumns(3)
+	if err := cols.AddInt64("x", []int64{1, 2, 3}); err != nil {
+		t.Fatalf("AddInt64: %s", err)
+	}
+	if err := cols.AddString("s", []string{"c", "cc", "ccc"}); err != nil {
+		t.Fatalf("AddString: %s", err)
+	}
+	cases := []struct {
+		in     string
+		limits Limits
+	}{
+		{in: "x + 1 > 2", limits: Limits{MaxNodes: 4}},
+		{in: "x + 1 > 2", limits: Limits{MaxNodes: 5}},
+		{in: "roundto(x, 1) + roundto(x, 2)", limits: Limits{MaxCalls: 1}},
+		{in: "repeat(s, x)", limits: Limits{MaxStringLen: 4}},
+	}
+	funcs := map[string]CallFun{"roundto": roundTo, "repeat": repeat}
+	for _, c := range cases {
+		expr := MustNew(c.in, funcs, EvalLimits(c.limits))
+		got := expr.EvalColumns(cols)
+		for i, x := range []int64{1, 2, 3} {
+			vars := map[string]*dlit.Literal{
+				"x": dlit.MustNew(x),
+				"s": dlit.NewString(strings.Repeat("c", i+1)),
+			}
+			want := expr.Eval(vars)
+			if got.Literal(i).String() != want.String() {
+				t.Errorf("EvalColumns in: %s, limits: %v, row: %d, got: %s, want: %s",
+					c.in, c.limits, i, got.Literal(i), want)
+			}
+		}
+	}
+}
+
+func TestEvalColumns_validity(t *testing.T) {
+	n := 130
+	xs := make([]int64, n)
+	for i := range xs {
+		xs[i] = int64(i % 3)
+	}
+	cols := NewColumns(n)
+	if err := cols.AddInt64("x", xs); err != nil {
+		t.Fatalf("AddInt64: %s", err)
+	}
+	got := MustNew("6 / x", map[string]CallFun{}).EvalColumns(cols)
+	validity := got.Validity()
+	if len(validity) != 3 {
+		t.Fatalf("Validity - len: %d, want: 3", len(validity))
+	}
+	for i, x := range xs {
+		bit := validity[i/64]&(1<<uint(i%64)) != 0
+		if bit != (x != 0) {
+			t.Errorf("Validity - row: %d, bit: %t, want: %t", i, bit, x != 0)
+		}
+		if v, isInt := got.Int(i); x != 0 && (!isInt || v != 6/x) {
+			t.Errorf("Int(%d) - got: %d, %t, want: %d", i, v, isInt, 6/x)
+		}
+	}
+}
+
+func TestColumnsAdd_errors(t *testing.T) {
+	cols := NewColumns(3)
+	err := cols.AddFloat64("x", []float64{1, 2})
+	wantErr := ColumnLengthError{Name: "x", Len: 2, Expect: 3}
+	if err != wantErr {
+		t.Errorf("AddFloat64 - err: %v, want: %v", err, wantErr)
+	}
+}
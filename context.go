@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"context"
+	"github.com/lawrencewoodman/dlit"
+)
+
+// CallFunContext is a function that can be called by an expression and
+// which is passed the context of the evaluation so that it can stop
+// early if the context is done.  If the expression isn't evaluated with
+// a context then context.Background() is passed.
+type CallFunContext func(context.Context, []*dlit.Literal) (*dlit.Literal, error)
+
+// ContextFuncs returns an Option to add functions that take a context.
+// If a function has the same name as one in callFuncs this one is used.
+func ContextFuncs(fns map[string]CallFunContext) Option {
+	return func(o *options) {
+		o.ctxCallFuncs = fns
+	}
+}
+
+// EvalContext evaluates the expression in the same way as Eval, but
+// checks ctx before each node is evaluated and passes it to any
+// CallFunContext functions.  If ctx is done, the error in the returned
+// Literal will wrap a CanceledError.  The expression's Limits are
+// applied as well.
+func (expr *Expr) EvalContext(
+	ctx context.Context,
+	vars map[string]*dlit.Literal,
+) *dlit.Literal {
+	return expr.eval(vars, expr.newEvalState(ctx, expr.Limits))
+}
+
+// EvalBoolContext evaluates the expression in the same way as EvalBool,
+// but checks ctx in the same way as EvalContext
+func (expr *Expr) EvalBoolContext(
+	ctx context.Context,
+	vars map[string]*dlit.Literal,
+) (bool, error) {
+	return expr.evalBool(vars, expr.newEvalState(ctx, expr.Limits))
+}
+
+// EvalContextWithLimits evaluates the expression in the same way as
+// EvalContext but uses limits instead of the expression's Limits
+func (expr *Expr) EvalContextWithLimits(
+	ctx context.Context,
+	vars map[string]*dlit.Literal,
+	limits Limits,
+) *dlit.Literal {
+	return expr.eval(vars, expr.newEvalState(ctx, limits))
+}
+
+// EvalBoolContextWithLimits evaluates the expression in the same way as
+// EvalBoolContext but uses limits instead of the expression's Limits
+func (expr *Expr) EvalBoolContextWithLimits(
+	ctx context.Context,
+	vars map[string]*dlit.Literal,
+	limits Limits,
+) (bool, error) {
+	return expr.evalBool(vars, expr.newEvalState(ctx, limits))
+}
@@ -0,0 +1,149 @@
+package dexpr
+
+import (
+	"context"
+	"errors"
+	"github.com/lawrencewoodman/dlit"
+	"testing"
+	"time"
+)
+
+func TestEvalContext(t *testing.T) {
+	cases := []struct {
+		in   string
+		want *dlit.Literal
+	}{
+		{"a * 2 + lookup(b)", dlit.MustNew(15)},
+		{"roundto(lookup(c), 1)", dlit.MustNew(2.5)},
+		{"lookup(a) > 3 && b == 7", dlit.MustNew(true)},
+	}
+	vars := map[string]*dlit.Literal{
+		"a": dlit.MustNew(4),
+		"b": dlit.MustNew(7),
+		"c": dlit.MustNew(2.46),
+	}
+	funcs := map[string]CallFun{"roundto": roundTo}
+	ctxFuncs := map[string]CallFunContext{"lookup": ctxLookup}
+	for _, c := range cases {
+		expr, err := New(c.in, funcs, ContextFuncs(ctxFuncs))
+		if err != nil {
+			t.Fatalf("New(%s) err: %s", c.in, err)
+		}
+		got := expr.EvalContext(context.Background(), vars)
+		if got.String() != c.want.String() {
+			t.Errorf("EvalContext in: %s, got: %s, want: %s", c.in, got, c.want)
+		}
+		// Without a context the functions should be passed a background one
+		got = expr.Eval(vars)
+		if got.String() != c.want.String() {
+			t.Errorf("Eval in: %s, got: %s, want: %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestEvalContext_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	vars := map[string]*dlit.Literal{"a": dlit.MustNew(4)}
+	expr := MustNew("a + 1 > 2", map[string]CallFun{})
+	got := expr.EvalContext(ctx, vars)
+	err := got.Err()
+	wantErr := InvalidExprError{"a + 1 > 2", CanceledError{context.Canceled}}
+	if err != wantErr {
+		t.Errorf("EvalContext - err: %v, want: %v", err, wantErr)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("EvalContext - errors.Is(%v, context.Canceled) is false", err)
+	}
+	_, err = expr.EvalBoolContext(ctx, vars)
+	if err != wantErr {
+		t.Errorf("EvalBoolContext - err: %v, want: %v", err, wantErr)
+	}
+}
+
+func TestEvalBoolContext_deadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	ctxFuncs := map[string]CallFunContext{"slow": ctxSlow}
+	expr := MustNew("slow(1) == 1 && a > 2", map[string]CallFun{},
+		ContextFuncs(ctxFuncs),
+	)
+	vars := map[string]*dlit.Literal{"a": dlit.MustNew(4)}
+	got, err := expr.EvalBoolContext(ctx, vars)
+	if got {
+		t.Errorf("EvalBoolContext - got: %t, want: false", got)
+	}
+	var cerr CanceledError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("EvalBoolContext - err: %v, want a CanceledError", err)
+	}
+	if cerr.Err != context.DeadlineExceeded {
+		t.Errorf("EvalBoolContext - err: %v, want: %v",
+			cerr.Err, context.DeadlineExceeded)
+	}
+}
+
+func TestEvalContext_limits(t *testing.T) {
+	in := "a + 1 > 2"
+	vars := map[string]*dlit.Literal{"a": dlit.MustNew(4)}
+	limitErr := InvalidExprError{in, LimitError{Limit: LimitNodes, Max: 3}}
+	expr := MustNew(in, map[string]CallFun{}, EvalLimits(Limits{MaxNodes: 3}))
+	if err := expr.EvalContext(context.Background(), vars).Err(); err != limitErr {
+		t.Errorf("EvalContext - err: %v, want: %v", err, limitErr)
+	}
+	if _, err := expr.EvalBoolContext(context.Background(), vars); err != limitErr {
+		t.Errorf("EvalBoolContext - err: %v, want: %v", err, limitErr)
+	}
+
+	expr = MustNew(in, map[string]CallFun{})
+	limits := Limits{MaxNodes: 3}
+	got := expr.EvalContextWithLimits(context.Background(), vars, limits)
+	if err := got.Err(); err != limitErr {
+		t.Errorf("EvalContextWithLimits - err: %v, want: %v", err, limitErr)
+	}
+	isTrue, err := expr.EvalBoolContextWithLimits(
+		context.Background(), vars, Limits{MaxNodes: 5},
+	)
+	if err != nil || !isTrue {
+		t.Errorf("EvalBoolContextWithLimits - got: %t, err: %v, want: true",
+			isTrue, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	canceledErr := InvalidExprError{in, CanceledError{context.Canceled}}
+	_, err = expr.EvalBoolContextWithLimits(ctx, vars, Limits{MaxNodes: 5})
+	if err != canceledErr {
+		t.Errorf("EvalBoolContextWithLimits - err: %v, want: %v", err, canceledErr)
+	}
+}
+
+/**********************************
+ *    Helper functions
+ **********************************/
+func ctxLookup(
+	ctx context.Context,
+	args []*dlit.Literal,
+) (*dlit.Literal, error) {
+	if err := ctx.Err(); err != nil {
+		return dlit.MustNew(err), err
+	}
+	if len(args) != 1 {
+		err := errors.New("wrong number of arguments")
+		return dlit.MustNew(err), err
+	}
+	return args[0], nil
+}
+
+// ctxSlow waits until the context is done
+func ctxSlow(
+	ctx context.Context,
+	args []*dlit.Literal,
+) (*dlit.Literal, error) {
+	select {
+	case <-ctx.Done():
+		return dlit.MustNew(ctx.Err()), ctx.Err()
+	case <-time.After(10 * time.Second):
+		return args[0], nil
+	}
+}
@@ -0,0 +1,328 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+	"sync"
+)
+
+// Coverage records which conditions of expressions have been true and
+// which have been false over a number of evaluations.  A condition is
+// each operand of && and || and each comparison.  A condition is
+// covered once it has been both true and false.  Coverage is safe to
+// use from several goroutines.
+type Coverage struct {
+	mu    sync.Mutex
+	exprs []*exprCoverage
+}
+
+// exprCoverage is the coverage of one expression
+type exprCoverage struct {
+	expr  string
+	evals int
+	conds []*Condition
+}
+
+// Condition is a condition of an expression and the number of times
+// that it has evaluated to each outcome
+type Condition struct {
+	// Expr is the source of the expression that the condition is in
+	Expr  string
+	Node  Node
+	True  int
+	False int
+	// Errors is the number of times that the condition evaluated to an
+	// error or a value that isn't a bool
+	Errors int
+}
+
+// NewCoverage returns an empty Coverage to pass to CollectCoverage
+func NewCoverage() *Coverage {
+	return &Coverage{}
+}
+
+// CollectCoverage returns an Option to record the outcome of each
+// condition of the expression in c whenever it is evaluated.  c may
+// collect the coverage of several expressions, such as the rules of a
+// RuleSet, and each expression compiled with it is reported separately,
+// including those returned by Partial and Simplify as they are compiled
+// with the same Options.  Conditions that can't be evaluated, such as
+// those in the elements of a list that aren't indexed, aren't included.
+func CollectCoverage(c *Coverage) Option {
+	return func(o *options) {
+		o.coverage = c
+	}
+}
+
+// compile compiles node, the syntax tree of the expression being
+// compiled by comp, again so that it records the outcome of each
+// condition of root, the Node converted from node, in c
+func (c *Coverage) compile(comp *compiler, node ast.Expr, root Node) enode {
+	ec := &exprCoverage{expr: comp.src}
+	conds := []*Condition{}
+	comp.conds = map[Node]*Condition{}
+	addConds(root, token.ILLEGAL, func(n Node) {
+		cond := &Condition{Expr: comp.src, Node: n}
+		conds = append(conds, cond)
+		comp.conds[n] = cond
+	})
+	comp.converted = map[ast.Node]Node{}
+	addConverted(comp.converted, node, root)
+	comp.cover = c
+	comp.nodes = 0
+	en := compile(node, comp)
+
+	reached := map[*Condition]bool{}
+	reachedConds(en, reached)
+	for _, cond := range conds {
+		if reached[cond] {
+			ec.conds = append(ec.conds, cond)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.exprs = append(c.exprs, ec)
+	return enCovered{en: en, cover: c, expr: ec}
+}
+
+// addConds calls add for each condition in n, whose parent's operator
+// is op
+func addConds(n Node, op token.Token, add func(Node)) {
+	n = unparenNode(n)
+	bn, isBinary := n.(*BinaryNode)
+	isChain := isBinary && (bn.Op == token.LAND || bn.Op == token.LOR)
+	// Only the operands of a chain of the same operator are conditions
+	isOperand := (op == token.LAND || op == token.LOR) &&
+		!(isChain && bn.Op == op)
+	if isOperand || (isBinary && isComparisonOp(bn.Op)) {
+		add(n)
+	}
+	switch x := n.(type) {
+	case *UnaryNode:
+		addConds(x.X, x.Op, add)
+	case *BinaryNode:
+		addConds(x.X, x.Op, add)
+		addConds(x.Y, x.Op, add)
+	case *CallNode:
+		for _, arg := range x.Args {
+			addConds(arg, token.ILLEGAL, add)
+		}
+	case *ListNode:
+		for _, elt := range x.Elts {
+			addConds(elt, token.ILLEGAL, add)
+		}
+	case *IndexNode:
+		addConds(x.X, token.ILLEGAL, add)
+	}
+}
+
+// reachedConds adds the conditions that are recorded when evaluating en
+// to reached.  Those in the elements of a list aren't reached unless
+// the element has been selected by an index.
+func reachedConds(en enode, reached map[*Condition]bool) {
+	switch x := en.(type) {
+	case enCond:
+		reached[x.cond] = true
+		reachedConds(x.en, reached)
+	case enBinary:
+		reachedConds(x.lh, reached)
+		reachedConds(x.rh, reached)
+	case enUnary:
+		reachedConds(x.rh, reached)
+	case enCall:
+		for _, arg := range x.args {
+			reachedConds(arg, reached)
+		}
+	}
+}
+
+func isComparisonOp(op token.Token) bool {
+	switch op {
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		return true
+	}
+	return false
+}
+
+// record records v as an outcome of cond
+func (c *Coverage) record(cond *Condition, v value) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b, isBool := v.Bool(); !isBool {
+		cond.Errors++
+	} else if b {
+		cond.True++
+	} else {
+		cond.False++
+	}
+}
+
+// evaluated records n evaluations of ec
+func (c *Coverage) evaluated(ec *exprCoverage, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ec.evals += n
+}
+
+// exprReport is a copy of the coverage of an expression
+type exprReport struct {
+	expr  string
+	evals int
+	conds []Condition
+}
+
+// reports returns a copy of the coverage of each expression in the
+// order that they were compiled
+func (c *Coverage) reports() []exprReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := make([]exprReport, len(c.exprs))
+	for i, ec := range c.exprs {
+		r[i] = exprReport{
+			expr:  ec.expr,
+			evals: ec.evals,
+			conds: make([]Condition, len(ec.conds)),
+		}
+		for j, cond := range ec.conds {
+			r[i].conds[j] = *cond
+		}
+	}
+	return r
+}
+
+// Evaluations returns the number of evaluations recorded for all of
+// the expressions
+func (c *Coverage) Evaluations() int {
+	n := 0
+	for _, er := range c.reports() {
+		n += er.evals
+	}
+	return n
+}
+
+// Conditions returns every condition in the order that they appear
+// in each expression
+func (c *Coverage) Conditions() []Condition {
+	r := []Condition{}
+	for _, er := range c.reports() {
+		r = append(r, er.conds...)
+	}
+	return r
+}
+
+// Uncovered returns the conditions that haven't been both true and
+// false in the order that they appear in each expression
+func (c *Coverage) Uncovered() []Condition {
+	r := []Condition{}
+	for _, cond := range c.Conditions() {
+		if !cond.Covered() {
+			r = append(r, cond)
+		}
+	}
+	return r
+}
+
+// Covered returns whether the condition has been both true and false
+func (cond Condition) Covered() bool {
+	return cond.True > 0 && cond.False > 0
+}
+
+// Missing returns the outcomes that the condition hasn't had
+func (cond Condition) Missing() []string {
+	r := []string{}
+	if cond.True == 0 {
+		r = append(r, "true")
+	}
+	if cond.False == 0 {
+		r = append(r, "false")
+	}
+	return r
+}
+
+// String returns a report for each expression with a summary line
+// followed by a line for each condition, giving its position, source
+// and outcomes
+func (c *Coverage) String() string {
+	var b strings.Builder
+	for _, er := range c.reports() {
+		er.write(&b)
+	}
+	return b.String()
+}
+
+func (er exprReport) write(b *strings.Builder) {
+	numCovered := 0
+	width := 0
+	for _, cond := range er.conds {
+		if cond.Covered() {
+			numCovered++
+		}
+		if w := len(Format(cond.Node)); w > width {
+			width = w
+		}
+	}
+	fmt.Fprintf(b, "%s: %d/%d conditions covered, %d evaluations\n",
+		er.expr, numCovered, len(er.conds), er.evals)
+	for _, cond := range er.conds {
+		fmt.Fprintf(b, "  %-7s %-*s  true: %d, false: %d, errors: %d",
+			cond.Node.Pos(), width, Format(cond.Node),
+			cond.True, cond.False, cond.Errors)
+		if !cond.Covered() {
+			fmt.Fprintf(b, "  never %s", strings.Join(cond.Missing(), " or "))
+		}
+		b.WriteString("\n")
+	}
+}
+
+// MarshalJSON returns the coverage as a JSON array with an object for
+// each expression
+func (c *Coverage) MarshalJSON() ([]byte, error) {
+	type jsonCondition struct {
+		Expr    string   `json:"expr"`
+		Offset  int      `json:"offset"`
+		Line    int      `json:"line"`
+		Column  int      `json:"column"`
+		True    int      `json:"true"`
+		False   int      `json:"false"`
+		Errors  int      `json:"errors"`
+		Covered bool     `json:"covered"`
+		Missing []string `json:"missing"`
+	}
+	type jsonCoverage struct {
+		Expr        string          `json:"expr"`
+		Evaluations int             `json:"evaluations"`
+		Conditions  []jsonCondition `json:"conditions"`
+	}
+	reports := c.reports()
+	jcs := make([]jsonCoverage, len(reports))
+	for i, er := range reports {
+		jcs[i] = jsonCoverage{
+			Expr:        er.expr,
+			Evaluations: er.evals,
+			Conditions:  make([]jsonCondition, len(er.conds)),
+		}
+		for j, cond := range er.conds {
+			pos := cond.Node.Pos()
+			jcs[i].Conditions[j] = jsonCondition{
+				Expr:    Format(cond.Node),
+				Offset:  pos.Offset,
+				Line:    pos.Line,
+				Column:  pos.Column,
+				True:    cond.True,
+				False:   cond.False,
+				Errors:  cond.Errors,
+				Covered: cond.Covered(),
+				Missing: cond.Missing(),
+			}
+		}
+	}
+	return marshalJSON(jcs)
+}
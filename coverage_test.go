@@ -0,0 +1,160 @@
+package dexpr
+
+import (
+	"encoding/json"
+	"github.com/lawrencewoodman/dlit"
+	"reflect"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	in := "a > 5 && (b == \"x\" || !c) && a < 100"
+	cov := NewCoverage()
+	expr := MustNew(in, map[string]CallFun{}, CollectCoverage(cov))
+	rows := []struct {
+		a    int64
+		b    string
+		c    bool
+		want bool
+	}{
+		{a: 7, b: "x", c: true, want: true},
+		{a: 3, b: "y", c: true, want: false},
+		{a: 7, b: "y", c: false, want: true},
+	}
+	for _, r := range rows {
+		vars := map[string]*dlit.Literal{
+			"a": dlit.MustNew(r.a),
+			"b": dlit.NewString(r.b),
+			"c": dlit.MustNew(r.c),
+		}
+		got, err := expr.EvalBool(vars)
+		if err != nil || got != r.want {
+			t.Errorf("EvalBool(%v) got: %t, err: %v, want: %t", r, got, err, r.want)
+		}
+	}
+	l := expr.Eval(map[string]*dlit.Literal{"a": dlit.MustNew(7)})
+	if l.Err() == nil {
+		t.Errorf("Eval with missing vars, err: nil")
+	}
+
+	type result struct {
+		expr                 string
+		trueN, falseN, errsN int
+	}
+	want := []result{
+		{"a > 5", 3, 1, 0},
+		{"b == \"x\" || !c", 2, 1, 1},
+		{"b == \"x\"", 1, 2, 1},
+		{"!c", 1, 2, 1},
+		{"a < 100", 4, 0, 0},
+	}
+	got := []result{}
+	for _, cond := range cov.Conditions() {
+		got = append(got, result{
+			Format(cond.Node), cond.True, cond.False, cond.Errors,
+		})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Conditions got: %v, want: %v", got, want)
+	}
+	uncovered := cov.Uncovered()
+	if len(uncovered) != 1 || Format(uncovered[0].Node) != "a < 100" {
+		t.Errorf("Uncovered got: %v, want: a < 100", uncovered)
+	}
+
+	wantReport := in + ": 4/5 conditions covered, 4 evaluations\n" +
+		"  1:1     a > 5           true: 3, false: 1, errors: 0\n" +
+		"  1:11    b == \"x\" || !c  true: 2, false: 1, errors: 1\n" +
+		"  1:11    b == \"x\"        true: 1, false: 2, errors: 1\n" +
+		"  1:23    !c              true: 1, false: 2, errors: 1\n" +
+		"  1:30    a < 100         true: 4, false: 0, errors: 0" +
+		"  never false\n"
+	if report := cov.String(); report != wantReport {
+		t.Errorf("String got:\n%s\nwant:\n%s", report, wantReport)
+	}
+
+	b, err := json.Marshal(cov)
+	if err != nil {
+		t.Fatalf("json.Marshal err: %s", err)
+	}
+	var jcs []struct {
+		Evaluations int
+		Conditions  []struct {
+			Expr    string
+			Line    int
+			Column  int
+			Covered bool
+			Missing []string
+		}
+	}
+	if err := json.Unmarshal(b, &jcs); err != nil || len(jcs) != 1 {
+		t.Fatalf("json.Unmarshal got: %v, err: %v", jcs, err)
+	}
+	jc := jcs[0]
+	last := jc.Conditions[len(jc.Conditions)-1]
+	if jc.Evaluations != 4 || len(jc.Conditions) != 5 ||
+		last.Expr != "a < 100" || last.Column != 30 || last.Covered ||
+		!reflect.DeepEqual(last.Missing, []string{"false"}) {
+		t.Errorf("json.Marshal got: %s", b)
+	}
+}
+
+func TestNewCoverage_conditions(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{in: "a", want: []string{}},
+		{in: "a + 1 > 5", want: []string{"a + 1 > 5"}},
+		{in: "a && b && c", want: []string{"a", "b", "c"}},
+		{in: "a && (b && c)", want: []string{"a", "b", "c"}},
+		{in: "a || b && c", want: []string{"a", "b && c", "b", "c"}},
+		{in: "f(a > 1) == x", want: []string{"f(a > 1) == x", "a > 1"}},
+		{in: "[]lit{a > 1, b < 2}[1] && c",
+			want: []string{"[]lit{a > 1, b < 2}[1]", "b < 2", "c"},
+		},
+		{in: "[]lit{[]lit{a > 1}, b < 2}[0][0]", want: []string{"a > 1"}},
+		{in: "[]lit{a > 1, b < 2} == x", want: []string{"[]lit{a > 1, b < 2} == x"}},
+	}
+	for _, c := range cases {
+		cov := NewCoverage()
+		MustNew(c.in, map[string]CallFun{}, CollectCoverage(cov))
+		got := []string{}
+		for _, cond := range cov.Conditions() {
+			got = append(got, Format(cond.Node))
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("CollectCoverage(%s) conditions: %v, want: %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestCoverage_exprs(t *testing.T) {
+	cov := NewCoverage()
+	exprA := MustNew("a > 1 || b", map[string]CallFun{}, CollectCoverage(cov))
+	exprB := MustNew("a == 3", map[string]CallFun{}, CollectCoverage(cov))
+	rows := []map[string]*dlit.Literal{
+		{"a": dlit.MustNew(3), "b": dlit.MustNew(false)},
+		{"a": dlit.MustNew(0), "b": dlit.MustNew(true)},
+	}
+	for _, vars := range rows {
+		if _, err := exprA.EvalBool(vars); err != nil {
+			t.Fatalf("EvalBool err: %s", err)
+		}
+	}
+	cols := NewColumns(2)
+	cols.AddInt64("a", []int64{3, 4})
+	exprB.EvalColumns(cols)
+
+	want := "a > 1 || b: 2/2 conditions covered, 2 evaluations\n" +
+		"  1:1     a > 1  true: 1, false: 1, errors: 0\n" +
+		"  1:10    b      true: 1, false: 1, errors: 0\n" +
+		"a == 3: 1/1 conditions covered, 2 evaluations\n" +
+		"  1:1     a == 3  true: 1, false: 1, errors: 0\n"
+	if got := cov.String(); got != want {
+		t.Errorf("String got:\n%s\nwant:\n%s", got, want)
+	}
+	if n := cov.Evaluations(); n != 4 {
+		t.Errorf("Evaluations got: %d, want: 4", n)
+	}
+}
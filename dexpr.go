@@ -9,7 +9,6 @@
 package dexpr
 
 import (
-	"fmt"
 	"github.com/lawrencewoodman/dlit"
 	"go/ast"
 	"go/token"
@@ -18,26 +17,117 @@ import (
 
 type Expr struct {
 	Expr string
-	Node enode
+	// Node is the root of the syntax tree of the expression
+	Node Node
+	// Limits restricts the resources used each time Expr is evaluated
+	Limits    Limits
+	en        enode
+	funcs     *funcs
+	callFuncs map[string]CallFun
+	opts      []Option
+	traced    *traced
 }
 
 type CallFun func([]*dlit.Literal) (*dlit.Literal, error)
 
-func New(expr string, callFuncs map[string]CallFun) (*Expr, error) {
-	node, err := parseExpr(expr)
-	if err != nil {
+// An Option changes how New compiles an expression
+type Option func(*options)
+
+type options struct {
+	ctxCallFuncs  map[string]CallFunContext
+	limits        Limits
+	compileLimits CompileLimits
+	dialect       *Dialect
+	coverage      *Coverage
+	boolVars      bool
+}
+
+// funcs holds the functions that an expression can call
+type funcs struct {
+	callFuncs    map[string]CallFun
+	ctxCallFuncs map[string]CallFunContext
+}
+
+// compiler holds what is needed while compiling an expression
+type compiler struct {
+	src      string
+	funcs    *funcs
+	eltStore *eltStore
+	limits   CompileLimits
+	dialect  *Dialect
+	nodes    int
+	// converted is the Node that each go/ast node was converted to if
+	// the enode tree is being compiled for Explain or for coverage
+	converted map[ast.Node]Node
+	// trace is whether each node records its Trace for Explain
+	trace bool
+	// conds are the conditions to record the outcomes of in cover
+	conds map[Node]*Condition
+	cover *Coverage
+}
+
+func New(
+	expr string,
+	callFuncs map[string]CallFun,
+	opts ...Option,
+) (*Expr, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	maxSourceLen := o.compileLimits.MaxSourceLen
+	if maxSourceLen > 0 && len(expr) > maxSourceLen {
+		return &Expr{}, InvalidExprError{
+			expr,
+			CompileLimitError{Limit: LimitSourceLen, Max: maxSourceLen},
+		}
+	}
+	maxDepth := o.compileLimits.maxDepth()
+	node, err := parseExpr(expr, maxDepth)
+	if err == errTooDeep {
+		return &Expr{}, InvalidExprError{
+			expr,
+			CompileLimitError{Limit: LimitDepth, Max: maxDepth},
+		}
+	} else if err != nil {
 		return &Expr{}, InvalidExprError{expr, ErrSyntax}
 	}
 
-	en := compile(node, callFuncs)
+	c := &compiler{
+		src:     expr,
+		funcs:   &funcs{callFuncs: callFuncs, ctxCallFuncs: o.ctxCallFuncs},
+		limits:  o.compileLimits,
+		dialect: o.dialect,
+	}
+	en := compile(node, c)
 	if ee, ok := en.(enErr); ok {
 		return &Expr{}, InvalidExprError{expr, ee.Err()}
 	}
-	return &Expr{Expr: expr, Node: en}, nil
+	root, err := toNode(newLineTable(expr), node)
+	if err != nil {
+		return &Expr{}, InvalidExprError{expr, ErrSyntax}
+	}
+	if o.coverage != nil {
+		en = o.coverage.compile(c, node, root)
+	}
+	return &Expr{
+		Expr:      expr,
+		Node:      root,
+		Limits:    o.limits,
+		en:        en,
+		funcs:     c.funcs,
+		callFuncs: callFuncs,
+		opts:      opts,
+		traced:    &traced{},
+	}, nil
 }
 
-func MustNew(expr string, callFuncs map[string]CallFun) *Expr {
-	e, err := New(expr, callFuncs)
+func MustNew(
+	expr string,
+	callFuncs map[string]CallFun,
+	opts ...Option,
+) *Expr {
+	e, err := New(expr, callFuncs, opts...)
 	if err != nil {
 		panic(err.Error())
 	}
@@ -73,20 +163,39 @@ func EvalBool(
 	return e.EvalBool(vars)
 }
 
+// Eval evaluates the expression with the supplied vars.  Intermediate
+// results are kept unboxed so only the final result becomes a Literal.
 func (expr *Expr) Eval(vars map[string]*dlit.Literal) *dlit.Literal {
-	l := expr.Node.Eval(vars)
-	if err := l.Err(); err != nil {
+	return expr.eval(vars, expr.newEvalState(nil, expr.Limits))
+}
+
+// EvalBool evaluates the expression with the supplied vars and returns
+// the result as a bool.  Expressions that only use numbers and bools
+// are evaluated without any allocations.
+func (expr *Expr) EvalBool(vars map[string]*dlit.Literal) (bool, error) {
+	return expr.evalBool(vars, expr.newEvalState(nil, expr.Limits))
+}
+
+func (expr *Expr) eval(
+	vars map[string]*dlit.Literal,
+	es *evalState,
+) *dlit.Literal {
+	v := expr.en.evalValue(vars, es)
+	if err := v.Err(); err != nil {
 		return dlit.MustNew(InvalidExprError{expr.Expr, err})
 	}
-	return l
+	return v.Literal()
 }
 
-func (expr *Expr) EvalBool(vars map[string]*dlit.Literal) (bool, error) {
-	l := expr.Eval(vars)
-	if b, isBool := l.Bool(); isBool {
+func (expr *Expr) evalBool(
+	vars map[string]*dlit.Literal,
+	es *evalState,
+) (bool, error) {
+	v := expr.en.evalValue(vars, es)
+	if b, isBool := v.Bool(); isBool {
 		return b, nil
-	} else if err := l.Err(); err != nil {
-		return false, err
+	} else if err := v.Err(); err != nil {
+		return false, InvalidExprError{expr.Expr, err}
 	}
 	return false, InvalidExprError{expr.Expr, ErrIncompatibleTypes}
 }
@@ -100,11 +209,11 @@ var kinds = map[string]*dlit.Literal{
 	"lit": dlit.NewString("lit"),
 }
 
-func compile(node ast.Node, callFuncs map[string]CallFun) enode {
+func compile(node ast.Node, c *compiler) enode {
 	var en enode
 	inspector := func(n ast.Node) bool {
-		eltStore := newEltStore()
-		en = nodeToenode(callFuncs, eltStore, n)
+		c.eltStore = newEltStore()
+		en = nodeToenode(c, n)
 		return false
 	}
 	ast.Inspect(node, inspector)
@@ -115,17 +224,51 @@ func compile(node ast.Node, callFuncs map[string]CallFun) enode {
 }
 
 func nodeToenode(
-	callFuncs map[string]CallFun,
-	eltStore *eltStore,
+	c *compiler,
 	n ast.Node,
 ) enode {
+	en := astToenode(c, n)
+	node, ok := c.converted[n]
+	if _, isErr := en.(enErr); !ok || isErr {
+		return en
+	}
+	if cond, ok := c.conds[node]; ok {
+		en = enCond{en: en, cover: c.cover, cond: cond}
+	}
+	if c.trace {
+		en = enTrace{en: en, node: node}
+	}
+	return en
+}
+
+func astToenode(
+	c *compiler,
+	n ast.Node,
+) enode {
+	c.nodes++
+	if maxNodes := c.limits.maxNodes(); maxNodes > 0 && c.nodes > maxNodes {
+		return enErr{
+			err: CompileLimitError{Limit: LimitASTNodes, Max: maxNodes},
+		}
+	}
+	if ee, ok := c.checkDialect(n); !ok {
+		return ee
+	}
 	switch x := n.(type) {
 	case *ast.BasicLit:
+		if c.limits.MaxLiteralLen > 0 && len(x.Value) > c.limits.MaxLiteralLen {
+			return enErr{
+				err: CompileLimitError{
+					Limit: LimitLiteralLen,
+					Max:   c.limits.MaxLiteralLen,
+				},
+			}
+		}
 		switch x.Kind {
 		case token.INT:
 			fallthrough
 		case token.FLOAT:
-			return enLit{val: dlit.NewString(x.Value)}
+			return numLitToenode(x.Value)
 		case token.CHAR:
 			fallthrough
 		case token.STRING:
@@ -133,51 +276,76 @@ func nodeToenode(
 			if err != nil {
 				return enErr{err: ErrSyntax}
 			}
-			return enLit{val: dlit.NewString(uc)}
+			return newEnLit(dlit.NewString(uc))
 		}
 	case *ast.Ident:
 		return enVar(x.Name)
 	case *ast.ParenExpr:
-		return nodeToenode(callFuncs, eltStore, x.X)
+		return nodeToenode(c, x.X)
 	case *ast.BinaryExpr:
-		return binaryExprToenode(callFuncs, eltStore, x)
+		return binaryExprToenode(c, x)
 	case *ast.UnaryExpr:
-		return unaryExprToenode(callFuncs, eltStore, x)
+		return unaryExprToenode(c, x)
 	case *ast.CallExpr:
-		args := exprSliceToenodes(callFuncs, eltStore, x.Args)
-		return enFunc{
-			fn: func(vars map[string]*dlit.Literal) *dlit.Literal {
-				lits := eNodesToDLiterals(vars, args)
-				return callFun(callFuncs, x.Fun, lits)
-			},
+		if _, ok := x.Fun.(*ast.Ident); !ok {
+			return enErr{err: ErrSyntax}
 		}
+		args := exprSliceToenodes(c, x.Args)
+		if ee, ok := firstenErr(args); ok {
+			return ee
+		}
+		id := x.Fun.(*ast.Ident)
+		return enCall{funcs: c.funcs, name: id.Name, args: args}
 	case *ast.CompositeLit:
-		kindNode := nodeToenode(callFuncs, eltStore, x.Type)
+		kindNode := nodeToenode(c, x.Type)
 		kind := kindNode.Eval(kinds)
 		if kind.String() != "lit" {
 			return enErr{err: ErrInvalidCompositeType}
 		}
-		elts := exprSliceToenodes(callFuncs, eltStore, x.Elts)
-		rNum := eltStore.Add(elts)
-		return enLit{val: dlit.MustNew(rNum)}
+		if c.limits.MaxElts > 0 && len(x.Elts) > c.limits.MaxElts {
+			return enErr{
+				err: CompileLimitError{Limit: LimitElts, Max: c.limits.MaxElts},
+			}
+		}
+		elts := exprSliceToenodes(c, x.Elts)
+		if ee, ok := firstenErr(elts); ok {
+			return ee
+		}
+		rNum := c.eltStore.Add(elts)
+		return newEnLit(dlit.MustNew(rNum))
 	case *ast.IndexExpr:
-		return indexExprToenode(callFuncs, eltStore, x)
+		return indexExprToenode(c, x)
 	case *ast.ArrayType:
-		return nodeToenode(callFuncs, eltStore, x.Elt)
+		return nodeToenode(c, x.Elt)
 	}
 	return enErr{err: ErrSyntax}
 }
 
+// numLitToenode returns an enLit for a number from the source.  Where the
+// number is written as dlit would write it, it is stored unboxed so that
+// it doesn't have to be converted from a string each time it is used.
+func numLitToenode(s string) enode {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if l := dlit.MustNew(i); l.String() == s {
+			return enLit{val: l, v: intValue(i)}
+		}
+	} else if f, err := strconv.ParseFloat(s, 64); err == nil {
+		if l := dlit.MustNew(f); l.String() == s {
+			return enLit{val: l, v: floatValue(f)}
+		}
+	}
+	return newEnLit(dlit.NewString(s))
+}
+
 func indexExprToenode(
-	callFuncs map[string]CallFun,
-	eltStore *eltStore,
+	c *compiler,
 	ie *ast.IndexExpr,
 ) enode {
 	var ii, ix int64
 	var isInt bool
 
-	indexX := nodeToenode(callFuncs, eltStore, ie.X)
-	indexIndex := nodeToenode(callFuncs, eltStore, ie.Index)
+	indexX := unwrap(nodeToenode(c, ie.X))
+	indexIndex := unwrap(nodeToenode(c, ie.Index))
 
 	switch xx := indexX.(type) {
 	case enErr:
@@ -195,13 +363,13 @@ func indexExprToenode(
 				if bl.Kind != token.STRING {
 					return enErr{err: ErrTypeNotIndexable}
 				}
-				return enLit{val: dlit.MustNew(string(xx.String()[ii]))}
+				return newEnLit(dlit.MustNew(string(xx.String()[ii])))
 			}
 			ix, isInt = xx.Int()
 			if !isInt {
 				return enErr{err: ErrSyntax}
 			}
-			elts := eltStore.Get(ix)
+			elts := c.eltStore.Get(ix)
 			if ii >= int64(len(elts)) {
 				return enErr{err: ErrInvalidIndex}
 			}
@@ -216,44 +384,60 @@ func indexExprToenode(
 }
 
 func exprSliceToenodes(
-	callFuncs map[string]CallFun,
-	eltStore *eltStore,
+	c *compiler,
 	callArgs []ast.Expr,
 ) []enode {
 	r := make([]enode, len(callArgs))
 	for i, arg := range callArgs {
-		r[i] = nodeToenode(callFuncs, eltStore, arg)
+		r[i] = nodeToenode(c, arg)
 	}
 	return r
 }
 
+// position returns the Position of pos within the expression
+func (c *compiler) position(pos token.Pos) Position {
+	return newPosition(c.src, posToOffset(pos))
+}
+
+// firstenErr returns the first enErr in ens if there is one
+func firstenErr(ens []enode) (enErr, bool) {
+	for _, en := range ens {
+		if ee, ok := en.(enErr); ok {
+			return ee, true
+		}
+	}
+	return enErr{}, false
+}
+
 func eNodesToDLiterals(
 	vars map[string]*dlit.Literal,
+	es *evalState,
 	ens []enode,
 ) []*dlit.Literal {
 	r := make([]*dlit.Literal, len(ens))
 	for i, en := range ens {
-		r[i] = en.Eval(vars)
+		r[i] = en.evalValue(vars, es).Literal()
 	}
 	return r
 }
 
 func callFun(
-	callFuncs map[string]CallFun,
-	name ast.Expr,
+	fs *funcs,
+	es *evalState,
+	name string,
 	args []*dlit.Literal,
 ) *dlit.Literal {
-	id, ok := name.(*ast.Ident)
-	if !ok {
-		panic(fmt.Errorf("can't get name as *ast.Ident: %s", name))
-	}
-	f, exists := callFuncs[id.Name]
-	if !exists {
-		return dlit.MustNew(FunctionNotExistError(id.Name))
+	var l *dlit.Literal
+	var err error
+	if f, exists := fs.ctxCallFuncs[name]; exists {
+		l, err = f(es.context(), args)
+	} else if f, exists := fs.callFuncs[name]; exists {
+		l, err = f(args)
+	} else {
+		return dlit.MustNew(FunctionNotExistError(name))
 	}
-	l, err := f(args)
 	if err != nil {
-		return dlit.MustNew(FunctionError{id.Name, err})
+		return dlit.MustNew(FunctionError{name, err})
 	}
 	return l
 }
@@ -854,6 +854,74 @@ func TestEvalBool_errors(t *testing.T) {
 	}
 }
 
+func TestEvalBool_allocs(t *testing.T) {
+	cases := []string{
+		"a * b + c > 10",
+		"a * b + c > 10.5",
+		"!(a < b) && c >= 2.5",
+		"-a + 3 == b || a / b < 1",
+		"(a - c) * 2.5 <= a * -c",
+	}
+	vars := map[string]*dlit.Literal{
+		"a": dlit.MustNew(4),
+		"b": dlit.MustNew(3),
+		"c": dlit.MustNew(2.5),
+	}
+	funcs := map[string]CallFun{}
+	for _, c := range cases {
+		dexpr, err := New(c, funcs)
+		if err != nil {
+			t.Fatalf("New(%s) err: %s", c, err)
+		}
+		if _, err := dexpr.EvalBool(vars); err != nil {
+			t.Fatalf("EvalBool(vars) in: %s, err: %s", c, err)
+		}
+		got := testing.AllocsPerRun(100, func() {
+			dexpr.EvalBool(vars)
+		})
+		if got != 0 {
+			t.Errorf("EvalBool(vars) in: %s, allocs: %v, want: 0", c, got)
+		}
+	}
+}
+
+func TestEval_allocs(t *testing.T) {
+	// Only the final result should need allocating
+	r := floatValue(5.2)
+	litAllocs := testing.AllocsPerRun(100, func() {
+		r.Literal()
+	})
+	cases := []struct {
+		in         string
+		wantAllocs float64
+	}{
+		{"a * b + c > 10", 0},
+		{"a < b && c >= 2.5", 0},
+		{"a", 0},
+		{"a * b + c", litAllocs},
+		{"(a - c) * 2.5 / b", litAllocs},
+	}
+	vars := map[string]*dlit.Literal{
+		"a": dlit.MustNew(4),
+		"b": dlit.MustNew(3),
+		"c": dlit.MustNew(2.5),
+	}
+	funcs := map[string]CallFun{}
+	for _, c := range cases {
+		dexpr, err := New(c.in, funcs)
+		if err != nil {
+			t.Fatalf("New(%s) err: %s", c.in, err)
+		}
+		got := testing.AllocsPerRun(100, func() {
+			dexpr.Eval(vars)
+		})
+		if got != c.wantAllocs {
+			t.Errorf("Eval(vars) in: %s, allocs: %v, want: %v",
+				c.in, got, c.wantAllocs)
+		}
+	}
+}
+
 /*************************
  *       Benchmarks
  *************************/
@@ -894,7 +962,7 @@ func BenchmarkEvalBool(b *testing.B) {
 				got, err := dexpr.EvalBool(vars)
 				b.StopTimer()
 				if err != nil {
-					b.Errorf("EvalBool: ", err)
+					b.Errorf("EvalBool: %s", err)
 				}
 				if got != bm.want {
 					b.Errorf("EvalBool - got: %v, want %v", got, bm.want)
@@ -0,0 +1,293 @@
+/*
+ * Test files of expressions and their expected results
+ *
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+// Package dexprtest reads and runs test files of expressions, the
+// variables to evaluate them with and the results expected.  A test
+// file is plain text with a case for each expression such as:
+//
+//	# Lines starting with # are comments
+//	expr price * quantity
+//	var price = 1.5
+//	var quantity = 4
+//	want 6
+//
+//	expr name + 1
+//	var name = "bob"
+//	error incompatible-types
+//
+// Each case starts with an expr line and may be followed by var lines
+// whose values are constant expressions, such as 5, -2.5, "bob" or
+// true.  The variables true and false are supplied to each case unless
+// it defines them itself.
+// It ends with either a want line giving the expected result as it
+// would be printed or an error line giving the kind of error expected.
+// Blank lines are ignored.
+package dexprtest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/lawrencewoodman/dlit"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Case is a test case
+type Case struct {
+	File string
+	Line int
+	Expr string
+	Vars map[string]*dlit.Literal
+	// Want is the result expected as a string if WantErr is ""
+	Want string
+	// WantErr is the kind of error expected
+	WantErr string
+}
+
+// ParseError indicates a problem with a test file
+type ParseError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// errorKinds are the kinds of error that can be given on an error line
+var errorKinds = map[string]func(error) bool{
+	"any": func(err error) bool { return true },
+	"syntax": func(err error) bool {
+		return errors.Is(err, dexpr.ErrSyntax)
+	},
+	"div-by-zero": func(err error) bool {
+		return errors.Is(err, dexpr.ErrDivByZero)
+	},
+	"incompatible-types": func(err error) bool {
+		return errors.Is(err, dexpr.ErrIncompatibleTypes)
+	},
+	"overflow": func(err error) bool {
+		return errors.Is(err, dexpr.ErrUnderflowOverflow)
+	},
+	"invalid-index": func(err error) bool {
+		return errors.Is(err, dexpr.ErrInvalidIndex)
+	},
+	"not-indexable": func(err error) bool {
+		return errors.Is(err, dexpr.ErrTypeNotIndexable)
+	},
+	"invalid-composite-type": func(err error) bool {
+		return errors.Is(err, dexpr.ErrInvalidCompositeType)
+	},
+	"var-not-exist": func(err error) bool {
+		var e dexpr.VarNotExistError
+		return errors.As(err, &e)
+	},
+	"func-not-exist": func(err error) bool {
+		var e dexpr.FunctionNotExistError
+		return errors.As(err, &e)
+	},
+	"func-error": func(err error) bool {
+		var e dexpr.FunctionError
+		return errors.As(err, &e)
+	},
+}
+
+// ErrorKinds returns the kinds of error that can be given on an error
+// line, sorted
+func ErrorKinds() []string {
+	kinds := make([]string, 0, len(errorKinds))
+	for k := range errorKinds {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// maxLineLen is the longest line that Parse will read
+const maxLineLen = 1024 * 1024
+
+// Parse reads the cases from a test file.  filename is used to identify
+// where each case came from.  A line can be up to 1MB long.
+func Parse(filename string, r io.Reader) ([]Case, error) {
+	cases := []Case{}
+	var c *Case
+	lineNum := 0
+	perr := func(msg string) error {
+		return ParseError{File: filename, Line: lineNum, Msg: msg}
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineLen)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keyword, rest := splitLine(line)
+		if keyword == "expr" {
+			if c != nil {
+				return nil, ParseError{
+					File: filename,
+					Line: c.Line,
+					Msg:  "case has no want or error line",
+				}
+			}
+			if rest == "" {
+				return nil, perr("expr line has no expression")
+			}
+			c = &Case{
+				File: filename,
+				Line: lineNum,
+				Expr: rest,
+				Vars: map[string]*dlit.Literal{},
+			}
+			continue
+		}
+		if c == nil {
+			return nil, perr(fmt.Sprintf("%s line isn't part of a case", keyword))
+		}
+		switch keyword {
+		case "var":
+			name, l, err := parseVar(rest)
+			if err != nil {
+				return nil, perr(err.Error())
+			}
+			if _, exists := c.Vars[name]; exists {
+				return nil, perr(fmt.Sprintf("variable already defined: %s", name))
+			}
+			c.Vars[name] = l
+		case "want":
+			c.Want = rest
+			cases = append(cases, *c)
+			c = nil
+		case "error":
+			if _, ok := errorKinds[rest]; !ok {
+				return nil, perr(fmt.Sprintf("unknown error kind: %s, want one of: %s",
+					rest, strings.Join(ErrorKinds(), ", ")))
+			}
+			c.WantErr = rest
+			cases = append(cases, *c)
+			c = nil
+		default:
+			return nil, perr(fmt.Sprintf("unknown line: %s", keyword))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		// The line that couldn't be read is the one after the last read
+		lineNum++
+		return nil, perr(err.Error())
+	}
+	if c != nil {
+		return nil, ParseError{
+			File: filename,
+			Line: c.Line,
+			Msg:  "case has no want or error line",
+		}
+	}
+	return cases, nil
+}
+
+// splitLine returns the keyword at the start of line and the rest of it
+func splitLine(line string) (string, string) {
+	i := strings.IndexAny(line, " \t")
+	if i < 0 {
+		return line, ""
+	}
+	return line[:i], strings.TrimSpace(line[i+1:])
+}
+
+// boolVars are the variables that are supplied for true and false
+var boolVars = map[string]*dlit.Literal{
+	"true":  dlit.MustNew(true),
+	"false": dlit.MustNew(false),
+}
+
+// parseVar parses name = value from a var line
+func parseVar(s string) (string, *dlit.Literal, error) {
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return "", nil, errors.New("expected: var name = value")
+	}
+	name := strings.TrimSpace(s[:i])
+	src := strings.TrimSpace(s[i+1:])
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return "", nil, fmt.Errorf("invalid variable name: %s", name)
+	}
+	expr, err := dexpr.New(src, map[string]dexpr.CallFun{})
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid value for %s: %s", name, err)
+	}
+	for _, v := range expr.VarNames() {
+		if _, isBool := boolVars[v]; !isBool {
+			return "", nil, fmt.Errorf("value for %s isn't a constant: %s", name, src)
+		}
+	}
+	l := expr.Eval(boolVars)
+	if err := l.Err(); err != nil {
+		return "", nil, fmt.Errorf("invalid value for %s: %s", name, err)
+	}
+	return name, l, nil
+}
+
+// Failure is a case whose result wasn't as expected
+type Failure struct {
+	Case Case
+	// Got is the result or the error prefixed with error:
+	Got string
+}
+
+func (f Failure) String() string {
+	want := f.Case.Want
+	if f.Case.WantErr != "" {
+		want = "error " + f.Case.WantErr
+	}
+	return fmt.Sprintf("%s:%d: expr %s\n  got:  %s\n  want: %s",
+		f.Case.File, f.Case.Line, f.Case.Expr, f.Got, want)
+}
+
+// Run evaluates each case using callFuncs and returns those whose
+// result wasn't as expected.  A result is compared with Want as a
+// string and an error is compared with the kind in WantErr.
+func Run(cases []Case, callFuncs map[string]dexpr.CallFun) []Failure {
+	failures := []Failure{}
+	for _, c := range cases {
+		var l *dlit.Literal
+		expr, err := dexpr.New(c.Expr, callFuncs)
+		if err == nil {
+			l = expr.Eval(caseVars(c))
+			err = l.Err()
+		}
+		if err != nil {
+			if c.WantErr == "" || !errorKinds[c.WantErr](err) {
+				failures = append(failures, Failure{Case: c, Got: "error: " + err.Error()})
+			}
+			continue
+		}
+		if c.WantErr != "" || l.String() != c.Want {
+			failures = append(failures, Failure{Case: c, Got: l.String()})
+		}
+	}
+	return failures
+}
+
+// caseVars returns the variables of c along with true and false unless
+// c defines them
+func caseVars(c Case) map[string]*dlit.Literal {
+	vars := make(map[string]*dlit.Literal, len(c.Vars)+len(boolVars))
+	for name, l := range boolVars {
+		vars[name] = l
+	}
+	for name, l := range c.Vars {
+		vars[name] = l
+	}
+	return vars
+}
@@ -0,0 +1,235 @@
+package dexprtest
+
+import (
+	"bufio"
+	"errors"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/lawrencewoodman/dlit"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testFile = `# Arithmetic
+expr price * quantity
+var price = 1.5
+var quantity = 4
+want 6
+
+expr name
+var name = "bob smith"
+want bob smith
+
+  expr 8 / zero
+  var zero = -0
+  error div-by-zero
+
+expr double(x)
+var x = 3
+want 6
+
+expr flag && x > 2 || false
+var flag = true
+var x = 3
+want true
+`
+
+func double(args []*dlit.Literal) (*dlit.Literal, error) {
+	if len(args) != 1 {
+		return nil, errors.New("wrong number of arguments")
+	}
+	i, ok := args[0].Int()
+	if !ok {
+		return nil, errors.New("not an int")
+	}
+	return dlit.MustNew(i * 2), nil
+}
+
+func TestParse(t *testing.T) {
+	cases, err := Parse("arith.txt", strings.NewReader(testFile))
+	if err != nil {
+		t.Fatalf("Parse err: %s", err)
+	}
+	want := []Case{
+		{File: "arith.txt",
+			Line: 2,
+			Expr: "price * quantity",
+			Vars: map[string]*dlit.Literal{
+				"price":    dlit.MustNew(1.5),
+				"quantity": dlit.MustNew(4),
+			},
+			Want: "6",
+		},
+		{File: "arith.txt",
+			Line: 7,
+			Expr: "name",
+			Vars: map[string]*dlit.Literal{"name": dlit.NewString("bob smith")},
+			Want: "bob smith",
+		},
+		{File: "arith.txt",
+			Line:    11,
+			Expr:    "8 / zero",
+			Vars:    map[string]*dlit.Literal{"zero": dlit.MustNew(0)},
+			WantErr: "div-by-zero",
+		},
+		{File: "arith.txt",
+			Line: 15,
+			Expr: "double(x)",
+			Vars: map[string]*dlit.Literal{"x": dlit.MustNew(3)},
+			Want: "6",
+		},
+		{File: "arith.txt",
+			Line: 19,
+			Expr: "flag && x > 2 || false",
+			Vars: map[string]*dlit.Literal{
+				"flag": dlit.MustNew(true),
+				"x":    dlit.MustNew(3),
+			},
+			Want: "true",
+		},
+	}
+	if len(cases) != len(want) {
+		t.Fatalf("Parse got %d cases, want: %d", len(cases), len(want))
+	}
+	for i, c := range cases {
+		w := want[i]
+		if c.File != w.File || c.Line != w.Line || c.Expr != w.Expr ||
+			c.Want != w.Want || c.WantErr != w.WantErr ||
+			len(c.Vars) != len(w.Vars) {
+			t.Errorf("Parse got: %v, want: %v", c, w)
+			continue
+		}
+		for name, l := range w.Vars {
+			if got, ok := c.Vars[name]; !ok || got.String() != l.String() {
+				t.Errorf("Parse got var %s: %v, want: %v", name, got, l)
+			}
+		}
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	cases := []struct {
+		src     string
+		wantErr error
+	}{
+		{src: "var a = 1\n",
+			wantErr: ParseError{"t.txt", 1, "var line isn't part of a case"},
+		},
+		{src: "expr a\nvar a = 1\n\n",
+			wantErr: ParseError{"t.txt", 1, "case has no want or error line"},
+		},
+		{src: "expr a\nexpr b\nwant 1\n",
+			wantErr: ParseError{"t.txt", 1, "case has no want or error line"},
+		},
+		{src: "expr\n",
+			wantErr: ParseError{"t.txt", 1, "expr line has no expression"},
+		},
+		{src: "expr a\nvar a 1\nwant 1\n",
+			wantErr: ParseError{"t.txt", 2, "expected: var name = value"},
+		},
+		{src: "expr a\nvar a = b\nwant 1\n",
+			wantErr: ParseError{"t.txt", 2, "value for a isn't a constant: b"},
+		},
+		{src: "expr a\nvar a = !true || b\nwant 1\n",
+			wantErr: ParseError{"t.txt", 2, "value for a isn't a constant: !true || b"},
+		},
+		{src: "expr a\nvar a = 1\nvar a = 2\nwant 1\n",
+			wantErr: ParseError{"t.txt", 3, "variable already defined: a"},
+		},
+		{src: "expr a\nvar a = 1 / 0\nwant 1\n",
+			wantErr: ParseError{"t.txt", 2,
+				"invalid value for a: invalid expression: 1 / 0 (divide by zero)"},
+		},
+		{src: "expr a\nerror oops\n",
+			wantErr: ParseError{"t.txt", 2,
+				"unknown error kind: oops, want one of: " +
+					strings.Join(ErrorKinds(), ", ")},
+		},
+		{src: "expr a\nwants 1\n",
+			wantErr: ParseError{"t.txt", 2, "unknown line: wants"},
+		},
+	}
+	for _, c := range cases {
+		_, err := Parse("t.txt", strings.NewReader(c.src))
+		if !reflect.DeepEqual(err, c.wantErr) {
+			t.Errorf("Parse(%q) err: %v, want: %v", c.src, err, c.wantErr)
+		}
+	}
+}
+
+func TestParse_longLines(t *testing.T) {
+	expr := "\"" + strings.Repeat("a", 100000) + "\" == x"
+	src := "expr " + expr + "\nvar x = \"a\"\nwant false\n"
+	cases, err := Parse("t.txt", strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Parse err: %s", err)
+	}
+	if len(cases) != 1 || cases[0].Expr != expr {
+		t.Errorf("Parse got: %d cases, want: 1 with the whole expression",
+			len(cases))
+	}
+
+	tooLong := "expr x\nvar x = \"" + strings.Repeat("a", maxLineLen) + "\"\n"
+	_, err = Parse("t.txt", strings.NewReader(tooLong))
+	wantErr := ParseError{"t.txt", 2, bufio.ErrTooLong.Error()}
+	if !reflect.DeepEqual(err, wantErr) {
+		t.Errorf("Parse err: %v, want: %v", err, wantErr)
+	}
+}
+
+func TestRun(t *testing.T) {
+	cases, err := Parse("arith.txt", strings.NewReader(testFile))
+	if err != nil {
+		t.Fatalf("Parse err: %s", err)
+	}
+	callFuncs := map[string]dexpr.CallFun{"double": double}
+	if failures := Run(cases, callFuncs); len(failures) != 0 {
+		t.Errorf("Run got failures: %v", failures)
+	}
+
+	src := `expr a + 1
+var a = 2
+want 4
+
+expr a + 1
+var a = "x"
+error div-by-zero
+
+expr a +
+error syntax
+
+expr nope(a)
+var a = 2
+error func-not-exist
+
+expr a + b
+var a = 2
+error var-not-exist
+
+expr double(a)
+var a = "x"
+error func-error
+
+expr 5 / a
+var a = 2
+error any
+`
+	cases, err = Parse("fail.txt", strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Parse err: %s", err)
+	}
+	got := []string{}
+	for _, f := range Run(cases, callFuncs) {
+		got = append(got, f.String())
+	}
+	want := []string{
+		"fail.txt:1: expr a + 1\n  got:  3\n  want: 4",
+		"fail.txt:5: expr a + 1\n" +
+			"  got:  error: invalid expression: a + 1 (incompatible types)\n" +
+			"  want: error div-by-zero",
+		"fail.txt:24: expr 5 / a\n  got:  2.5\n  want: error any",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Run got: %q, want: %q", got, want)
+	}
+}
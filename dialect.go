@@ -0,0 +1,114 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// Dialect restricts the language that New will accept, so that
+// different audiences can be given different subsets of it
+type Dialect struct {
+	// Operators are the unary and binary operators that can be used.
+	// If nil, all operators can be used.
+	Operators []token.Token
+	// Funcs are the names of the functions that can be called.
+	// If nil, any function can be called.
+	Funcs []string
+	// LiteralKinds are the kinds of literal that can be used out of
+	// token.INT, token.FLOAT, token.CHAR and token.STRING.
+	// If nil, all kinds can be used.
+	LiteralKinds []token.Token
+	// NoCompositeLits prevents composite literals such as []lit{1, 2}
+	NoCompositeLits bool
+	// NoIndexing prevents indexing such as "hello"[1]
+	NoIndexing bool
+}
+
+// DialectError indicates that an expression uses something that isn't
+// allowed by its Dialect
+type DialectError struct {
+	Pos  Position
+	What string
+}
+
+func (e DialectError) Error() string {
+	return fmt.Sprintf("%s not allowed in dialect at %s", e.What, e.Pos)
+}
+
+// UseDialect returns an Option to only accept expressions that are
+// allowed by d
+func UseDialect(d Dialect) Option {
+	return func(o *options) {
+		o.dialect = &d
+	}
+}
+
+// checkDialect returns an enErr if n isn't allowed by the dialect
+func (c *compiler) checkDialect(n ast.Node) (enErr, bool) {
+	d := c.dialect
+	if d == nil {
+		return enErr{}, true
+	}
+	var what string
+	switch x := n.(type) {
+	case *ast.BasicLit:
+		if d.LiteralKinds != nil && !containsToken(d.LiteralKinds, x.Kind) {
+			what = fmt.Sprintf("literal kind: %s", x.Kind)
+		}
+	case *ast.BinaryExpr:
+		if d.Operators != nil && !containsToken(d.Operators, x.Op) {
+			return c.dialectErr(x.OpPos, fmt.Sprintf("operator: %s", x.Op))
+		}
+	case *ast.UnaryExpr:
+		if d.Operators != nil && !containsToken(d.Operators, x.Op) {
+			what = fmt.Sprintf("operator: %s", x.Op)
+		}
+	case *ast.CallExpr:
+		if id, ok := x.Fun.(*ast.Ident); ok && d.Funcs != nil {
+			if !containsString(d.Funcs, id.Name) {
+				what = fmt.Sprintf("function: %s", id.Name)
+			}
+		}
+	case *ast.CompositeLit:
+		if d.NoCompositeLits {
+			what = "composite literal"
+		}
+	case *ast.IndexExpr:
+		if d.NoIndexing {
+			return c.dialectErr(x.Lbrack, "indexing")
+		}
+	}
+	if what != "" {
+		return c.dialectErr(n.Pos(), what)
+	}
+	return enErr{}, true
+}
+
+func (c *compiler) dialectErr(pos token.Pos, what string) (enErr, bool) {
+	return enErr{err: DialectError{Pos: c.position(pos), What: what}}, false
+}
+
+func containsToken(toks []token.Token, tok token.Token) bool {
+	for _, t := range toks {
+		if t == tok {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(strs []string, s string) bool {
+	for _, x := range strs {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package dexpr
+
+import (
+	"github.com/lawrencewoodman/dlit"
+	"go/token"
+	"testing"
+)
+
+func TestNew_dialect(t *testing.T) {
+	comparisons := Dialect{
+		Operators: []token.Token{
+			token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ,
+			token.LAND, token.LOR, token.NOT,
+		},
+		Funcs:           []string{},
+		LiteralKinds:    []token.Token{token.INT, token.STRING},
+		NoCompositeLits: true,
+		NoIndexing:      true,
+	}
+	cases := []struct {
+		in      string
+		dialect Dialect
+		wantErr error
+	}{
+		{in: "a > 5 && b == \"x\" || !c", dialect: comparisons},
+		{in: "a + 5 > 6", dialect: Dialect{}},
+		{in: "roundto(a, 2) > 6", dialect: Dialect{Funcs: []string{"roundto"}}},
+		{in: "a > 5 && b + 1 == 2",
+			dialect: comparisons,
+			wantErr: DialectError{
+				Pos:  Position{Offset: 11, Line: 1, Column: 12},
+				What: "operator: +",
+			},
+		},
+		{in: "a > 5 && -b == 2",
+			dialect: comparisons,
+			wantErr: DialectError{
+				Pos:  Position{Offset: 9, Line: 1, Column: 10},
+				What: "operator: -",
+			},
+		},
+		{in: "a > 5 &&\n  roundto(b, 2) == 2",
+			dialect: comparisons,
+			wantErr: DialectError{
+				Pos:  Position{Offset: 11, Line: 2, Column: 3},
+				What: "function: roundto",
+			},
+		},
+		{in: "a > 5.5",
+			dialect: comparisons,
+			wantErr: DialectError{
+				Pos:  Position{Offset: 4, Line: 1, Column: 5},
+				What: "literal kind: FLOAT",
+			},
+		},
+		{in: "a == []lit{1, 2}[0]",
+			dialect: Dialect{NoCompositeLits: true},
+			wantErr: DialectError{
+				Pos:  Position{Offset: 5, Line: 1, Column: 6},
+				What: "composite literal",
+			},
+		},
+		{in: "a == \"hello\"[1]",
+			dialect: comparisons,
+			wantErr: DialectError{
+				Pos:  Position{Offset: 12, Line: 1, Column: 13},
+				What: "indexing",
+			},
+		},
+	}
+	funcs := map[string]CallFun{"roundto": roundTo}
+	vars := map[string]*dlit.Literal{
+		"a": dlit.MustNew(7),
+		"b": dlit.MustNew("x"),
+		"c": dlit.MustNew(false),
+	}
+	for _, c := range cases {
+		expr, err := New(c.in, funcs, UseDialect(c.dialect))
+		if c.wantErr == nil {
+			if err != nil {
+				t.Errorf("New(%s) err: %s", c.in, err)
+			} else if got, err := expr.EvalBool(vars); err != nil || !got {
+				t.Errorf("EvalBool in: %s, got: %t, err: %v", c.in, got, err)
+			}
+			continue
+		}
+		wantErr := InvalidExprError{c.in, c.wantErr}
+		if err != wantErr {
+			t.Errorf("New(%s) err: %v, want: %v", c.in, err, wantErr)
+		}
+	}
+}
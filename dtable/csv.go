@@ -0,0 +1,115 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dtable
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/lawrencewoodman/dexpr"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// HeaderError indicates a problem with the heading of a column in a CSV
+// file
+type HeaderError struct {
+	Column int
+	Msg    string
+}
+
+func (e HeaderError) Error() string {
+	return fmt.Sprintf("header column: %d, %s", e.Column, e.Msg)
+}
+
+// ReadCSV reads a decision table from CSV.  The first record is a
+// heading for each column, which is one of:
+//
+//	in:expr    an input column whose value is expr
+//	out:name   an output column
+//	priority   the priority of the row for HitPriority
+//
+// Each record after that is a row and its cells are compiled as
+// described for RowSource.  For example:
+//
+//	in:age,in:country,out:rate
+//	< 18,-,0
+//	>= 18,"""UK""",0.2
+//	>= 18,"!= ""UK""",0.25
+func ReadCSV(
+	r io.Reader,
+	policy HitPolicy,
+	callFuncs map[string]dexpr.CallFun,
+) (*Table, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, HeaderError{Column: 0, Msg: "missing"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := []string{}
+	outputs := []string{}
+	priorityCol := -1
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		switch {
+		case strings.HasPrefix(h, "in:"):
+			inputs = append(inputs, strings.TrimSpace(h[len("in:"):]))
+		case strings.HasPrefix(h, "out:"):
+			name := strings.TrimSpace(h[len("out:"):])
+			if name == "" {
+				return nil, HeaderError{Column: i, Msg: "output has no name"}
+			}
+			outputs = append(outputs, name)
+		case h == "priority":
+			if priorityCol >= 0 {
+				return nil, HeaderError{Column: i, Msg: "priority already defined"}
+			}
+			priorityCol = i
+		default:
+			return nil, HeaderError{
+				Column: i,
+				Msg:    fmt.Sprintf("want: in:expr, out:name or priority, got: %s", h),
+			}
+		}
+	}
+
+	rows := []RowSource{}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rs := RowSource{
+			Conditions: make([]string, 0, len(inputs)),
+			Outputs:    make([]string, 0, len(outputs)),
+		}
+		for i, cell := range record {
+			h := strings.TrimSpace(header[i])
+			switch {
+			case i == priorityCol:
+				rs.Priority, err = strconv.Atoi(strings.TrimSpace(cell))
+				if err != nil {
+					return nil, CellError{Row: len(rows), Column: "priority", Err: err}
+				}
+			case strings.HasPrefix(h, "in:"):
+				rs.Conditions = append(rs.Conditions, cell)
+			default:
+				rs.Outputs = append(rs.Outputs, cell)
+			}
+		}
+		rows = append(rows, rs)
+	}
+	return New(policy, inputs, outputs, rows, callFuncs)
+}
@@ -0,0 +1,295 @@
+/*
+ * Decision tables whose cells are dexpr expressions
+ *
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dtable
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/lawrencewoodman/dlit"
+	"strings"
+)
+
+// InputVar is the name of the variable holding the value of the input
+// column within a condition cell
+const InputVar = "input"
+
+// HitPolicy determines which rows are used when more than one matches
+type HitPolicy int
+
+const (
+	// HitFirst uses the first row that matches
+	HitFirst HitPolicy = iota
+	// HitUnique uses the only row that matches, it is an error for
+	// more than one to match
+	HitUnique
+	// HitPriority uses the matching row with the highest priority, or
+	// the first of those with the same priority
+	HitPriority
+	// HitCollect uses every row that matches
+	HitCollect
+)
+
+func (p HitPolicy) String() string {
+	switch p {
+	case HitFirst:
+		return "first"
+	case HitUnique:
+		return "unique"
+	case HitPriority:
+		return "priority"
+	case HitCollect:
+		return "collect"
+	}
+	return fmt.Sprintf("HitPolicy(%d)", int(p))
+}
+
+// Table is a decision table.  Each row has a condition for each input
+// column and an expression for each output column.  A row matches if
+// all of its conditions are true.
+type Table struct {
+	Policy HitPolicy
+	// Inputs is the source of the expression giving the value of each
+	// input column, such as age or income / 12
+	Inputs []string
+	// Outputs is the name of each output column
+	Outputs []string
+	inputs  []*dexpr.Expr
+	rows    []row
+}
+
+// RowSource is the source of a row of a decision table.  A condition
+// can be:
+//
+//	"" or -       which matches any input
+//	> 18          which is compared with the input, also for
+//	              >=, <, <=, == and !=
+//	"FR"          which matches an input equal to it
+//	input > 5 && input < 10
+//	              which is an expression using the input variable
+//	              that must be true
+type RowSource struct {
+	Conditions []string
+	Outputs    []string
+	// Priority is used by HitPriority, the highest is used
+	Priority int
+}
+
+type row struct {
+	// conditions has a nil entry where any input matches
+	conditions []*dexpr.Expr
+	outputs    []*dexpr.Expr
+	priority   int
+}
+
+// Hit is a row that has been matched and the values of its outputs
+type Hit struct {
+	// Row is the index of the row, starting at 0
+	Row     int
+	Outputs map[string]*dlit.Literal
+}
+
+// CellError indicates an error with a cell.  Row starts at 0 for the
+// first row and is -1 for the input column headings.
+type CellError struct {
+	Row    int
+	Column string
+	Err    error
+}
+
+func (e CellError) Error() string {
+	if e.Row < 0 {
+		return fmt.Sprintf("input: %s, %s", e.Column, e.Err)
+	}
+	if e.Column == "" {
+		return fmt.Sprintf("row: %d, %s", e.Row, e.Err)
+	}
+	return fmt.Sprintf("row: %d, column: %s, %s", e.Row, e.Column, e.Err)
+}
+
+func (e CellError) Unwrap() error {
+	return e.Err
+}
+
+// UniqueError indicates that more than one row matched with HitUnique.
+// It holds the indices of the rows.
+type UniqueError []int
+
+func (e UniqueError) Error() string {
+	return fmt.Sprintf("more than one row matched: %v", []int(e))
+}
+
+var ErrWrongNumOfCells = errors.New("wrong number of cells")
+
+// New returns a decision table with the inputs, outputs and rows given.
+// Each expression is compiled with dexpr.New using callFuncs.
+func New(
+	policy HitPolicy,
+	inputs []string,
+	outputs []string,
+	rows []RowSource,
+	callFuncs map[string]dexpr.CallFun,
+) (*Table, error) {
+	t := &Table{
+		Policy:  policy,
+		Inputs:  inputs,
+		Outputs: outputs,
+		inputs:  make([]*dexpr.Expr, len(inputs)),
+		rows:    make([]row, len(rows)),
+	}
+	for i, src := range inputs {
+		expr, err := dexpr.New(src, callFuncs)
+		if err != nil {
+			return nil, CellError{Row: -1, Column: src, Err: err}
+		}
+		t.inputs[i] = expr
+	}
+	for i, rs := range rows {
+		if len(rs.Conditions) != len(inputs) || len(rs.Outputs) != len(outputs) {
+			return nil, CellError{Row: i, Err: ErrWrongNumOfCells}
+		}
+		r := row{
+			conditions: make([]*dexpr.Expr, len(inputs)),
+			outputs:    make([]*dexpr.Expr, len(outputs)),
+			priority:   rs.Priority,
+		}
+		for j, cell := range rs.Conditions {
+			expr, err := compileCondition(cell, callFuncs)
+			if err != nil {
+				return nil, CellError{Row: i, Column: inputs[j], Err: err}
+			}
+			r.conditions[j] = expr
+		}
+		for j, cell := range rs.Outputs {
+			expr, err := dexpr.New(cell, callFuncs)
+			if err != nil {
+				return nil, CellError{Row: i, Column: outputs[j], Err: err}
+			}
+			r.outputs[j] = expr
+		}
+		t.rows[i] = r
+	}
+	return t, nil
+}
+
+// compileCondition returns the expression for a condition cell or nil
+// if it matches any input
+func compileCondition(
+	cell string,
+	callFuncs map[string]dexpr.CallFun,
+) (*dexpr.Expr, error) {
+	cell = strings.TrimSpace(cell)
+	if cell == "" || cell == "-" {
+		return nil, nil
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if strings.HasPrefix(cell, op) {
+			return dexpr.New(InputVar+" "+cell, callFuncs)
+		}
+	}
+	expr, err := dexpr.New(cell, callFuncs)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range expr.VarNames() {
+		if name == InputVar {
+			return expr, nil
+		}
+	}
+	return dexpr.New(InputVar+" == ("+cell+")", callFuncs)
+}
+
+// Len returns the number of rows
+func (t *Table) Len() int {
+	return len(t.rows)
+}
+
+// Eval returns the rows hit for vars according to the hit policy along
+// with the values of their outputs, which are evaluated using vars.
+// Only HitCollect can return more than one Hit and if no rows match
+// none are returned.
+func (t *Table) Eval(vars map[string]*dlit.Literal) ([]Hit, error) {
+	inputs := make([]*dlit.Literal, len(t.inputs))
+	for i, expr := range t.inputs {
+		inputs[i] = expr.Eval(vars)
+		if err := inputs[i].Err(); err != nil {
+			return nil, CellError{Row: -1, Column: t.Inputs[i], Err: err}
+		}
+	}
+	matched, err := t.match(inputs, vars)
+	if err != nil {
+		return nil, err
+	}
+	if len(matched) == 0 {
+		return []Hit{}, nil
+	}
+	switch t.Policy {
+	case HitFirst:
+		matched = matched[:1]
+	case HitUnique:
+		if len(matched) > 1 {
+			return nil, UniqueError(matched)
+		}
+	case HitPriority:
+		best := matched[0]
+		for _, i := range matched[1:] {
+			if t.rows[i].priority > t.rows[best].priority {
+				best = i
+			}
+		}
+		matched = []int{best}
+	}
+	hits := make([]Hit, len(matched))
+	for j, i := range matched {
+		hit := Hit{Row: i, Outputs: make(map[string]*dlit.Literal, len(t.Outputs))}
+		for k, expr := range t.rows[i].outputs {
+			l := expr.Eval(vars)
+			if err := l.Err(); err != nil {
+				return nil, CellError{Row: i, Column: t.Outputs[k], Err: err}
+			}
+			hit.Outputs[t.Outputs[k]] = l
+		}
+		hits[j] = hit
+	}
+	return hits, nil
+}
+
+// match returns the indices of the rows whose conditions are all true
+// for the input values
+func (t *Table) match(
+	inputs []*dlit.Literal,
+	vars map[string]*dlit.Literal,
+) ([]int, error) {
+	condVars := make(map[string]*dlit.Literal, len(vars)+1)
+	for name, l := range vars {
+		condVars[name] = l
+	}
+	matched := []int{}
+	for i, r := range t.rows {
+		isMatch := true
+		for j, cond := range r.conditions {
+			if cond == nil {
+				continue
+			}
+			condVars[InputVar] = inputs[j]
+			isTrue, err := cond.EvalBool(condVars)
+			if err != nil {
+				return nil, CellError{Row: i, Column: t.Inputs[j], Err: err}
+			}
+			if !isTrue {
+				isMatch = false
+				break
+			}
+		}
+		if isMatch {
+			matched = append(matched, i)
+		}
+	}
+	return matched, nil
+}
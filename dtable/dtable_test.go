@@ -0,0 +1,290 @@
+package dtable
+
+import (
+	"errors"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/lawrencewoodman/dlit"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const rateCSV = `in:age,in:country,out:rate,out:note
+< 18,-,0,"""minor"""
+>= 18,"""UK""",0.2,"""uk"""
+>= 18,"!= ""UK""",0.25,country
+`
+
+const discountCSV = `in:amount,in:member,out:discount,priority
+> 100,-,5,1
+> 1000,-,10,2
+-,input == 1,2,0
+`
+
+func mustReadCSV(t *testing.T, s string, policy HitPolicy) *Table {
+	tbl, err := ReadCSV(strings.NewReader(s), policy, map[string]dexpr.CallFun{})
+	if err != nil {
+		t.Fatalf("ReadCSV err: %s", err)
+	}
+	return tbl
+}
+
+func TestTable_Eval(t *testing.T) {
+	cases := []struct {
+		csv    string
+		policy HitPolicy
+		vars   map[string]*dlit.Literal
+		want   []string
+	}{
+		{csv: rateCSV,
+			policy: HitUnique,
+			vars: map[string]*dlit.Literal{
+				"age": dlit.MustNew(12), "country": dlit.NewString("FR"),
+			},
+			want: []string{"0: note=minor rate=0"},
+		},
+		{csv: rateCSV,
+			policy: HitUnique,
+			vars: map[string]*dlit.Literal{
+				"age": dlit.MustNew(40), "country": dlit.NewString("UK"),
+			},
+			want: []string{"1: note=uk rate=0.2"},
+		},
+		{csv: rateCSV,
+			policy: HitUnique,
+			vars: map[string]*dlit.Literal{
+				"age": dlit.MustNew(18), "country": dlit.NewString("FR"),
+			},
+			want: []string{"2: note=FR rate=0.25"},
+		},
+		{csv: discountCSV,
+			policy: HitFirst,
+			vars: map[string]*dlit.Literal{
+				"amount": dlit.MustNew(2000), "member": dlit.MustNew(1),
+			},
+			want: []string{"0: discount=5"},
+		},
+		{csv: discountCSV,
+			policy: HitPriority,
+			vars: map[string]*dlit.Literal{
+				"amount": dlit.MustNew(2000), "member": dlit.MustNew(1),
+			},
+			want: []string{"1: discount=10"},
+		},
+		{csv: discountCSV,
+			policy: HitPriority,
+			vars: map[string]*dlit.Literal{
+				"amount": dlit.MustNew(50), "member": dlit.MustNew(1),
+			},
+			want: []string{"2: discount=2"},
+		},
+		{csv: discountCSV,
+			policy: HitCollect,
+			vars: map[string]*dlit.Literal{
+				"amount": dlit.MustNew(2000), "member": dlit.MustNew(1),
+			},
+			want: []string{"0: discount=5", "1: discount=10", "2: discount=2"},
+		},
+		{csv: discountCSV,
+			policy: HitCollect,
+			vars: map[string]*dlit.Literal{
+				"amount": dlit.MustNew(50), "member": dlit.MustNew(0),
+			},
+			want: []string{},
+		},
+	}
+	for i, c := range cases {
+		tbl := mustReadCSV(t, c.csv, c.policy)
+		hits, err := tbl.Eval(c.vars)
+		if err != nil {
+			t.Errorf("(%d) Eval err: %s", i, err)
+			continue
+		}
+		got := make([]string, len(hits))
+		for j, h := range hits {
+			got[j] = hitString(tbl, h)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("(%d) Eval got: %v, want: %v", i, got, c.want)
+		}
+	}
+}
+
+func hitString(tbl *Table, h Hit) string {
+	names := append([]string{}, tbl.Outputs...)
+	sort.Strings(names)
+	s := []string{strconv.Itoa(h.Row) + ":"}
+	for _, name := range names {
+		s = append(s, name+"="+h.Outputs[name].String())
+	}
+	return strings.Join(s, " ")
+}
+
+func TestTable_Eval_errors(t *testing.T) {
+	cases := []struct {
+		csv     string
+		policy  HitPolicy
+		vars    map[string]*dlit.Literal
+		wantErr string
+	}{
+		{csv: discountCSV,
+			policy: HitUnique,
+			vars: map[string]*dlit.Literal{
+				"amount": dlit.MustNew(2000), "member": dlit.MustNew(0),
+			},
+			wantErr: "more than one row matched: [0 1]",
+		},
+		{csv: discountCSV,
+			policy: HitFirst,
+			vars: map[string]*dlit.Literal{
+				"amount": dlit.NewString("lots"), "member": dlit.MustNew(0),
+			},
+			wantErr: "row: 0, column: amount, " +
+				"invalid expression: input > 100 (incompatible types)",
+		},
+		{csv: "in:amount / 0,out:x\n-,1\n",
+			policy:  HitFirst,
+			vars:    map[string]*dlit.Literal{"amount": dlit.MustNew(2)},
+			wantErr: "input: amount / 0, invalid expression: amount / 0 (divide by zero)",
+		},
+		{csv: "in:a,out:x\n-,1 / a\n",
+			policy:  HitFirst,
+			vars:    map[string]*dlit.Literal{"a": dlit.MustNew(0)},
+			wantErr: "row: 0, column: x, invalid expression: 1 / a (divide by zero)",
+		},
+	}
+	for i, c := range cases {
+		tbl := mustReadCSV(t, c.csv, c.policy)
+		_, err := tbl.Eval(c.vars)
+		if err == nil || err.Error() != c.wantErr {
+			t.Errorf("(%d) Eval err: %v, want: %s", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestReadCSV_errors(t *testing.T) {
+	cases := []struct {
+		csv     string
+		wantErr error
+	}{
+		{csv: "",
+			wantErr: HeaderError{Column: 0, Msg: "missing"},
+		},
+		{csv: "in:a,rate\n",
+			wantErr: HeaderError{
+				Column: 1,
+				Msg:    "want: in:expr, out:name or priority, got: rate",
+			},
+		},
+		{csv: "in:a,out:\n",
+			wantErr: HeaderError{Column: 1, Msg: "output has no name"},
+		},
+		{csv: "in:a,priority,priority\n",
+			wantErr: HeaderError{Column: 2, Msg: "priority already defined"},
+		},
+	}
+	for _, c := range cases {
+		_, err := ReadCSV(strings.NewReader(c.csv), HitFirst,
+			map[string]dexpr.CallFun{})
+		if !reflect.DeepEqual(err, c.wantErr) {
+			t.Errorf("ReadCSV(%q) err: %v, want: %v", c.csv, err, c.wantErr)
+		}
+	}
+
+	_, err := ReadCSV(strings.NewReader("in:a,out:x\n> 5 +,1\n"), HitFirst,
+		map[string]dexpr.CallFun{})
+	var cerr CellError
+	if !errors.As(err, &cerr) || cerr.Row != 0 || cerr.Column != "a" ||
+		!errors.Is(err, dexpr.ErrSyntax) {
+		t.Errorf("ReadCSV err: %v", err)
+	}
+
+	_, err = ReadCSV(strings.NewReader("in:a,out:x,priority\n-,1,high\n"),
+		HitFirst, map[string]dexpr.CallFun{})
+	if !errors.As(err, &cerr) || cerr.Row != 0 || cerr.Column != "priority" {
+		t.Errorf("ReadCSV err: %v", err)
+	}
+}
+
+func TestNew_errors(t *testing.T) {
+	_, err := New(HitFirst, []string{"a"}, []string{"x"},
+		[]RowSource{{Conditions: []string{"-"}, Outputs: []string{}}},
+		map[string]dexpr.CallFun{})
+	wantErr := CellError{Row: 0, Err: ErrWrongNumOfCells}
+	if !reflect.DeepEqual(err, wantErr) {
+		t.Errorf("New err: %v, want: %v", err, wantErr)
+	}
+	if got := err.Error(); got != "row: 0, wrong number of cells" {
+		t.Errorf("Error got: %s", got)
+	}
+}
+
+func TestTable_Validate(t *testing.T) {
+	cases := []struct {
+		csv    string
+		policy HitPolicy
+		want   []string
+	}{
+		{csv: rateCSV, policy: HitUnique, want: []string{}},
+		{csv: "in:amount,out:band\n" +
+			"input >= 0 && input <= 100,\"low\"\n" +
+			"> 90,\"high\"\n",
+			policy: HitUnique,
+			want: []string{
+				"missing: inputs: [-101]",
+				"missing: inputs: [-100]",
+				"missing: inputs: [-99]",
+				"missing: inputs: [-95]",
+				"missing: inputs: [-91]",
+				"missing: inputs: [-90]",
+				"missing: inputs: [-89]",
+				"missing: inputs: [-45]",
+				"missing: inputs: [-1]",
+				"overlap: inputs: [91], rows: [0 1]",
+				"overlap: inputs: [95], rows: [0 1]",
+				"overlap: inputs: [99], rows: [0 1]",
+				"overlap: inputs: [100], rows: [0 1]",
+			},
+		},
+		{csv: "in:amount,out:band\n" +
+			"input >= 0 && input <= 100,\"low\"\n" +
+			"> 90,\"high\"\n" +
+			"< 0,\"negative\"\n",
+			policy: HitFirst,
+			want:   []string{},
+		},
+		{csv: "in:country,in:x,out:y\n" +
+			"\"\"\"UK\"\"\",< 1.5,1\n" +
+			"\"\"\"FR\"\"\",-,2\n",
+			policy: HitCollect,
+			want: []string{
+				"missing: inputs: [UK, 1.5]",
+				"missing: inputs: [UK, 2.5]",
+				"missing: inputs: [other, -2.5]",
+				"missing: inputs: [other, -1.5]",
+				"missing: inputs: [other, -0.5]",
+				"missing: inputs: [other, 0]",
+				"missing: inputs: [other, 0.5]",
+				"missing: inputs: [other, 1.5]",
+				"missing: inputs: [other, 2.5]",
+			},
+		},
+	}
+	for i, c := range cases {
+		tbl := mustReadCSV(t, c.csv, c.policy)
+		problems, err := tbl.Validate()
+		if err != nil {
+			t.Errorf("(%d) Validate err: %s", i, err)
+			continue
+		}
+		got := make([]string, len(problems))
+		for j, p := range problems {
+			got[j] = p.String()
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("(%d) Validate got: %v, want: %v", i, got, c.want)
+		}
+	}
+}
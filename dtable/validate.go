@@ -0,0 +1,197 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dtable
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/lawrencewoodman/dlit"
+	"sort"
+	"strings"
+)
+
+// ProblemKind is the kind of problem found by Validate
+type ProblemKind int
+
+const (
+	// Overlap is where more than one row matches with HitUnique
+	Overlap ProblemKind = iota
+	// Missing is where no row matches
+	Missing
+)
+
+func (k ProblemKind) String() string {
+	if k == Overlap {
+		return "overlap"
+	}
+	return "missing"
+}
+
+// Problem is a problem found by Validate along with the input values
+// that show it
+type Problem struct {
+	Kind ProblemKind
+	// Rows is the indices of the rows that overlap
+	Rows []int
+	// Inputs is the value of each input column
+	Inputs []*dlit.Literal
+}
+
+func (p Problem) String() string {
+	inputs := make([]string, len(p.Inputs))
+	for i, l := range p.Inputs {
+		inputs[i] = l.String()
+	}
+	s := fmt.Sprintf("%s: inputs: [%s]", p.Kind, strings.Join(inputs, ", "))
+	if p.Kind == Overlap {
+		s += fmt.Sprintf(", rows: %v", p.Rows)
+	}
+	return s
+}
+
+// MaxValidateInputs is the most combinations of input values that
+// Validate will try
+const MaxValidateInputs = 100000
+
+var ErrTooManyInputs = errors.New("too many combinations of input values")
+
+// Validate looks for input values that aren't matched by any row and,
+// for HitUnique, input values that are matched by more than one row.
+// Rather than every possible value, it tries each combination of the
+// values for each input column that are equal to, either side of and
+// between the constants used in that column's conditions.  Only the
+// input variable is set when evaluating conditions, so a condition that
+// uses other variables is taken not to match.
+func (t *Table) Validate() ([]Problem, error) {
+	samples := make([][]*dlit.Literal, len(t.inputs))
+	total := 1
+	for j := range t.inputs {
+		samples[j] = t.columnSamples(j)
+		total *= len(samples[j])
+		if total > MaxValidateInputs {
+			return nil, ErrTooManyInputs
+		}
+	}
+
+	problems := []Problem{}
+	inputs := make([]*dlit.Literal, len(t.inputs))
+	var try func(j int)
+	try = func(j int) {
+		if j < len(inputs) {
+			for _, l := range samples[j] {
+				inputs[j] = l
+				try(j + 1)
+			}
+			return
+		}
+		rows := t.sampleMatch(inputs)
+		if len(rows) == 0 {
+			problems = append(problems, Problem{
+				Kind:   Missing,
+				Inputs: append([]*dlit.Literal{}, inputs...),
+			})
+		} else if len(rows) > 1 && t.Policy == HitUnique {
+			problems = append(problems, Problem{
+				Kind:   Overlap,
+				Rows:   rows,
+				Inputs: append([]*dlit.Literal{}, inputs...),
+			})
+		}
+	}
+	try(0)
+	return problems, nil
+}
+
+// sampleMatch returns the indices of the rows that match the input
+// values, taking a condition that returns an error not to match
+func (t *Table) sampleMatch(inputs []*dlit.Literal) []int {
+	vars := map[string]*dlit.Literal{}
+	rows := []int{}
+	for i, r := range t.rows {
+		isMatch := true
+		for j, cond := range r.conditions {
+			if cond == nil {
+				continue
+			}
+			vars[InputVar] = inputs[j]
+			if isTrue, err := cond.EvalBool(vars); err != nil || !isTrue {
+				isMatch = false
+				break
+			}
+		}
+		if isMatch {
+			rows = append(rows, i)
+		}
+	}
+	return rows
+}
+
+// columnSamples returns the values to try for input column j
+func (t *Table) columnSamples(j int) []*dlit.Literal {
+	nums := map[float64]bool{}
+	strs := map[string]bool{}
+	for _, r := range t.rows {
+		if r.conditions[j] == nil {
+			continue
+		}
+		dexpr.Inspect(r.conditions[j].Node, func(n dexpr.Node) bool {
+			ln, ok := n.(*dexpr.LitNode)
+			if !ok {
+				return true
+			}
+			if f, isFloat := ln.Value.Float(); isFloat {
+				// Negative numbers are parsed as - applied to a literal
+				nums[f] = true
+				nums[-f] = true
+			} else {
+				strs[ln.Value.String()] = true
+			}
+			return true
+		})
+	}
+
+	sorted := make([]float64, 0, len(nums))
+	for f := range nums {
+		sorted = append(sorted, f)
+	}
+	sort.Float64s(sorted)
+	values := map[float64]bool{}
+	for i, f := range sorted {
+		values[f-1] = true
+		values[f] = true
+		values[f+1] = true
+		if i > 0 {
+			values[(sorted[i-1]+f)/2] = true
+		}
+	}
+	floats := make([]float64, 0, len(values))
+	for f := range values {
+		floats = append(floats, f)
+	}
+	sort.Float64s(floats)
+
+	samples := make([]*dlit.Literal, 0, len(floats)+len(strs)+1)
+	for _, f := range floats {
+		samples = append(samples, dlit.MustNew(f))
+	}
+	if len(strs) > 0 {
+		ss := make([]string, 0, len(strs))
+		for s := range strs {
+			ss = append(ss, s)
+		}
+		sort.Strings(ss)
+		for _, s := range ss {
+			samples = append(samples, dlit.NewString(s))
+		}
+		samples = append(samples, dlit.NewString(dexpr.OtherString(strs)))
+	}
+	if len(samples) == 0 {
+		samples = append(samples, dlit.NewString(""))
+	}
+	return samples
+}
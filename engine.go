@@ -0,0 +1,140 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"github.com/lawrencewoodman/dlit"
+)
+
+// Engine keeps the value of each rule in a RuleSet and when variables
+// are updated only re-evaluates the rules that use them, directly or
+// through other rules.  A rule is only re-evaluated if the value of a
+// variable or rule that it uses has changed.  An Engine must not be
+// used by more than one goroutine at a time.
+type Engine struct {
+	rs   *RuleSet
+	vars map[string]*dlit.Literal
+	// values holds the variables and the value of each rule
+	values map[string]*dlit.Literal
+	// uses is the names of the variables and rules used by each rule
+	uses [][]string
+}
+
+// NewEngine returns an Engine for rs which evaluates every rule using
+// vars
+func NewEngine(rs *RuleSet, vars map[string]*dlit.Literal) *Engine {
+	e := &Engine{
+		rs:     rs,
+		vars:   make(map[string]*dlit.Literal, len(vars)),
+		values: make(map[string]*dlit.Literal, len(vars)+len(rs.rules)),
+		uses:   make([][]string, len(rs.rules)),
+	}
+	for i, r := range rs.rules {
+		e.uses[i] = r.Expr.VarNames()
+	}
+	for name, l := range vars {
+		e.vars[name] = l
+		e.values[name] = l
+	}
+	for _, r := range rs.rules {
+		e.values[r.Name] = r.Expr.Eval(e.values)
+	}
+	return e
+}
+
+// Update sets the variables in vars, removing any whose value is nil,
+// and re-evaluates the rules affected.  It returns the names of the
+// rules whose values have changed in the order that they were evaluated.
+func (e *Engine) Update(vars map[string]*dlit.Literal) []string {
+	changed := map[string]bool{}
+	for name, l := range vars {
+		old, exists := e.vars[name]
+		if l == nil {
+			if exists {
+				delete(e.vars, name)
+				changed[name] = true
+			}
+			continue
+		}
+		if !exists || !sameLiteral(old, l) {
+			e.vars[name] = l
+			changed[name] = true
+		}
+	}
+	if len(changed) == 0 {
+		return []string{}
+	}
+	e.setInputs(changed)
+
+	// Rules are in an order where each comes after the rules that it
+	// uses, so going through them in order finds every change
+	changedRules := []string{}
+	for i, r := range e.rs.rules {
+		if !e.usesChanged(i, changed) {
+			continue
+		}
+		l := r.Expr.Eval(e.values)
+		if sameLiteral(e.values[r.Name], l) {
+			continue
+		}
+		e.values[r.Name] = l
+		changed[r.Name] = true
+		changedRules = append(changedRules, r.Name)
+	}
+	return changedRules
+}
+
+// setInputs copies the changed variables to e.values, except for any
+// with the name of a rule as the rule's value is used in its place
+func (e *Engine) setInputs(changed map[string]bool) {
+	for name := range changed {
+		if _, isRule := e.rs.deps[name]; isRule {
+			delete(changed, name)
+			continue
+		}
+		if l, ok := e.vars[name]; ok {
+			e.values[name] = l
+		} else {
+			delete(e.values, name)
+		}
+	}
+}
+
+func (e *Engine) usesChanged(i int, changed map[string]bool) bool {
+	for _, name := range e.uses[i] {
+		if changed[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// Value returns the value of the named rule
+func (e *Engine) Value(name string) (*dlit.Literal, bool) {
+	if _, isRule := e.rs.deps[name]; !isRule {
+		return nil, false
+	}
+	return e.values[name], true
+}
+
+// Values returns the value of every rule by name
+func (e *Engine) Values() map[string]*dlit.Literal {
+	r := make(map[string]*dlit.Literal, len(e.rs.rules))
+	for _, rule := range e.rs.rules {
+		r[rule.Name] = e.values[rule.Name]
+	}
+	return r
+}
+
+// sameLiteral returns whether a and b have the same value or error
+func sameLiteral(a, b *dlit.Literal) bool {
+	aErr, bErr := a.Err(), b.Err()
+	if aErr != nil || bErr != nil {
+		return aErr != nil && bErr != nil && aErr.Error() == bErr.Error()
+	}
+	return a.String() == b.String()
+}
@@ -0,0 +1,112 @@
+package dexpr
+
+import (
+	"github.com/lawrencewoodman/dlit"
+	"reflect"
+	"testing"
+)
+
+func TestEngine(t *testing.T) {
+	calls := map[string]int{}
+	count := func(args []*dlit.Literal) (*dlit.Literal, error) {
+		calls[args[0].String()]++
+		return args[1], nil
+	}
+	funcs := map[string]CallFun{"count": count}
+	rules := []Rule{
+		{"margin", MustNew("count(\"margin\", price - cost)", funcs)},
+		{"isProfitable", MustNew("count(\"isProfitable\", margin > 0)", funcs)},
+		{"tax", MustNew("count(\"tax\", price * rate)", funcs)},
+		{"label", MustNew("count(\"label\", isProfitable && tax < 10)", funcs)},
+	}
+	rs, err := NewRuleSet(rules)
+	if err != nil {
+		t.Fatalf("NewRuleSet err: %s", err)
+	}
+	e := NewEngine(rs, map[string]*dlit.Literal{
+		"price": dlit.MustNew(20),
+		"cost":  dlit.MustNew(5),
+		"rate":  dlit.MustNew(0.2),
+	})
+	wantValues := map[string]string{
+		"margin": "15", "isProfitable": "true", "tax": "4", "label": "true",
+	}
+	checkValues := func(step string) {
+		got := map[string]string{}
+		for name, l := range e.Values() {
+			got[name] = l.String()
+		}
+		if !reflect.DeepEqual(got, wantValues) {
+			t.Errorf("%s: Values got: %v, want: %v", step, got, wantValues)
+		}
+	}
+	checkValues("NewEngine")
+
+	cases := []struct {
+		vars        map[string]*dlit.Literal
+		wantChanged []string
+		wantCalls   map[string]int
+		wantValues  map[string]string
+	}{
+		{vars: map[string]*dlit.Literal{"cost": dlit.MustNew(5)},
+			wantChanged: []string{},
+			wantCalls:   map[string]int{},
+		},
+		{vars: map[string]*dlit.Literal{"cost": dlit.MustNew(10)},
+			wantChanged: []string{"margin"},
+			wantCalls:   map[string]int{"margin": 1, "isProfitable": 1},
+			wantValues:  map[string]string{"margin": "10"},
+		},
+		{vars: map[string]*dlit.Literal{"cost": dlit.MustNew(30)},
+			wantChanged: []string{"margin", "isProfitable", "label"},
+			wantCalls: map[string]int{
+				"margin": 1, "isProfitable": 1, "label": 1,
+			},
+			wantValues: map[string]string{
+				"margin": "-10", "isProfitable": "false", "label": "false",
+			},
+		},
+		{vars: map[string]*dlit.Literal{"rate": dlit.MustNew(0.1)},
+			wantChanged: []string{"tax"},
+			wantCalls:   map[string]int{"tax": 1, "label": 1},
+			wantValues:  map[string]string{"tax": "2"},
+		},
+		{vars: map[string]*dlit.Literal{"rate": nil},
+			wantChanged: []string{"tax", "label"},
+			wantCalls:   map[string]int{"tax": 1, "label": 1},
+			wantValues: map[string]string{
+				"tax": "invalid expression: count(\"tax\", price * rate) " +
+					"(variable doesn't exist: rate)",
+				"label": "invalid expression: " +
+					"count(\"label\", isProfitable && tax < 10) " +
+					"(invalid expression: count(\"tax\", price * rate) " +
+					"(variable doesn't exist: rate))",
+			},
+		},
+		{vars: map[string]*dlit.Literal{"margin": dlit.MustNew(100)},
+			wantChanged: []string{},
+			wantCalls:   map[string]int{},
+		},
+	}
+	for i, c := range cases {
+		calls = map[string]int{}
+		got := e.Update(c.vars)
+		if !reflect.DeepEqual(got, c.wantChanged) {
+			t.Errorf("(%d) Update changed: %v, want: %v", i, got, c.wantChanged)
+		}
+		if !reflect.DeepEqual(calls, c.wantCalls) {
+			t.Errorf("(%d) Update calls: %v, want: %v", i, calls, c.wantCalls)
+		}
+		for name, v := range c.wantValues {
+			wantValues[name] = v
+		}
+		checkValues("Update")
+	}
+
+	if l, ok := e.Value("margin"); !ok || l.String() != "-10" {
+		t.Errorf("Value(margin) got: %v, %t", l, ok)
+	}
+	if _, ok := e.Value("price"); ok {
+		t.Errorf("Value(price) got ok: true, want: false")
+	}
+}
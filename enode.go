@@ -8,42 +8,102 @@ package dexpr
 
 import (
 	"github.com/lawrencewoodman/dlit"
+	"go/token"
 )
 
 type enode interface {
 	Eval(map[string]*dlit.Literal) *dlit.Literal
+	evalValue(map[string]*dlit.Literal, *evalState) value
+	evalColumn(*columnEval) []value
 }
 
 type enErr struct {
 	err error
 }
 
-type enFunc struct {
-	fn func(map[string]*dlit.Literal) *dlit.Literal
-}
-
 type enLit struct {
 	val *dlit.Literal
+	v   value
 }
 
 type enVar string
 
+type enBinary struct {
+	op token.Token
+	fn binaryFn
+	lh enode
+	rh enode
+}
+
+type enUnary struct {
+	op token.Token
+	fn unaryFn
+	rh enode
+}
+
+type enCall struct {
+	funcs *funcs
+	name  string
+	args  []enode
+}
+
+// enTrace records the Trace of node while evaluating en.  It is only
+// used in the enode tree compiled for Explain.
+type enTrace struct {
+	en   enode
+	node Node
+}
+
+// enCond records the outcome of cond in cover when evaluating en
+type enCond struct {
+	en    enode
+	cover *Coverage
+	cond  *Condition
+}
+
+// enCovered records each evaluation of the expression in cover
+type enCovered struct {
+	en    enode
+	cover *Coverage
+	expr  *exprCoverage
+}
+
+func newEnLit(l *dlit.Literal) enLit {
+	return enLit{val: l, v: litValue(l)}
+}
+
 func (ee enErr) Err() error {
 	return ee.err
 }
 
 func (ee enErr) Eval(vars map[string]*dlit.Literal) *dlit.Literal {
-	return dlit.MustNew(ee)
+	return ee.evalValue(vars, nil).Literal()
 }
 
-func (ef enFunc) Eval(vars map[string]*dlit.Literal) *dlit.Literal {
-	return ef.fn(vars)
+func (ee enErr) evalValue(
+	vars map[string]*dlit.Literal,
+	es *evalState,
+) value {
+	if err := es.enter(); err != nil {
+		return errValue(err)
+	}
+	return errValue(ee.err)
 }
 
 func (el enLit) Eval(vars map[string]*dlit.Literal) *dlit.Literal {
 	return el.val
 }
 
+func (el enLit) evalValue(
+	vars map[string]*dlit.Literal,
+	es *evalState,
+) value {
+	if err := es.enter(); err != nil {
+		return errValue(err)
+	}
+	return el.v
+}
+
 func (el enLit) Int() (int64, bool) {
 	i, isInt := el.val.Int()
 	return i, isInt
@@ -54,8 +114,135 @@ func (el enLit) String() string {
 }
 
 func (ev enVar) Eval(vars map[string]*dlit.Literal) *dlit.Literal {
+	return ev.evalValue(vars, nil).Literal()
+}
+
+func (ev enVar) evalValue(
+	vars map[string]*dlit.Literal,
+	es *evalState,
+) value {
+	if err := es.enter(); err != nil {
+		return errValue(err)
+	}
 	if l, ok := vars[string(ev)]; ok {
-		return l
+		return litValue(l)
+	}
+	return errValue(VarNotExistError(ev))
+}
+
+func (eb enBinary) Eval(vars map[string]*dlit.Literal) *dlit.Literal {
+	return eb.evalValue(vars, nil).Literal()
+}
+
+func (eb enBinary) evalValue(
+	vars map[string]*dlit.Literal,
+	es *evalState,
+) value {
+	if err := es.enter(); err != nil {
+		return errValue(err)
+	}
+	lhV := eb.lh.evalValue(vars, es)
+	rhV := eb.rh.evalValue(vars, es)
+	if lhV.Err() != nil {
+		return lhV
+	}
+	if rhV.Err() != nil {
+		return rhV
+	}
+	return eb.fn(lhV, rhV)
+}
+
+func (eu enUnary) Eval(vars map[string]*dlit.Literal) *dlit.Literal {
+	return eu.evalValue(vars, nil).Literal()
+}
+
+func (eu enUnary) evalValue(
+	vars map[string]*dlit.Literal,
+	es *evalState,
+) value {
+	if err := es.enter(); err != nil {
+		return errValue(err)
+	}
+	rhV := eu.rh.evalValue(vars, es)
+	if rhV.Err() != nil {
+		return rhV
+	}
+	return eu.fn(rhV)
+}
+
+func (ec enCall) Eval(vars map[string]*dlit.Literal) *dlit.Literal {
+	return ec.evalValue(vars, nil).Literal()
+}
+
+func (ec enCall) evalValue(
+	vars map[string]*dlit.Literal,
+	es *evalState,
+) value {
+	if err := es.enter(); err != nil {
+		return errValue(err)
+	}
+	if err := es.call(len(ec.args)); err != nil {
+		return errValue(err)
+	}
+	lits := eNodesToDLiterals(vars, es, ec.args)
+	l := callFun(ec.funcs, es, ec.name, lits)
+	if err := es.returned(l); err != nil {
+		return errValue(err)
+	}
+	return litValue(l)
+}
+
+func (et enTrace) Eval(vars map[string]*dlit.Literal) *dlit.Literal {
+	return et.en.Eval(vars)
+}
+
+func (et enTrace) evalValue(
+	vars map[string]*dlit.Literal,
+	es *evalState,
+) value {
+	parent := es.beginTrace(et.node)
+	v := et.en.evalValue(vars, es)
+	es.endTrace(parent, v)
+	return v
+}
+
+func (ec enCond) Eval(vars map[string]*dlit.Literal) *dlit.Literal {
+	return ec.evalValue(vars, nil).Literal()
+}
+
+func (ec enCond) evalValue(
+	vars map[string]*dlit.Literal,
+	es *evalState,
+) value {
+	v := ec.en.evalValue(vars, es)
+	ec.cover.record(ec.cond, v)
+	return v
+}
+
+func (ec enCovered) Eval(vars map[string]*dlit.Literal) *dlit.Literal {
+	return ec.evalValue(vars, nil).Literal()
+}
+
+func (ec enCovered) evalValue(
+	vars map[string]*dlit.Literal,
+	es *evalState,
+) value {
+	ec.cover.evaluated(ec.expr, 1)
+	return ec.en.evalValue(vars, es)
+}
+
+// unwrap returns the enode that en records the evaluation of if it is
+// an enTrace or enCond.  An index records the evaluation of an element
+// that may itself be wrapped.
+func unwrap(en enode) enode {
+	for {
+		switch x := en.(type) {
+		case enTrace:
+			en = x.en
+		case enCond:
+			en = x.en
+		default:
+			return en
+		}
 	}
-	return dlit.MustNew(VarNotExistError(ev))
 }
@@ -29,6 +29,10 @@ func (e InvalidExprError) Error() string {
 	return fmt.Sprintf("invalid expression: %s (%s)", e.Expr, e.Err)
 }
 
+func (e InvalidExprError) Unwrap() error {
+	return e.Err
+}
+
 type InvalidOpError token.Token
 
 func (e InvalidOpError) Error() string {
@@ -55,3 +59,21 @@ type FunctionError struct {
 func (e FunctionError) Error() string {
 	return fmt.Sprintf("function: %s, returned error: %s", e.FnName, e.Err)
 }
+
+func (e FunctionError) Unwrap() error {
+	return e.Err
+}
+
+// CanceledError indicates that an evaluation was stopped because its
+// context was done.  Err is the error from the context.
+type CanceledError struct {
+	Err error
+}
+
+func (e CanceledError) Error() string {
+	return fmt.Sprintf("evaluation canceled: %s", e.Err)
+}
+
+func (e CanceledError) Unwrap() error {
+	return e.Err
+}
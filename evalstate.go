@@ -0,0 +1,102 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"context"
+	"github.com/lawrencewoodman/dlit"
+)
+
+// evalState holds the state of an evaluation that needs more than
+// the vars.  A nil *evalState is used when there is nothing to check,
+// so that the common case doesn't need any allocations.
+type evalState struct {
+	ctx    context.Context
+	limits Limits
+	nodes  int
+	calls  int
+	// trace is the Trace being recorded by Explain
+	trace *Trace
+}
+
+// newEvalState returns the state needed to evaluate the expression with
+// ctx and limits, or nil if neither has to be checked
+func (expr *Expr) newEvalState(
+	ctx context.Context,
+	limits Limits,
+) *evalState {
+	if ctx == nil && limits == (Limits{}) {
+		return nil
+	}
+	return &evalState{ctx: ctx, limits: limits}
+}
+
+// enter is called before each node is evaluated and returns an error
+// if the evaluation should stop
+func (es *evalState) enter() error {
+	if es == nil {
+		return nil
+	}
+	es.nodes++
+	if es.limits.MaxNodes > 0 && es.nodes > es.limits.MaxNodes {
+		return LimitError{Limit: LimitNodes, Max: es.limits.MaxNodes}
+	}
+	return es.checkContext()
+}
+
+// call is called before a function is called with numArgs arguments
+// and returns an error if the evaluation should stop
+func (es *evalState) call(numArgs int) error {
+	if es == nil {
+		return nil
+	}
+	es.calls++
+	if es.limits.MaxCalls > 0 && es.calls > es.limits.MaxCalls {
+		return LimitError{Limit: LimitCalls, Max: es.limits.MaxCalls}
+	}
+	if es.limits.MaxListLen > 0 && numArgs > es.limits.MaxListLen {
+		return LimitError{Limit: LimitListLen, Max: es.limits.MaxListLen}
+	}
+	return nil
+}
+
+// returned is called with the result of a function and returns an error
+// if the evaluation should stop
+func (es *evalState) returned(l *dlit.Literal) error {
+	if es == nil {
+		return nil
+	}
+	// A function may have been stopped early because of the context
+	if err := es.checkContext(); err != nil {
+		return err
+	}
+	if es.limits.MaxStringLen > 0 && l.Err() == nil &&
+		len(l.String()) > es.limits.MaxStringLen {
+		return LimitError{Limit: LimitStringLen, Max: es.limits.MaxStringLen}
+	}
+	return nil
+}
+
+func (es *evalState) checkContext() error {
+	if es.ctx == nil {
+		return nil
+	}
+	select {
+	case <-es.ctx.Done():
+		return CanceledError{es.ctx.Err()}
+	default:
+		return nil
+	}
+}
+
+// context returns the context to pass to a CallFunContext
+func (es *evalState) context() context.Context {
+	if es == nil || es.ctx == nil {
+		return context.Background()
+	}
+	return es.ctx
+}
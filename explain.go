@@ -0,0 +1,178 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/lawrencewoodman/dlit"
+	"go/ast"
+	"strings"
+	"sync"
+)
+
+// Trace is the result of evaluating a node of an expression along with
+// the traces of the nodes that it was evaluated from.  Parentheses
+// aren't traced separately from the node that they contain.
+type Trace struct {
+	Node Node
+	// Value is the value of the node or nil if there was an error
+	Value *dlit.Literal
+	// Err is the error from evaluating the node, it isn't wrapped in an
+	// InvalidExprError
+	Err      error
+	Children []*Trace
+}
+
+// Explain evaluates the expression with the supplied vars in the same
+// way as Eval and returns the value of every node.  The Value and Err of
+// the Trace returned match the result of Eval.
+func (expr *Expr) Explain(vars map[string]*dlit.Literal) *Trace {
+	en, err := expr.tracedEnode()
+	if err != nil {
+		return &Trace{Node: expr.Node, Err: err}
+	}
+	es := &evalState{limits: expr.Limits}
+	en.evalValue(vars, es)
+	return es.trace
+}
+
+// String returns the trace as indented text with a line for each node
+func (t *Trace) String() string {
+	var b strings.Builder
+	t.write(&b, 0)
+	return b.String()
+}
+
+// MarshalJSON returns the trace as JSON.  Each node is an object with
+// its source as expr, the offsets of its start and end in the original
+// expression, either its value or error and the traces of its children.
+func (t *Trace) MarshalJSON() ([]byte, error) {
+	type jsonTrace struct {
+		Expr     string   `json:"expr"`
+		Start    int      `json:"start"`
+		End      int      `json:"end"`
+		Value    *string  `json:"value,omitempty"`
+		Error    string   `json:"error,omitempty"`
+		Children []*Trace `json:"children,omitempty"`
+	}
+	jt := jsonTrace{
+		Expr:     Format(t.Node),
+		Start:    t.Node.Pos().Offset,
+		End:      t.Node.End().Offset,
+		Children: t.Children,
+	}
+	if t.Err != nil {
+		jt.Error = t.Err.Error()
+	} else if t.Value != nil {
+		s := t.Value.String()
+		jt.Value = &s
+	}
+	return marshalJSON(jt)
+}
+
+// marshalJSON returns v as JSON in the same way as json.Marshal except
+// that operators such as && are left unescaped so that it is readable
+func marshalJSON(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(b.Bytes()), nil
+}
+
+func (t *Trace) write(b *strings.Builder, level int) {
+	b.WriteString(strings.Repeat("  ", level))
+	b.WriteString(Format(t.Node))
+	if t.Err != nil {
+		b.WriteString(" : error: ")
+		b.WriteString(t.Err.Error())
+	} else if t.Value != nil {
+		b.WriteString(" = ")
+		b.WriteString(FormatValue(t.Value))
+	}
+	b.WriteString("\n")
+	for _, c := range t.Children {
+		c.write(b, level+1)
+	}
+}
+
+// traced holds the enode tree used by Explain, which is only compiled
+// the first time that it is needed
+type traced struct {
+	once sync.Once
+	en   enode
+	err  error
+}
+
+// tracedEnode returns the enode tree used by Explain, compiling it the
+// first time that it is called
+func (expr *Expr) tracedEnode() (enode, error) {
+	if expr.traced == nil {
+		return expr.compileTraced()
+	}
+	t := expr.traced
+	t.once.Do(func() {
+		t.en, t.err = expr.compileTraced()
+	})
+	return t.en, t.err
+}
+
+// compileTraced compiles the expression again with each node that
+// comes from the syntax tree recording its Trace as it is evaluated.
+// The enode tree is otherwise the same as that used by Eval, except
+// that it doesn't record coverage.
+func (expr *Expr) compileTraced() (enode, error) {
+	o := options{}
+	for _, opt := range expr.opts {
+		opt(&o)
+	}
+	node, err := parseExpr(expr.Expr, o.compileLimits.maxDepth())
+	if err != nil {
+		return nil, ErrSyntax
+	}
+	c := &compiler{
+		src:       expr.Expr,
+		funcs:     expr.funcs,
+		limits:    o.compileLimits,
+		dialect:   o.dialect,
+		converted: map[ast.Node]Node{},
+		trace:     true,
+	}
+	addConverted(c.converted, node, expr.Node)
+	en := compile(node, c)
+	if ee, ok := en.(enErr); ok {
+		return nil, ee.Err()
+	}
+	return en, nil
+}
+
+// beginTrace starts the Trace of n as a child of the Trace being
+// recorded and returns the Trace of its parent
+func (es *evalState) beginTrace(n Node) *Trace {
+	parent := es.trace
+	es.trace = &Trace{Node: n}
+	if parent != nil {
+		parent.Children = append(parent.Children, es.trace)
+	}
+	return parent
+}
+
+// endTrace records v as the result of the Trace being recorded and
+// returns to its parent.  The Trace of the root is left in es.trace.
+func (es *evalState) endTrace(parent *Trace, v value) {
+	if err := v.Err(); err != nil {
+		es.trace.Err = err
+	} else {
+		es.trace.Value = v.Literal()
+	}
+	if parent != nil {
+		es.trace = parent
+	}
+}
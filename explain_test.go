@@ -0,0 +1,185 @@
+package dexpr
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/lawrencewoodman/dlit"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestExplain_String(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{in: "a > 5 && b == \"x\"",
+			want: "a > 5 && b == \"x\" = false\n" +
+				"  a > 5 = true\n" +
+				"    a = 7\n" +
+				"    5 = 5\n" +
+				"  b == \"x\" = false\n" +
+				"    b = \"y\"\n" +
+				"    \"x\" = \"x\"\n",
+		},
+		{in: "(roundto(c, 1) + 1) * 2",
+			want: "(roundto(c, 1) + 1) * 2 = 7\n" +
+				"  roundto(c, 1) + 1 = 3.5\n" +
+				"    roundto(c, 1) = 2.5\n" +
+				"      c = 2.46\n" +
+				"      1 = 1\n" +
+				"    1 = 1\n" +
+				"  2 = 2\n",
+		},
+		{in: "a > 5 || missing == 1",
+			want: "a > 5 || missing == 1 : error: variable doesn't exist: missing\n" +
+				"  a > 5 = true\n" +
+				"    a = 7\n" +
+				"    5 = 5\n" +
+				"  missing == 1 : error: variable doesn't exist: missing\n" +
+				"    missing : error: variable doesn't exist: missing\n" +
+				"    1 = 1\n",
+		},
+		{in: "[]lit{a, b, 3}[1] == \"y\"",
+			want: "[]lit{a, b, 3}[1] == \"y\" = true\n" +
+				"  []lit{a, b, 3}[1] = \"y\"\n" +
+				"    b = \"y\"\n" +
+				"  \"y\" = \"y\"\n",
+		},
+		{in: "[]lit{[]lit{1, 2}, 3}[0][1] + a",
+			want: "[]lit{[]lit{1, 2}, 3}[0][1] + a = 9\n" +
+				"  []lit{[]lit{1, 2}, 3}[0][1] = 2\n" +
+				"    2 = 2\n" +
+				"  a = 7\n",
+		},
+		{in: "[]lit{roundto(c, 1), a}[0] * 2",
+			want: "[]lit{roundto(c, 1), a}[0] * 2 = 5\n" +
+				"  []lit{roundto(c, 1), a}[0] = 2.5\n" +
+				"    roundto(c, 1) = 2.5\n" +
+				"      c = 2.46\n" +
+				"      1 = 1\n" +
+				"  2 = 2\n",
+		},
+	}
+	vars := map[string]*dlit.Literal{
+		"a": dlit.MustNew(7),
+		"b": dlit.NewString("y"),
+		"c": dlit.MustNew(2.46),
+	}
+	funcs := map[string]CallFun{"roundto": roundTo}
+	for _, c := range cases {
+		expr := MustNew(c.in, funcs)
+		got := expr.Explain(vars).String()
+		if got != c.want {
+			t.Errorf("Explain(%s) got:\n%s\nwant:\n%s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestExplain_sameAsEval(t *testing.T) {
+	cases := []string{
+		"a > 5 && b == \"x\"",
+		"roundto(c, 1) * -a",
+		"[]lit{[]lit{a, 2}[1], []lit{b}[0]}[1]",
+		"[]lit{[]lit{1, 2}, 3}[0][1] + a",
+		"[]lit{[]lit{a, 2}, []lit{b}}[1][0]",
+		"([]lit{[]lit{a}, 2})[0][0] > 5",
+		"[]lit{roundto(c, 1), a}[0] * 2",
+		"[]lit{a, nofunc(a)}[1]",
+		"[]lit{1, 2} + []lit{3}",
+		"\"hello\"[1] == \"e\"",
+		"!(a > b) || c / 0 > 1",
+		"nofunc(a)",
+	}
+	vars := map[string]*dlit.Literal{
+		"a": dlit.MustNew(7),
+		"b": dlit.NewString("y"),
+		"c": dlit.MustNew(2.46),
+	}
+	funcs := map[string]CallFun{"roundto": roundTo}
+	for _, in := range cases {
+		expr := MustNew(in, funcs)
+		tr := expr.Explain(vars)
+		want := expr.Eval(vars)
+		if tr.Err != nil {
+			wantErr := want.Err()
+			if wantErr == nil || wantErr != (InvalidExprError{in, tr.Err}) {
+				t.Errorf("Explain(%s) err: %v, want: %v", in, tr.Err, wantErr)
+			}
+		} else if tr.Value.String() != want.String() {
+			t.Errorf("Explain(%s) got: %s, want: %s", in, tr.Value, want)
+		}
+	}
+}
+
+func TestExplain_compiledOnce(t *testing.T) {
+	in := "a * 2 > b"
+	expr := MustNew(in, map[string]CallFun{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(a int) {
+			defer wg.Done()
+			vars := map[string]*dlit.Literal{
+				"a": dlit.MustNew(a),
+				"b": dlit.MustNew(7),
+			}
+			tr := expr.Explain(vars)
+			want := expr.Eval(vars)
+			if tr.Err != nil || tr.Value.String() != want.String() {
+				t.Errorf("Explain(%s) a: %d, got: %s, err: %v, want: %s",
+					in, a, tr.Value, tr.Err, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if expr.traced.en == nil {
+		t.Fatalf("Explain(%s) didn't keep the traced enode tree", in)
+	}
+	// The traced enode tree is kept so the source isn't compiled again
+	expr.Expr = "a *"
+	vars := map[string]*dlit.Literal{"a": dlit.MustNew(4), "b": dlit.MustNew(7)}
+	if tr := expr.Explain(vars); tr.Err != nil || tr.Value.String() != "true" {
+		t.Errorf("Explain(%s) got: %s, err: %v, want: true", in, tr.Value, tr.Err)
+	}
+}
+
+func TestExplain_limits(t *testing.T) {
+	in := "a + b + 3 > 1"
+	vars := map[string]*dlit.Literal{
+		"a": dlit.MustNew(4),
+		"b": dlit.MustNew(3),
+	}
+	expr := MustNew(in, map[string]CallFun{}, EvalLimits(Limits{MaxNodes: 7}))
+	if tr := expr.Explain(vars); tr.Err != nil {
+		t.Errorf("Explain(%s) err: %s", in, tr.Err)
+	}
+	expr.Limits = Limits{MaxNodes: 6}
+	wantErr := LimitError{Limit: LimitNodes, Max: 6}
+	if tr := expr.Explain(vars); tr.Err != wantErr {
+		t.Errorf("Explain(%s) err: %v, want: %v", in, tr.Err, wantErr)
+	}
+}
+
+func TestExplain_JSON(t *testing.T) {
+	in := "a > 5 && b"
+	vars := map[string]*dlit.Literal{"a": dlit.MustNew(7)}
+	expr := MustNew(in, map[string]CallFun{})
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(expr.Explain(vars)); err != nil {
+		t.Fatalf("Encode err: %s", err)
+	}
+	got := strings.TrimSpace(b.String())
+	want := `{"expr":"a > 5 && b","start":0,"end":10,` +
+		`"error":"variable doesn't exist: b","children":[` +
+		`{"expr":"a > 5","start":0,"end":5,"value":"true","children":[` +
+		`{"expr":"a","start":0,"end":1,"value":"7"},` +
+		`{"expr":"5","start":4,"end":5,"value":"5"}]},` +
+		`{"expr":"b","start":9,"end":10,"error":"variable doesn't exist: b"}]}`
+	if got != want {
+		t.Errorf("Encode got:\n%s\nwant:\n%s", got, want)
+	}
+}
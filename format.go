@@ -0,0 +1,188 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"github.com/lawrencewoodman/dlit"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Formatter renders a syntax tree as source in a canonical form.  There
+// is a single space either side of each binary operator, parentheses are
+// only used where the precedence of the operators needs them and strings
+// are always double quoted.
+type Formatter struct {
+	// MaxWidth is the width beyond which a chain of && or || operators
+	// is split over several lines.  If 0 the output is a single line.
+	MaxWidth int
+	// Indent is used to indent each continuation line.  If "" a tab
+	// is used.
+	Indent string
+}
+
+// FormatValue returns l as it would be written in an expression, except
+// that bools are written as true or false
+func FormatValue(l *dlit.Literal) string {
+	if _, isInt := l.Int(); isInt {
+		return l.String()
+	}
+	if _, isFloat := l.Float(); isFloat {
+		return l.String()
+	}
+	if _, isBool := l.Bool(); isBool {
+		return l.String()
+	}
+	return strconv.Quote(l.String())
+}
+
+// Format renders n as source in a canonical form on a single line
+func Format(n Node) string {
+	return Formatter{}.Format(n)
+}
+
+// Format renders the expression as source in a canonical form on
+// a single line
+func (expr *Expr) Format() string {
+	return Format(expr.Node)
+}
+
+// Format renders n as source in a canonical form
+func (f Formatter) Format(n Node) string {
+	if f.Indent == "" {
+		f.Indent = "\t"
+	}
+	if f.MaxWidth <= 0 {
+		return formatNode(n)
+	}
+	return f.wrap(n, 0)
+}
+
+// wrap renders n, splitting chains of && or || operators that are wider
+// than f.MaxWidth when started at the indent level given
+func (f Formatter) wrap(n Node, level int) string {
+	n = unparenNode(n)
+	s := formatNode(n)
+	bn, ok := n.(*BinaryNode)
+	if !ok || (bn.Op != token.LAND && bn.Op != token.LOR) ||
+		level*utf8.RuneCountInString(f.Indent)+len(s) <= f.MaxWidth {
+		return s
+	}
+	operands := chainOperands(bn)
+	sep := " " + bn.Op.String() + "\n" + strings.Repeat(f.Indent, level+1)
+	lines := make([]string, len(operands))
+	for i, o := range operands {
+		os := f.wrap(o, level+1)
+		if needParens(o, bn, i > 0) {
+			os = "(" + os + ")"
+		}
+		lines[i] = os
+	}
+	return strings.Join(lines, sep)
+}
+
+// chainOperands returns the operands of a chain of bn.Op operators
+func chainOperands(bn *BinaryNode) []Node {
+	x := unparenNode(bn.X)
+	if xb, ok := x.(*BinaryNode); ok && xb.Op == bn.Op {
+		return append(chainOperands(xb), bn.Y)
+	}
+	return []Node{bn.X, bn.Y}
+}
+
+func formatNode(n Node) string {
+	switch x := n.(type) {
+	case *LitNode:
+		return formatLit(x)
+	case *VarNode:
+		return x.Name
+	case *ParenNode:
+		return formatNode(unparenNode(x))
+	case *UnaryNode:
+		s := formatNode(unparenNode(x.X))
+		xu, isUnary := unparenNode(x.X).(*UnaryNode)
+		if _, isBinary := unparenNode(x.X).(*BinaryNode); isBinary ||
+			(isUnary && xu.Op == x.Op && x.Op != token.NOT) {
+			s = "(" + s + ")"
+		}
+		return x.Op.String() + s
+	case *BinaryNode:
+		lh := formatNode(unparenNode(x.X))
+		rh := formatNode(unparenNode(x.Y))
+		if needParens(x.X, x, false) {
+			lh = "(" + lh + ")"
+		}
+		if needParens(x.Y, x, true) {
+			rh = "(" + rh + ")"
+		}
+		return lh + " " + x.Op.String() + " " + rh
+	case *CallNode:
+		return x.Name + "(" + formatNodes(x.Args) + ")"
+	case *ListNode:
+		typ := strings.Join(strings.Fields(x.Type), "")
+		return typ + "{" + formatNodes(x.Elts) + "}"
+	case *IndexNode:
+		s := formatNode(unparenNode(x.X))
+		switch unparenNode(x.X).(type) {
+		case *UnaryNode, *BinaryNode:
+			s = "(" + s + ")"
+		}
+		return s + "[" + formatNode(unparenNode(x.Index)) + "]"
+	}
+	return ""
+}
+
+func formatNodes(ns []Node) string {
+	r := make([]string, len(ns))
+	for i, n := range ns {
+		r[i] = formatNode(unparenNode(n))
+	}
+	return strings.Join(r, ", ")
+}
+
+// formatLit renders a literal.  Strings are always double quoted and
+// literals that weren't parsed from source are rendered from their value.
+func formatLit(l *LitNode) string {
+	switch l.Kind {
+	case token.STRING:
+		return strconv.Quote(l.Value.String())
+	case token.CHAR:
+		r, _ := utf8.DecodeRuneInString(l.Value.String())
+		return strconv.QuoteRune(r)
+	}
+	if l.Raw != "" {
+		return l.Raw
+	}
+	return l.Value.String()
+}
+
+// needParens returns whether operand, of parent, must be in parentheses.
+// Operators of the same precedence are evaluated left to right so a
+// right hand operand of the same precedence keeps its parentheses.
+func needParens(operand Node, parent *BinaryNode, isRight bool) bool {
+	b, ok := unparenNode(operand).(*BinaryNode)
+	if !ok {
+		return false
+	}
+	if isRight {
+		return b.Op.Precedence() <= parent.Op.Precedence()
+	}
+	return b.Op.Precedence() < parent.Op.Precedence()
+}
+
+// unparenNode returns n with any enclosing parentheses removed
+func unparenNode(n Node) Node {
+	for {
+		p, ok := n.(*ParenNode)
+		if !ok {
+			return n
+		}
+		n = p.X
+	}
+}
@@ -0,0 +1,97 @@
+package dexpr
+
+import (
+	"github.com/lawrencewoodman/dlit"
+	"testing"
+)
+
+func TestFormatValue(t *testing.T) {
+	cases := []struct {
+		in   *dlit.Literal
+		want string
+	}{
+		{in: dlit.MustNew(7), want: "7"},
+		{in: dlit.MustNew(-2.5), want: "-2.5"},
+		{in: dlit.MustNew(true), want: "true"},
+		{in: dlit.NewString("bob \"b\""), want: "\"bob \\\"b\\\"\""},
+	}
+	for _, c := range cases {
+		if got := FormatValue(c.in); got != c.want {
+			t.Errorf("FormatValue(%s) got: %s, want: %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{in: "a+b*c", want: "a + b * c"},
+		{in: "((a+b))*c", want: "(a + b) * c"},
+		{in: "a+(b*c)", want: "a + b * c"},
+		{in: "a-(b-c)", want: "a - (b - c)"},
+		{in: "(a-b)-c", want: "a - b - c"},
+		{in: "a  ==  5 &&(b>1 ||  c<2)", want: "a == 5 && (b > 1 || c < 2)"},
+		{in: "(a == 5 && b > 1) || c < 2", want: "a == 5 && b > 1 || c < 2"},
+		{in: "!(a)", want: "!a"},
+		{in: "!(a && b)", want: "!(a && b)"},
+		{in: "!!a", want: "!!a"},
+		{in: "-(-a)", want: "-(-a)"},
+		{in: "-(5)*2", want: "-5 * 2"},
+		{in: "`hello \"bob\"` == 'x'", want: "\"hello \\\"bob\\\"\" == 'x'"},
+		{in: "roundto( a+1 ,(2) )", want: "roundto(a + 1, 2)"},
+		{in: "[] lit{ 1,(a),\"b\" }[ 1 ]", want: "[]lit{1, a, \"b\"}[1]"},
+		{in: "5.20 == 7.0", want: "5.20 == 7.0"},
+	}
+	for _, c := range cases {
+		expr := MustNew(c.in, map[string]CallFun{})
+		got := expr.Format()
+		if got != c.want {
+			t.Errorf("Format(%s) got: %s, want: %s", c.in, got, c.want)
+			continue
+		}
+		// Formatting must not change the meaning of the expression
+		reformatted := MustNew(got, map[string]CallFun{}).Format()
+		if reformatted != got {
+			t.Errorf("Format(%s) not stable, got: %s", got, reformatted)
+		}
+	}
+}
+
+func TestFormatter_wrap(t *testing.T) {
+	cases := []struct {
+		in       string
+		maxWidth int
+		want     string
+	}{
+		{in: "a > 1 && b > 2", maxWidth: 20, want: "a > 1 && b > 2"},
+		{in: "a > 1 && b > 2 && c > 3",
+			maxWidth: 20,
+			want:     "a > 1 &&\n  b > 2 &&\n  c > 3",
+		},
+		{in: "country == \"FR\" && (amount > 100 || tier == \"gold\") && x",
+			maxWidth: 30,
+			want: "country == \"FR\" &&\n" +
+				"  (amount > 100 ||\n" +
+				"    tier == \"gold\") &&\n" +
+				"  x",
+		},
+		{in: "a > 1 && b > 2 || c > 3 && d > 4",
+			maxWidth: 20,
+			want:     "a > 1 && b > 2 ||\n  c > 3 && d > 4",
+		},
+	}
+	for _, c := range cases {
+		expr := MustNew(c.in, map[string]CallFun{})
+		f := Formatter{MaxWidth: c.maxWidth, Indent: "  "}
+		got := f.Format(expr.Node)
+		if got != c.want {
+			t.Errorf("Format(%s) got:\n%s\nwant:\n%s", c.in, got, c.want)
+			continue
+		}
+		if _, err := New(got, map[string]CallFun{}); err != nil {
+			t.Errorf("New(%s) err: %s", got, err)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"github.com/lawrencewoodman/dlit"
+	"go/token"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TestInput is a set of variables for an expression and whether the
+// expression is true for them
+type TestInput struct {
+	Vars map[string]*dlit.Literal
+	Want bool
+}
+
+// maxTestEvals is the most times that GenerateTestInputs evaluates the
+// expression when looking for each TestInput
+const maxTestEvals = 10000
+
+// GenerateTestInputs returns sets of variables that make e true and
+// sets that make it false, without an error, to use as test cases.  The
+// values are chosen to be on each side of the boundary of each
+// comparison, so that amount > 100 gives 100 and 101, and for each of
+// these values a set of variables is found that makes e true and one
+// that makes it false where possible.  For a constant that isn't a whole
+// number the values either side of it differ by one in its last decimal
+// place, so that amount > 100.5 gives 100.5 and 100.6.  A variable used
+// as a bool is given the values true and false.
+//
+// The comparisons are found by walking the compiled expression, which
+// can combine comparisons of a variable with a constant using &&, ||
+// and !.  An UnsupportedError is returned for anything else.  The other
+// variables are given each of the values found for them in turn, and
+// the first set for which EvalBool gives the result wanted is used.
+func GenerateTestInputs(e *Expr) ([]TestInput, error) {
+	en, err := e.tracedEnode()
+	if err != nil {
+		return nil, err
+	}
+	g := &testGen{expr: e, consts: map[string]*dlit.Literal{}}
+	if err := g.addAtoms(en, e.Node); err != nil {
+		return nil, err
+	}
+	g.findCandidates()
+
+	inputs := []TestInput{}
+	seen := map[string]bool{}
+	add := func(preset map[string]*dlit.Literal, want bool) {
+		vals, ok := g.search(preset, want)
+		if !ok {
+			return
+		}
+		key := varsKey(vals)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		inputs = append(inputs, TestInput{Vars: vals, Want: want})
+	}
+
+	for _, a := range g.atoms {
+		for _, l := range g.boundaryValues(a) {
+			preset := map[string]*dlit.Literal{a.varName: l}
+			add(preset, true)
+			add(preset, false)
+		}
+	}
+	// Make sure that there is a true and false input if possible, such
+	// as when there aren't any comparisons
+	for _, want := range []bool{true, false} {
+		if !hasWant(inputs, want) {
+			add(nil, want)
+		}
+	}
+	return inputs, nil
+}
+
+// testGen holds what GenerateTestInputs has found in the compiled
+// expression
+type testGen struct {
+	expr  *Expr
+	atoms []atom
+	// consts is the values of the variables true and false if used
+	consts map[string]*dlit.Literal
+	// names is the names of the other variables, sorted, and candidates
+	// the values to try for each
+	names      []string
+	candidates [][]*dlit.Literal
+}
+
+// addAtoms adds the comparisons and variables used as bools in en,
+// which is from the enode tree compiled for Explain so that the Node
+// it was compiled from is known.  node is the Node of en if it isn't
+// an enTrace.
+func (g *testGen) addAtoms(en enode, node Node) error {
+	switch x := en.(type) {
+	case enTrace:
+		return g.addAtoms(x.en, x.node)
+	case enLit:
+		if _, isBool := x.val.Bool(); isBool {
+			return nil
+		}
+	case enVar:
+		switch name := string(x); name {
+		case "true", "false":
+			g.consts[name] = dlit.MustNew(name == "true")
+		default:
+			g.atoms = append(g.atoms, atom{varName: name, op: token.ILLEGAL})
+		}
+		return nil
+	case enUnary:
+		if x.op == token.NOT {
+			return g.addAtoms(x.rh, node)
+		}
+	case enBinary:
+		switch {
+		case x.op == token.LAND || x.op == token.LOR:
+			if err := g.addAtoms(x.lh, node); err != nil {
+				return err
+			}
+			return g.addAtoms(x.rh, node)
+		case isComparisonOp(x.op):
+			if v, ok := unwrap(x.lh).(enVar); ok {
+				if l, ok := constEnode(x.rh); ok {
+					g.atoms = append(g.atoms, atom{
+						varName:   string(v),
+						op:        x.op,
+						value:     l,
+						varOnLeft: true,
+					})
+					return nil
+				}
+			}
+			if v, ok := unwrap(x.rh).(enVar); ok {
+				if l, ok := constEnode(x.lh); ok {
+					g.atoms = append(g.atoms, atom{varName: string(v), op: x.op, value: l})
+					return nil
+				}
+			}
+		}
+	}
+	return UnsupportedError{Pos: node.Pos(), Expr: Format(node)}
+}
+
+// constEnode returns the value of en if it is a constant number or
+// string, including a negative number
+func constEnode(en enode) (*dlit.Literal, bool) {
+	switch x := unwrap(en).(type) {
+	case enLit:
+		return x.val, true
+	case enUnary:
+		if l, ok := unwrap(x.rh).(enLit); ok && x.op == token.SUB {
+			if v := opNeg(l.v); v.Err() == nil {
+				return v.Literal(), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// findCandidates sets the values to try for each variable, which are
+// the boundaryValues of each of its comparisons
+func (g *testGen) findCandidates() {
+	values := map[string][]*dlit.Literal{}
+	seen := map[string]bool{}
+	for _, a := range g.atoms {
+		if _, ok := values[a.varName]; !ok {
+			g.names = append(g.names, a.varName)
+		}
+		for _, l := range g.boundaryValues(a) {
+			key := a.varName + "=" + l.String()
+			if !seen[key] {
+				seen[key] = true
+				values[a.varName] = append(values[a.varName], l)
+			}
+		}
+	}
+	sort.Strings(g.names)
+	g.candidates = make([][]*dlit.Literal, len(g.names))
+	for i, name := range g.names {
+		g.candidates[i] = values[name]
+	}
+}
+
+// search returns the first set of variables, including those in
+// preset, for which the expression evaluates to want without an error
+// and whether one was found within maxTestEvals evaluations
+func (g *testGen) search(
+	preset map[string]*dlit.Literal,
+	want bool,
+) (map[string]*dlit.Literal, bool) {
+	vals := map[string]*dlit.Literal{}
+	for name, l := range g.consts {
+		vals[name] = l
+	}
+	for name, l := range preset {
+		vals[name] = l
+	}
+	evals := 0
+	var try func(i int) bool
+	try = func(i int) bool {
+		if i == len(g.names) {
+			evals++
+			isTrue, err := g.expr.EvalBool(vals)
+			return err == nil && isTrue == want
+		}
+		if _, isSet := preset[g.names[i]]; isSet {
+			return try(i + 1)
+		}
+		for _, l := range g.candidates[i] {
+			if evals >= maxTestEvals {
+				break
+			}
+			vals[g.names[i]] = l
+			if try(i + 1) {
+				return true
+			}
+		}
+		delete(vals, g.names[i])
+		return false
+	}
+	if !try(0) {
+		return nil, false
+	}
+	return vals, true
+}
+
+// boundaryValues returns the values of the variable of a on each side
+// of the boundary of its comparison
+func (g *testGen) boundaryValues(a atom) []*dlit.Literal {
+	if a.op == token.ILLEGAL {
+		return []*dlit.Literal{dlit.MustNew(true), dlit.MustNew(false)}
+	}
+	x, isNum := numValue(a.value)
+	if !isNum {
+		return []*dlit.Literal{a.value, dlit.NewString(g.otherString(a.varName))}
+	}
+	op := a.op
+	if !a.varOnLeft {
+		op = swapComparison(op)
+	}
+	below, above := adjacentNums(x)
+	switch op {
+	case token.LSS, token.GEQ:
+		return []*dlit.Literal{below, numLiteral(x)}
+	case token.LEQ, token.GTR:
+		return []*dlit.Literal{numLiteral(x), above}
+	}
+	return []*dlit.Literal{below, numLiteral(x), above}
+}
+
+// otherString returns a string that isn't equal to any of the constants
+// that name is compared with
+func (g *testGen) otherString(name string) string {
+	strs := map[string]bool{}
+	for _, a := range g.atoms {
+		if a.varName == name && a.op != token.ILLEGAL {
+			strs[a.value.String()] = true
+		}
+	}
+	return OtherString(strs)
+}
+
+// adjacentNums returns the numbers either side of x, which differ from
+// it by 1 if it is a whole number or otherwise by one in the last
+// decimal place of x, so that 100.5 gives 100.4 and 100.6.  Whole
+// numbers from 2^53 can't be changed by 1 so the nearest floats are
+// used instead.
+func adjacentNums(x float64) (*dlit.Literal, *dlit.Literal) {
+	if x == math.Trunc(x) || math.IsNaN(x) {
+		below, above := x-1, x+1
+		if below == x {
+			below = math.Nextafter(x, math.Inf(-1))
+		}
+		if above == x {
+			above = math.Nextafter(x, math.Inf(1))
+		}
+		return numLiteral(below), numLiteral(above)
+	}
+	s := strconv.FormatFloat(x, 'f', -1, 64)
+	places := len(s) - strings.Index(s, ".") - 1
+	step := math.Pow10(-places)
+	// Round to the same number of places to avoid values such as
+	// 0.19999999999999998 from 0.3 - 0.1
+	round := func(f float64) *dlit.Literal {
+		r, _ := strconv.ParseFloat(strconv.FormatFloat(f, 'f', places, 64), 64)
+		return numLiteral(r)
+	}
+	return round(x - step), round(x + step)
+}
+
+// hasWant returns whether any of inputs has Want equal to want
+func hasWant(inputs []TestInput, want bool) bool {
+	for _, ti := range inputs {
+		if ti.Want == want {
+			return true
+		}
+	}
+	return false
+}
+
+// varsKey returns a key that is the same for equal sets of variables
+func varsKey(vars map[string]*dlit.Literal) string {
+	s := make([]string, 0, len(vars))
+	for name, l := range vars {
+		s = append(s, name+"="+l.String())
+	}
+	sort.Strings(s)
+	return strings.Join(s, "\x00")
+}
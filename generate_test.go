@@ -0,0 +1,124 @@
+package dexpr
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateTestInputs(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{in: "amount > 100",
+			want: []string{"amount=100: false", "amount=101: true"},
+		},
+		{in: "100 >= amount",
+			want: []string{"amount=100: true", "amount=101: false"},
+		},
+		{in: "amount > 100 && country == \"FR\"",
+			want: []string{
+				"amount=100 country=FR: false",
+				"amount=101 country=FR: true",
+				"amount=101 country=other: false",
+				"amount=100 country=other: false",
+			},
+		},
+		{in: "flag || x <= 5.5",
+			want: []string{
+				"flag=true x=5.5: true",
+				"flag=false x=5.5: true",
+				"flag=false x=5.6: false",
+				"flag=true x=5.6: true",
+			},
+		},
+		{in: "amount > 100.5",
+			want: []string{"amount=100.5: false", "amount=100.6: true"},
+		},
+		{in: "rate < 0.3",
+			want: []string{"rate=0.2: true", "rate=0.3: false"},
+		},
+		{in: "rate == -0.25",
+			want: []string{
+				"rate=-0.26: false",
+				"rate=-0.25: true",
+				"rate=-0.24: false",
+			},
+		},
+		{in: "x > 1e20",
+			want: []string{
+				"x=100000000000000000000: false",
+				"x=100000000000000020000: true",
+			},
+		},
+		{in: "x < -9007199254740993",
+			want: []string{"x=-9007199254740994: true", "x=-9007199254740992: false"},
+		},
+		{in: "tier == 2",
+			want: []string{"tier=1: false", "tier=2: true", "tier=3: false"},
+		},
+		{in: "true && x != \"a\"",
+			want: []string{"true=true x=a: false", "true=true x=other: true"},
+		},
+		{in: "!(x >= -3) || y == 7",
+			want: []string{
+				"x=-4 y=6: true",
+				"x=-3 y=7: true",
+				"x=-3 y=6: false",
+				"x=-4 y=7: true",
+				"x=-4 y=8: true",
+				"x=-3 y=8: false",
+			},
+		},
+		{in: "x > 5 && x < 5",
+			want: []string{"x=5: false", "x=6: false", "x=4: false"},
+		},
+	}
+	for _, c := range cases {
+		e := MustNew(c.in, map[string]CallFun{})
+		inputs, err := GenerateTestInputs(e)
+		if err != nil {
+			t.Errorf("GenerateTestInputs(%s) err: %s", c.in, err)
+			continue
+		}
+		got := make([]string, len(inputs))
+		for i, ti := range inputs {
+			got[i] = fmt.Sprintf("%s: %t", exampleString(ti.Vars), ti.Want)
+			isTrue, err := e.EvalBool(ti.Vars)
+			if err != nil || isTrue != ti.Want {
+				t.Errorf("EvalBool(%s) with %v got: %t, err: %v, want: %t",
+					c.in, ti.Vars, isTrue, err, ti.Want)
+			}
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("GenerateTestInputs(%s) got: %v, want: %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestGenerateTestInputs_errors(t *testing.T) {
+	cases := []struct {
+		in      string
+		wantErr error
+	}{
+		{in: "a + b > 3",
+			wantErr: UnsupportedError{
+				Pos:  Position{Offset: 0, Line: 1, Column: 1},
+				Expr: "a + b > 3",
+			},
+		},
+		{in: "x > 1 &&\n(f(x) || y == 2)",
+			wantErr: UnsupportedError{
+				Pos:  Position{Offset: 10, Line: 2, Column: 2},
+				Expr: "f(x)",
+			},
+		},
+	}
+	for _, c := range cases {
+		_, err := GenerateTestInputs(MustNew(c.in, map[string]CallFun{}))
+		if !reflect.DeepEqual(err, c.wantErr) {
+			t.Errorf("GenerateTestInputs(%s) err: %v, want: %v", c.in, err, c.wantErr)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"github.com/lawrencewoodman/dlit"
+	"go/token"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Index finds which of many expressions are true for a set of vars
+// without evaluating all of them.  Each expression added is analysed
+// for a condition such as country == "FR" or amount > 100 that must be
+// true for the expression to be true.  These conditions are put in
+// lookup tables so that only the expressions whose condition may be
+// true for the vars are evaluated.  An expression without such a
+// condition is always evaluated.
+//
+// A condition is found in an operand of a chain of && operators that
+// compares a variable with a constant using ==, <, <=, > or >=.
+// Equality is preferred to a range.  If the expression is a chain of ||
+// operators, a condition is needed for each operand.
+//
+// Once built an Index may be used by more than one goroutine at a time,
+// but not while expressions are being added.
+type Index struct {
+	ids   []string
+	exprs []*Expr
+	// eq is the expressions for each key of the value of a variable,
+	// by variable name
+	eq map[string]map[string][]int
+	// lower and upper are the expressions for each variable with a
+	// lower or upper bound, by variable name
+	lower map[string][]bound
+	upper map[string][]bound
+	// unindexed is the expressions that must always be evaluated
+	unindexed []int
+}
+
+// bound is a bound of a range condition.  Bounds are inclusive so that
+// every value that could satisfy the condition is found.
+type bound struct {
+	value float64
+	expr  int
+}
+
+// condition is a condition that must be true for an expression to be
+// true
+type condition struct {
+	varName string
+	// op is token.EQL for equality, token.GEQ for a lower bound or
+	// token.LEQ for an upper bound
+	op    token.Token
+	key   string
+	bound float64
+}
+
+func NewIndex() *Index {
+	return &Index{
+		eq:    map[string]map[string][]int{},
+		lower: map[string][]bound{},
+		upper: map[string][]bound{},
+	}
+}
+
+// Add adds expr to the index identified by id
+func (ix *Index) Add(id string, expr *Expr) {
+	i := len(ix.exprs)
+	ix.ids = append(ix.ids, id)
+	ix.exprs = append(ix.exprs, expr)
+	conds, ok := exprConditions(expr.Node)
+	if !ok {
+		ix.unindexed = append(ix.unindexed, i)
+		return
+	}
+	for _, c := range conds {
+		switch c.op {
+		case token.EQL:
+			keys, ok := ix.eq[c.varName]
+			if !ok {
+				keys = map[string][]int{}
+				ix.eq[c.varName] = keys
+			}
+			keys[c.key] = append(keys[c.key], i)
+		case token.GEQ:
+			ix.lower[c.varName] = insertBound(ix.lower[c.varName], bound{c.bound, i})
+		case token.LEQ:
+			ix.upper[c.varName] = insertBound(ix.upper[c.varName], bound{c.bound, i})
+		}
+	}
+}
+
+// insertBound inserts b into bounds keeping them sorted by value
+func insertBound(bounds []bound, b bound) []bound {
+	i := sort.Search(len(bounds), func(i int) bool {
+		return bounds[i].value > b.value
+	})
+	bounds = append(bounds, bound{})
+	copy(bounds[i+1:], bounds[i:])
+	bounds[i] = b
+	return bounds
+}
+
+// Len returns the number of expressions in the index
+func (ix *Index) Len() int {
+	return len(ix.exprs)
+}
+
+// Match returns the ids of the expressions that are true for vars, in
+// the order that they were added.  This is the same as using EvalBool
+// on each expression and keeping those that return true without an
+// error.
+func (ix *Index) Match(vars map[string]*dlit.Literal) []string {
+	r := []string{}
+	for _, i := range ix.candidates(vars) {
+		if isTrue, err := ix.exprs[i].EvalBool(vars); err == nil && isTrue {
+			r = append(r, ix.ids[i])
+		}
+	}
+	return r
+}
+
+// Candidates returns the ids of the expressions that Match would
+// evaluate for vars, in the order that they were added
+func (ix *Index) Candidates(vars map[string]*dlit.Literal) []string {
+	cs := ix.candidates(vars)
+	r := make([]string, len(cs))
+	for j, i := range cs {
+		r[j] = ix.ids[i]
+	}
+	return r
+}
+
+func (ix *Index) candidates(vars map[string]*dlit.Literal) []int {
+	isCandidate := make([]bool, len(ix.exprs))
+	for _, i := range ix.unindexed {
+		isCandidate[i] = true
+	}
+	for name, keys := range ix.eq {
+		if l, ok := vars[name]; ok && l.Err() == nil {
+			for _, i := range keys[eqKey(l)] {
+				isCandidate[i] = true
+			}
+		}
+	}
+	for name, bounds := range ix.lower {
+		if x, ok := numValue(vars[name]); ok {
+			n := sort.Search(len(bounds), func(i int) bool {
+				return bounds[i].value > x
+			})
+			if math.IsNaN(x) {
+				n = len(bounds)
+			}
+			for _, b := range bounds[:n] {
+				isCandidate[b.expr] = true
+			}
+		}
+	}
+	for name, bounds := range ix.upper {
+		if x, ok := numValue(vars[name]); ok {
+			n := sort.Search(len(bounds), func(i int) bool {
+				return bounds[i].value >= x
+			})
+			if math.IsNaN(x) {
+				n = 0
+			}
+			for _, b := range bounds[n:] {
+				isCandidate[b.expr] = true
+			}
+		}
+	}
+	r := []int{}
+	for i, ok := range isCandidate {
+		if ok {
+			r = append(r, i)
+		}
+	}
+	return r
+}
+
+// exprConditions returns the conditions of which at least one must be
+// true for n to be true
+func exprConditions(n Node) ([]condition, bool) {
+	operands := flattenChain(n, token.LOR)
+	conds := make([]condition, 0, len(operands))
+	for _, o := range operands {
+		c, ok := conjunctCondition(o)
+		if !ok {
+			return nil, false
+		}
+		conds = append(conds, c)
+	}
+	return conds, true
+}
+
+// conjunctCondition returns a condition that must be true for n to be
+// true from the operands of a chain of && operators.  These must all be
+// true because && returns an error if either operand isn't a bool.
+func conjunctCondition(n Node) (condition, bool) {
+	var rangeCond condition
+	hasRange := false
+	for _, o := range flattenChain(n, token.LAND) {
+		c, ok := comparisonCondition(o)
+		if !ok {
+			continue
+		}
+		if c.op == token.EQL {
+			return c, true
+		}
+		if !hasRange {
+			rangeCond, hasRange = c, true
+		}
+	}
+	return rangeCond, hasRange
+}
+
+// comparisonCondition returns the condition for a comparison of a
+// variable with a constant
+func comparisonCondition(n Node) (condition, bool) {
+	bn, ok := unparenNode(n).(*BinaryNode)
+	if !ok {
+		return condition{}, false
+	}
+	op := bn.Op
+	v, isVar := unparenNode(bn.X).(*VarNode)
+	l, isConst := constValue(bn.Y)
+	if !isVar || !isConst {
+		// Try the constant on the left such as 100 < amount
+		v, isVar = unparenNode(bn.Y).(*VarNode)
+		l, isConst = constValue(bn.X)
+		if !isVar || !isConst {
+			return condition{}, false
+		}
+		switch op {
+		case token.LSS:
+			op = token.GTR
+		case token.LEQ:
+			op = token.GEQ
+		case token.GTR:
+			op = token.LSS
+		case token.GEQ:
+			op = token.LEQ
+		}
+	}
+	if op == token.EQL {
+		return condition{varName: v.Name, op: token.EQL, key: eqKey(l)}, true
+	}
+	// The ordering operators only compare numbers
+	x, ok := numValue(l)
+	if !ok || math.IsNaN(x) {
+		return condition{}, false
+	}
+	switch op {
+	case token.GTR, token.GEQ:
+		return condition{varName: v.Name, op: token.GEQ, bound: x}, true
+	case token.LSS, token.LEQ:
+		return condition{varName: v.Name, op: token.LEQ, bound: x}, true
+	}
+	return condition{}, false
+}
+
+// numValue returns the value of l as a float64 if it is a number.  As
+// the conversion from int64 is monotonic, ordering int64s as float64s
+// never puts them the wrong way round, although they may become equal.
+func numValue(l *dlit.Literal) (float64, bool) {
+	if l == nil || l.Err() != nil {
+		return 0, false
+	}
+	if f, isFloat := l.Float(); isFloat {
+		return f, true
+	}
+	if i, isInt := l.Int(); isInt {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+// eqKey returns a key for l such that if opEql finds two values equal
+// they have the same key.  Numbers are keyed by their float64 value and
+// everything else by its string.
+func eqKey(l *dlit.Literal) string {
+	if x, ok := numValue(l); ok {
+		if x == 0 {
+			// Make -0 the same as 0
+			x = 0
+		}
+		return "n" + strconv.FormatFloat(x, 'g', -1, 64)
+	}
+	return "s" + l.String()
+}
@@ -0,0 +1,145 @@
+package dexpr
+
+import (
+	"fmt"
+	"github.com/lawrencewoodman/dlit"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+var indexTestExprs = []string{
+	"country == \"FR\"",
+	"country == \"FR\" && amount > 100",
+	"amount > 100 && country == \"DE\"",
+	"\"DE\" == country || country == \"UK\"",
+	"amount >= 50 && amount <= 200",
+	"100 < amount",
+	"amount < -5.5",
+	"amount == 100",
+	"amount == 100.0",
+	"amount != 100",
+	"tier == 2 && (amount > 10 || country == \"FR\")",
+	"country == \"FR\" || amount > 1000",
+	"country == \"FR\" || name != \"bob\"",
+	"name == \"bob\"",
+	"name == 7",
+	"amount > \"abc\"",
+	"flag",
+	"(country == \"ES\")",
+	"!(country == \"ES\")",
+	"amount / tier > 20",
+	"amount == -0.0",
+}
+
+func TestIndex(t *testing.T) {
+	ix := NewIndex()
+	for i, s := range indexTestExprs {
+		ix.Add(fmt.Sprintf("e%d", i), MustNew(s, map[string]CallFun{}))
+	}
+	if ix.Len() != len(indexTestExprs) {
+		t.Errorf("Len got: %d, want: %d", ix.Len(), len(indexTestExprs))
+	}
+	cases := []struct {
+		vars           map[string]*dlit.Literal
+		wantMatch      []string
+		wantCandidates []string
+	}{
+		{vars: map[string]*dlit.Literal{
+			"country": dlit.NewString("FR"),
+			"amount":  dlit.MustNew(150),
+		},
+			wantMatch: []string{"e0", "e1", "e4", "e5", "e9", "e11", "e18"},
+			wantCandidates: []string{
+				"e0", "e1", "e4", "e5", "e9", "e11", "e12", "e15", "e16", "e18",
+				"e19",
+			},
+		},
+		{vars: map[string]*dlit.Literal{
+			"country": dlit.NewString("UK"),
+			"amount":  dlit.MustNew(100),
+			"name":    dlit.NewString("bob"),
+			"tier":    dlit.MustNew(2),
+		},
+			wantMatch: []string{
+				"e3", "e4", "e7", "e8", "e10", "e13", "e18", "e19",
+			},
+			wantCandidates: []string{
+				"e3", "e4", "e5", "e7", "e8", "e9", "e10", "e12", "e13", "e15",
+				"e16", "e18", "e19",
+			},
+		},
+		{vars: map[string]*dlit.Literal{"amount": dlit.MustNew(0)},
+			wantMatch: []string{"e9", "e20"},
+			wantCandidates: []string{
+				"e9", "e12", "e15", "e16", "e18", "e19", "e20",
+			},
+		},
+	}
+	for _, c := range cases {
+		if got := ix.Match(c.vars); !reflect.DeepEqual(got, c.wantMatch) {
+			t.Errorf("Match(%v) got: %v, want: %v", c.vars, got, c.wantMatch)
+		}
+		if got := ix.Candidates(c.vars); !reflect.DeepEqual(got, c.wantCandidates) {
+			t.Errorf("Candidates(%v) got: %v, want: %v", c.vars, got,
+				c.wantCandidates)
+		}
+	}
+}
+
+// TestIndex_bruteForce checks that Match gives the same result as
+// evaluating every expression
+func TestIndex_bruteForce(t *testing.T) {
+	exprs := make([]*Expr, len(indexTestExprs))
+	ix := NewIndex()
+	for i, s := range indexTestExprs {
+		exprs[i] = MustNew(s, map[string]CallFun{})
+		ix.Add(fmt.Sprintf("e%d", i), exprs[i])
+	}
+	countries := []*dlit.Literal{
+		dlit.NewString("FR"), dlit.NewString("DE"), dlit.NewString("UK"),
+		dlit.NewString("ES"), dlit.MustNew(7),
+	}
+	amounts := []*dlit.Literal{
+		dlit.MustNew(-10), dlit.MustNew(-5.5), dlit.MustNew(-0.0),
+		dlit.MustNew(0), dlit.MustNew(50), dlit.MustNew(100),
+		dlit.MustNew(100.0), dlit.MustNew(100.5), dlit.MustNew(200),
+		dlit.MustNew(1001), dlit.NewString("100"), dlit.NewString("abc"),
+		dlit.NewString("1e3"),
+	}
+	others := []*dlit.Literal{
+		dlit.MustNew(2), dlit.MustNew(7), dlit.NewString("bob"),
+		dlit.MustNew(true), dlit.MustNew(false), dlit.NewString("7"),
+	}
+	pick := func(r *rand.Rand, ls []*dlit.Literal) (*dlit.Literal, bool) {
+		i := r.Intn(len(ls) + 1)
+		if i == len(ls) {
+			return nil, false
+		}
+		return ls[i], true
+	}
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 2000; n++ {
+		vars := map[string]*dlit.Literal{}
+		if l, ok := pick(r, countries); ok {
+			vars["country"] = l
+		}
+		if l, ok := pick(r, amounts); ok {
+			vars["amount"] = l
+		}
+		for _, name := range []string{"name", "tier", "flag"} {
+			if l, ok := pick(r, others); ok {
+				vars[name] = l
+			}
+		}
+		want := []string{}
+		for i, e := range exprs {
+			if isTrue, err := e.EvalBool(vars); err == nil && isTrue {
+				want = append(want, fmt.Sprintf("e%d", i))
+			}
+		}
+		if got := ix.Match(vars); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Match(%v) got: %v, want: %v", vars, got, want)
+		}
+	}
+}
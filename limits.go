@@ -0,0 +1,171 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"fmt"
+	"github.com/lawrencewoodman/dlit"
+)
+
+// Limits restricts the resources that a single evaluation of an
+// expression can use.  A field that is 0 isn't limited.
+type Limits struct {
+	// MaxNodes is the maximum number of nodes that can be evaluated
+	MaxNodes int
+	// MaxCalls is the maximum number of function calls
+	MaxCalls int
+	// MaxStringLen is the maximum length of a string produced while
+	// evaluating.  As dexpr has no string operators this applies to
+	// strings returned by functions.
+	MaxStringLen int
+	// MaxListLen is the maximum number of values in a list built while
+	// evaluating, which is the list of arguments passed to a function
+	MaxListLen int
+}
+
+// Limit identifies one of the fields of Limits
+type Limit int
+
+const (
+	LimitNodes Limit = iota + 1
+	LimitCalls
+	LimitStringLen
+	LimitListLen
+	LimitSourceLen
+	LimitDepth
+	LimitASTNodes
+	LimitLiteralLen
+	LimitElts
+)
+
+var limitNames = map[Limit]string{
+	LimitNodes:      "nodes",
+	LimitCalls:      "function calls",
+	LimitStringLen:  "string length",
+	LimitListLen:    "list length",
+	LimitSourceLen:  "source length",
+	LimitDepth:      "nesting depth",
+	LimitASTNodes:   "syntax tree nodes",
+	LimitLiteralLen: "literal length",
+	LimitElts:       "composite literal elements",
+}
+
+// DefaultMaxDepth is the maximum nesting depth of an expression used
+// when CompileLimits.MaxDepth is 0.  Deeper expressions risk exhausting
+// the stack when they are parsed, compiled or evaluated.
+const DefaultMaxDepth = 1000
+
+// DefaultMaxNodes is the maximum number of nodes in the syntax tree of
+// an expression used when CompileLimits.MaxNodes is 0.  A long chain of
+// operators such as a + b + c has a tree as deep as it is long, so
+// larger expressions risk exhausting the stack.
+const DefaultMaxNodes = 100000
+
+// CompileLimits restricts the expressions that New will compile, which
+// is useful when they come from an untrusted source.  A field that is 0
+// isn't limited, except for MaxDepth and MaxNodes which then use
+// DefaultMaxDepth and DefaultMaxNodes.  MaxDepth and MaxNodes aren't
+// limited if they are negative.
+type CompileLimits struct {
+	// MaxSourceLen is the maximum length of the expression in bytes
+	MaxSourceLen int
+	// MaxDepth is the maximum depth that operators, parentheses, calls,
+	// indexes and composite literals can be nested within each other.
+	// The operators of a chain such as a + b + c aren't counted as
+	// nested within each other, although the tree for the chain is as
+	// deep as it is long, so the length of a chain is limited by
+	// MaxNodes instead.
+	MaxDepth int
+	// MaxNodes is the maximum number of nodes in the syntax tree
+	MaxNodes int
+	// MaxLiteralLen is the maximum length of a literal as written
+	MaxLiteralLen int
+	// MaxElts is the maximum number of elements in a composite literal
+	MaxElts int
+}
+
+func (l Limit) String() string {
+	if name, ok := limitNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("Limit(%d)", int(l))
+}
+
+// LimitError indicates that an evaluation was stopped because it
+// exceeded one of its Limits
+type LimitError struct {
+	Limit Limit
+	Max   int
+}
+
+func (e LimitError) Error() string {
+	return fmt.Sprintf("evaluation limit exceeded: %s > %d", e.Limit, e.Max)
+}
+
+// CompileLimitError indicates that New wouldn't compile an expression
+// because it exceeded one of its CompileLimits
+type CompileLimitError struct {
+	Limit Limit
+	Max   int
+}
+
+func (e CompileLimitError) Error() string {
+	return fmt.Sprintf("compile limit exceeded: %s > %d", e.Limit, e.Max)
+}
+
+// LimitCompile returns an Option to set the CompileLimits used by New
+func LimitCompile(limits CompileLimits) Option {
+	return func(o *options) {
+		o.compileLimits = limits
+	}
+}
+
+// maxDepth returns the maximum nesting depth or 0 if it isn't limited
+func (l CompileLimits) maxDepth() int {
+	if l.MaxDepth == 0 {
+		return DefaultMaxDepth
+	} else if l.MaxDepth < 0 {
+		return 0
+	}
+	return l.MaxDepth
+}
+
+// maxNodes returns the maximum number of nodes or 0 if it isn't limited
+func (l CompileLimits) maxNodes() int {
+	if l.MaxNodes == 0 {
+		return DefaultMaxNodes
+	} else if l.MaxNodes < 0 {
+		return 0
+	}
+	return l.MaxNodes
+}
+
+// EvalLimits returns an Option to set the Limits used each time
+// the expression is evaluated
+func EvalLimits(limits Limits) Option {
+	return func(o *options) {
+		o.limits = limits
+	}
+}
+
+// EvalWithLimits evaluates the expression in the same way as Eval
+// but uses limits instead of the expression's Limits
+func (expr *Expr) EvalWithLimits(
+	vars map[string]*dlit.Literal,
+	limits Limits,
+) *dlit.Literal {
+	return expr.eval(vars, expr.newEvalState(nil, limits))
+}
+
+// EvalBoolWithLimits evaluates the expression in the same way as EvalBool
+// but uses limits instead of the expression's Limits
+func (expr *Expr) EvalBoolWithLimits(
+	vars map[string]*dlit.Literal,
+	limits Limits,
+) (bool, error) {
+	return expr.evalBool(vars, expr.newEvalState(nil, limits))
+}
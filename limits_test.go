@@ -0,0 +1,207 @@
+package dexpr
+
+import (
+	"errors"
+	"github.com/lawrencewoodman/dlit"
+	"strings"
+	"testing"
+)
+
+func TestEvalWithLimits(t *testing.T) {
+	cases := []struct {
+		in      string
+		limits  Limits
+		want    *dlit.Literal
+		wantErr error
+	}{
+		{in: "a + b + 3", limits: Limits{MaxNodes: 5}, want: dlit.MustNew(10)},
+		{in: "a + b + 3",
+			limits:  Limits{MaxNodes: 4},
+			wantErr: LimitError{Limit: LimitNodes, Max: 4},
+		},
+		{in: "first(a) + first(b)",
+			limits: Limits{MaxCalls: 2},
+			want:   dlit.MustNew(7),
+		},
+		{in: "first(a) + first(first(b))",
+			limits:  Limits{MaxCalls: 2},
+			wantErr: LimitError{Limit: LimitCalls, Max: 2},
+		},
+		{in: "repeat(\"ab\", 3) == \"ababab\"",
+			limits: Limits{MaxStringLen: 6},
+			want:   dlit.MustNew(true),
+		},
+		{in: "repeat(\"ab\", 4) == \"abababab\"",
+			limits:  Limits{MaxStringLen: 6},
+			wantErr: LimitError{Limit: LimitStringLen, Max: 6},
+		},
+		{in: "first(a, b, 5)",
+			limits: Limits{MaxListLen: 3},
+			want:   dlit.MustNew(4),
+		},
+		{in: "first(a, b, 5, 6)",
+			limits:  Limits{MaxListLen: 3},
+			wantErr: LimitError{Limit: LimitListLen, Max: 3},
+		},
+	}
+	vars := map[string]*dlit.Literal{
+		"a": dlit.MustNew(4),
+		"b": dlit.MustNew(3),
+	}
+	funcs := map[string]CallFun{"first": first, "repeat": repeat}
+	for _, c := range cases {
+		expr := MustNew(c.in, funcs)
+		got := expr.EvalWithLimits(vars, c.limits)
+		if c.wantErr != nil {
+			wantErr := InvalidExprError{c.in, c.wantErr}
+			if got.Err() != wantErr {
+				t.Errorf("EvalWithLimits in: %s, err: %v, want: %v",
+					c.in, got.Err(), wantErr)
+			}
+			continue
+		}
+		if got.String() != c.want.String() {
+			t.Errorf("EvalWithLimits in: %s, got: %s, want: %s", c.in, got, c.want)
+		}
+		// Without limits nothing should change
+		if got := expr.Eval(vars); got.String() != c.want.String() {
+			t.Errorf("Eval in: %s, got: %s, want: %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestEvalBool_exprLimits(t *testing.T) {
+	in := "a > 1 && b > 1 && a > b"
+	vars := map[string]*dlit.Literal{
+		"a": dlit.MustNew(4),
+		"b": dlit.MustNew(3),
+	}
+	expr := MustNew(in, map[string]CallFun{}, EvalLimits(Limits{MaxNodes: 10}))
+	_, err := expr.EvalBool(vars)
+	var lerr LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != LimitNodes {
+		t.Errorf("EvalBool - err: %v, want a LimitError for LimitNodes", err)
+	}
+
+	// Per call limits replace those of the Expr
+	got, err := expr.EvalBoolWithLimits(vars, Limits{MaxNodes: 11})
+	if err != nil || !got {
+		t.Errorf("EvalBoolWithLimits - got: %t, err: %v, want: true", got, err)
+	}
+
+	expr.Limits = Limits{}
+	got, err = expr.EvalBool(vars)
+	if err != nil || !got {
+		t.Errorf("EvalBool - got: %t, err: %v, want: true", got, err)
+	}
+}
+
+func TestNew_compileLimits(t *testing.T) {
+	nest := func(open, in, close string, n int) string {
+		return strings.Repeat(open, n) + in + strings.Repeat(close, n)
+	}
+	cases := []struct {
+		in      string
+		limits  CompileLimits
+		wantErr error
+	}{
+		{in: nest("(", "1", ")", 10000),
+			wantErr: CompileLimitError{Limit: LimitDepth, Max: DefaultMaxDepth},
+		},
+		{in: nest("!", "a", "", 100000),
+			wantErr: CompileLimitError{Limit: LimitDepth, Max: DefaultMaxDepth},
+		},
+		// A flat chain of left associative operators isn't nesting
+		{in: "a" + strings.Repeat(" + a", 5000)},
+		{in: "a" + strings.Repeat(" + a * b", 5000)},
+		{in: "1" + strings.Repeat(" + (1", 5000) + strings.Repeat(")", 5000),
+			wantErr: CompileLimitError{Limit: LimitDepth, Max: DefaultMaxDepth},
+		},
+		{in: "a" + strings.Repeat(" - a", 5000), limits: CompileLimits{MaxDepth: 2}},
+		{in: nest("(", "1", ")", 3000), limits: CompileLimits{MaxDepth: -1}},
+		{in: "f" + strings.Repeat("(1)", 5000),
+			wantErr: CompileLimitError{Limit: LimitDepth, Max: DefaultMaxDepth},
+		},
+		{in: nest("[]", "lit{1}[0]", "", 5000),
+			wantErr: CompileLimitError{Limit: LimitDepth, Max: DefaultMaxDepth},
+		},
+		{in: nest("f(", "1", ")", 5000),
+			wantErr: CompileLimitError{Limit: LimitDepth, Max: DefaultMaxDepth},
+		},
+		{in: nest("(", "1", ")", 2000), limits: CompileLimits{MaxDepth: 2001}},
+		{in: "1 + 2 * -3", limits: CompileLimits{MaxDepth: 3}},
+		{in: "-(-(1)) * 3",
+			limits:  CompileLimits{MaxDepth: 3},
+			wantErr: CompileLimitError{Limit: LimitDepth, Max: 3},
+		},
+		{in: "a + b", limits: CompileLimits{MaxSourceLen: 5}},
+		{in: "a + bc",
+			limits:  CompileLimits{MaxSourceLen: 5},
+			wantErr: CompileLimitError{Limit: LimitSourceLen, Max: 5},
+		},
+		// A chain too long to compile without exhausting the stack
+		{in: "1" + strings.Repeat("+1", 2000000),
+			wantErr: CompileLimitError{Limit: LimitASTNodes, Max: DefaultMaxNodes},
+		},
+		{in: "a" + strings.Repeat(" + a", DefaultMaxNodes/2-1)},
+		{in: "a" + strings.Repeat(" + a", DefaultMaxNodes/2),
+			wantErr: CompileLimitError{Limit: LimitASTNodes, Max: DefaultMaxNodes},
+		},
+		{in: "a" + strings.Repeat(" + a", DefaultMaxNodes),
+			limits: CompileLimits{MaxNodes: -1},
+		},
+		{in: "a + b * c", limits: CompileLimits{MaxNodes: 5}},
+		{in: "a + b * (c)",
+			limits:  CompileLimits{MaxNodes: 5},
+			wantErr: CompileLimitError{Limit: LimitASTNodes, Max: 5},
+		},
+		{in: "\"abc\" == 1234", limits: CompileLimits{MaxLiteralLen: 5}},
+		{in: "f(\"abcd\") == 1",
+			limits:  CompileLimits{MaxLiteralLen: 5},
+			wantErr: CompileLimitError{Limit: LimitLiteralLen, Max: 5},
+		},
+		{in: "123456 == 1",
+			limits:  CompileLimits{MaxLiteralLen: 5},
+			wantErr: CompileLimitError{Limit: LimitLiteralLen, Max: 5},
+		},
+		{in: "[]lit{1, 2, 3}[0] == 1", limits: CompileLimits{MaxElts: 3}},
+		{in: "[]lit{1, 2, 3, 4}[0] == 1",
+			limits:  CompileLimits{MaxElts: 3},
+			wantErr: CompileLimitError{Limit: LimitElts, Max: 3},
+		},
+	}
+	funcs := map[string]CallFun{}
+	for _, c := range cases {
+		_, err := New(c.in, funcs, LimitCompile(c.limits))
+		if c.wantErr == nil {
+			if err != nil {
+				t.Errorf("New(%.20s) err: %s", c.in, err)
+			}
+			continue
+		}
+		wantErr := InvalidExprError{c.in, c.wantErr}
+		if err != wantErr {
+			t.Errorf("New(%.20s) err: %.80v, want: %.80v", c.in, err, wantErr)
+		}
+	}
+}
+
+/**********************************
+ *    Helper functions
+ **********************************/
+func first(args []*dlit.Literal) (*dlit.Literal, error) {
+	if len(args) == 0 {
+		err := errors.New("no arguments")
+		return dlit.MustNew(err), err
+	}
+	return args[0], nil
+}
+
+func repeat(args []*dlit.Literal) (*dlit.Literal, error) {
+	n, isInt := args[1].Int()
+	if !isInt {
+		err := errors.New("can't convert to int")
+		return dlit.MustNew(err), err
+	}
+	return dlit.NewString(strings.Repeat(args[0].String(), int(n))), nil
+}
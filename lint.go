@@ -0,0 +1,318 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"sort"
+)
+
+// Severity is how serious a Diagnostic is
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// The codes used by the linter to identify each kind of Diagnostic
+const (
+	CodeInvalid          = "invalid"            // the expression can't be compiled
+	CodeConstCompare     = "const-compare"      // comparison of two constants
+	CodeSelfCompare      = "self-compare"       // comparison of an operand with itself
+	CodeNumStringCompare = "num-string-compare" // number compared with a string
+	CodeUnreachable      = "unreachable"        // operand of && or || never needed
+	CodeFloatEquality    = "float-equality"     // == or != with a float
+	CodeDivByZero        = "div-by-zero"        // division by a literal zero
+	CodeRedundantParens  = "redundant-parens"   // parentheses that aren't needed
+	CodeDeepNesting      = "deep-nesting"       // brackets nested too deeply
+)
+
+// Diagnostic is a problem found by the linter
+type Diagnostic struct {
+	Pos      Position
+	End      Position
+	Severity Severity
+	Code     string
+	Msg      string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s [%s]", d.Pos, d.Severity, d.Msg, d.Code)
+}
+
+// defaultMaxDepth is the MaxDepth used if a Linter's is 0
+const defaultMaxDepth = 4
+
+// Linter checks expressions for likely mistakes that aren't errors
+// such as comparisons that are always true
+type Linter struct {
+	// MaxDepth is the deepest that parentheses, function calls and
+	// composite literals may be nested within each other.  If 0 the
+	// default of 4 is used.
+	MaxDepth int
+}
+
+// Lint checks expr using the default Linter
+func (expr *Expr) Lint() []Diagnostic {
+	return Linter{}.Lint(expr)
+}
+
+// Lint returns the problems found in expr ordered by position
+func (l Linter) Lint(expr *Expr) []Diagnostic {
+	maxDepth := l.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = defaultMaxDepth
+	}
+	ls := &lintState{maxDepth: maxDepth, chains: map[Node]bool{}}
+	ls.lint(expr.Node, nil, 0)
+	sort.SliceStable(ls.diags, func(i, j int) bool {
+		return ls.diags[i].Pos.Offset < ls.diags[j].Pos.Offset
+	})
+	return ls.diags
+}
+
+// LintSource compiles src using New and returns the problems found in
+// it.  If it can't be compiled the error is returned as a Diagnostic
+// with the code CodeInvalid.
+func (l Linter) LintSource(
+	src string,
+	callFuncs map[string]CallFun,
+	opts ...Option,
+) []Diagnostic {
+	expr, err := New(src, callFuncs, opts...)
+	if err != nil {
+		d := Diagnostic{
+			Pos:      Position{Offset: 0, Line: 1, Column: 1},
+			End:      newPosition(src, len(src)),
+			Severity: SeverityError,
+			Code:     CodeInvalid,
+			Msg:      err.Error(),
+		}
+		var derr DialectError
+		if errors.As(err, &derr) {
+			d.Pos = derr.Pos
+			d.End = derr.Pos
+		}
+		return []Diagnostic{d}
+	}
+	return l.Lint(expr)
+}
+
+type lintState struct {
+	maxDepth int
+	diags    []Diagnostic
+	// chains holds the nodes of chains of && or || already checked
+	chains map[Node]bool
+}
+
+func (ls *lintState) add(n Node, severity Severity, code string,
+	format string, a ...interface{}) {
+	ls.diags = append(ls.diags, Diagnostic{
+		Pos:      n.Pos(),
+		End:      n.End(),
+		Severity: severity,
+		Code:     code,
+		Msg:      fmt.Sprintf(format, a...),
+	})
+}
+
+// lint checks n whose parent is parent and which is nested depth
+// brackets deep.  Once the depth is too deep it is set to -1 so that
+// deeper nodes aren't also reported.
+func (ls *lintState) lint(n Node, parent Node, depth int) {
+	switch n.(type) {
+	case *ParenNode, *CallNode, *ListNode, *IndexNode:
+		if depth >= 0 {
+			depth++
+		}
+		if depth > ls.maxDepth {
+			ls.add(n, SeverityInfo, CodeDeepNesting,
+				"nested %d deep, more than %d", depth, ls.maxDepth)
+			depth = -1
+		}
+	}
+	switch x := n.(type) {
+	case *ParenNode:
+		if !parenNeeded(x, parent) {
+			ls.add(x, SeverityInfo, CodeRedundantParens,
+				"parentheses around %s aren't needed", Format(x.X))
+		}
+		ls.lint(x.X, x, depth)
+	case *UnaryNode:
+		ls.lint(x.X, x, depth)
+	case *BinaryNode:
+		ls.lintBinary(x)
+		ls.lint(x.X, x, depth)
+		ls.lint(x.Y, x, depth)
+	case *CallNode:
+		for _, arg := range x.Args {
+			ls.lint(arg, x, depth)
+		}
+	case *ListNode:
+		for _, elt := range x.Elts {
+			ls.lint(elt, x, depth)
+		}
+	case *IndexNode:
+		ls.lint(x.X, x, depth)
+		ls.lint(x.Index, x, depth)
+	}
+}
+
+func (ls *lintState) lintBinary(bn *BinaryNode) {
+	switch {
+	case isComparisonOp(bn.Op):
+		ls.lintComparison(bn)
+	case bn.Op == token.LAND || bn.Op == token.LOR:
+		ls.lintChain(bn)
+	case bn.Op == token.QUO:
+		if l, ok := constValue(bn.Y); ok {
+			if f, isFloat := l.Float(); isFloat && f == 0 {
+				ls.add(bn, SeverityError, CodeDivByZero,
+					"%s always divides by zero", Format(bn))
+			}
+		}
+	}
+}
+
+func (ls *lintState) lintComparison(bn *BinaryNode) {
+	src := Format(bn)
+	lx, xIsConst := constValue(bn.X)
+	ly, yIsConst := constValue(bn.Y)
+	if xIsConst && yIsConst {
+		if (bn.Op == token.EQL || bn.Op == token.NEQ) &&
+			(isNumLit(bn.X) && isNonNumStringLit(bn.Y) ||
+				isNonNumStringLit(bn.X) && isNumLit(bn.Y)) {
+			ls.add(bn, SeverityWarning, CodeNumStringCompare,
+				"%s compares a number with a non-numeric string so is always %t",
+				src, bn.Op == token.NEQ)
+			return
+		}
+		v := binaryFns[bn.Op](litValue(lx), litValue(ly))
+		if b, isBool := v.Bool(); v.Err() == nil && isBool {
+			ls.add(bn, SeverityWarning, CodeConstCompare,
+				"%s is always %t", src, b)
+		}
+		return
+	}
+	if !hasCall(bn) && Format(bn.X) == Format(bn.Y) {
+		isTrue := bn.Op == token.EQL || bn.Op == token.LEQ ||
+			bn.Op == token.GEQ
+		ls.add(bn, SeverityWarning, CodeSelfCompare,
+			"%s compares an operand with itself so is always %t", src, isTrue)
+		return
+	}
+	if (bn.Op == token.EQL || bn.Op == token.NEQ) &&
+		(isFloatNode(bn.X) || isFloatNode(bn.Y)) {
+		ls.add(bn, SeverityWarning, CodeFloatEquality,
+			"%s tests floats for equality which may fail because of rounding",
+			src)
+	}
+}
+
+// lintChain checks a chain of && or || operators for an operand that
+// decides the result on its own, so the other operands aren't needed
+func (ls *lintState) lintChain(bn *BinaryNode) {
+	if ls.chains[bn] {
+		return
+	}
+	markChain(bn, bn.Op, ls.chains)
+	// The value of && when an operand is false and || when an
+	// operand is true
+	decider := bn.Op == token.LOR
+	for _, o := range flattenChain(bn, bn.Op) {
+		if b, ok := boolConst(o); ok && b == decider {
+			ls.add(o, SeverityWarning, CodeUnreachable,
+				"%s is always %t so the other operands of %s are never needed",
+				Format(o), b, bn.Op)
+			return
+		}
+	}
+}
+
+// markChain records each node of a chain of op operators in chains
+func markChain(n Node, op token.Token, chains map[Node]bool) {
+	if bn, ok := unparenNode(n).(*BinaryNode); ok && bn.Op == op {
+		chains[bn] = true
+		markChain(bn.X, op, chains)
+		markChain(bn.Y, op, chains)
+	}
+}
+
+// parenNeeded returns whether the parentheses of p are needed because
+// of where it is in the tree
+func parenNeeded(p *ParenNode, parent Node) bool {
+	switch p.X.(type) {
+	case *BinaryNode:
+		switch x := parent.(type) {
+		case *UnaryNode:
+			return true
+		case *BinaryNode:
+			return needParens(p, x, p == x.Y)
+		case *IndexNode:
+			return p == x.X
+		}
+	case *UnaryNode:
+		switch x := parent.(type) {
+		case *UnaryNode:
+			// Keeps -(-a) from becoming --a
+			return true
+		case *IndexNode:
+			return p == x.X
+		}
+	}
+	return false
+}
+
+func isNumLit(n Node) bool {
+	switch x := unparenNode(n).(type) {
+	case *LitNode:
+		return x.Kind == token.INT || x.Kind == token.FLOAT
+	case *UnaryNode:
+		return x.Op == token.SUB && isNumLit(x.X)
+	}
+	return false
+}
+
+func isNonNumStringLit(n Node) bool {
+	l, ok := unparenNode(n).(*LitNode)
+	if !ok || l.Kind != token.STRING {
+		return false
+	}
+	_, isFloat := l.Value.Float()
+	return !isFloat
+}
+
+// isFloatNode returns whether n is a float literal or arithmetic that
+// uses one or divides
+func isFloatNode(n Node) bool {
+	switch x := unparenNode(n).(type) {
+	case *LitNode:
+		return x.Kind == token.FLOAT
+	case *UnaryNode:
+		return x.Op == token.SUB && isFloatNode(x.X)
+	case *BinaryNode:
+		return isArithOp(x.Op) &&
+			(x.Op == token.QUO || isFloatNode(x.X) || isFloatNode(x.Y))
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package dexpr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{in: "a > 5 && b == \"x\"", want: []string{}},
+		{in: "x == x",
+			want: []string{
+				"1:1: warning: x == x compares an operand with itself " +
+					"so is always true [self-compare]",
+			},
+		},
+		{in: "a + 1 < a + 1",
+			want: []string{
+				"1:1: warning: a + 1 < a + 1 compares an operand with itself " +
+					"so is always false [self-compare]",
+			},
+		},
+		{in: "f(a) == f(a)", want: []string{}},
+		{in: "a && 1 > 2",
+			want: []string{
+				"1:6: warning: 1 > 2 is always false [const-compare]",
+			},
+		},
+		{in: "5 == \"abc\"",
+			want: []string{
+				"1:1: warning: 5 == \"abc\" compares a number with a non-numeric " +
+					"string so is always false [num-string-compare]",
+			},
+		},
+		{in: "5 == \"5\"",
+			want: []string{"1:1: warning: 5 == \"5\" is always true [const-compare]"},
+		},
+		{in: "a && b && false && c",
+			want: []string{
+				"1:11: warning: false is always false so the other operands " +
+					"of && are never needed [unreachable]",
+			},
+		},
+		{in: "a || (b || true)",
+			want: []string{
+				"1:12: warning: true is always true so the other operands " +
+					"of || are never needed [unreachable]",
+			},
+		},
+		{in: "true && a", want: []string{}},
+		{in: "a == 0.1",
+			want: []string{
+				"1:1: warning: a == 0.1 tests floats for equality which may " +
+					"fail because of rounding [float-equality]",
+			},
+		},
+		{in: "a / b != c",
+			want: []string{
+				"1:1: warning: a / b != c tests floats for equality which may " +
+					"fail because of rounding [float-equality]",
+			},
+		},
+		{in: "a / 0 + b / 0.0",
+			want: []string{
+				"1:1: error: a / 0 always divides by zero [div-by-zero]",
+				"1:9: error: b / 0.0 always divides by zero [div-by-zero]",
+			},
+		},
+		{in: "((a)) + (b * c) + (d + e) * -(-f) + (-g)",
+			want: []string{
+				"1:1: info: parentheses around a aren't needed [redundant-parens]",
+				"1:2: info: parentheses around a aren't needed [redundant-parens]",
+				"1:9: info: parentheses around b * c aren't needed " +
+					"[redundant-parens]",
+				"1:37: info: parentheses around -g aren't needed " +
+					"[redundant-parens]",
+			},
+		},
+		{in: "a - (b - c) * d + -(-e) + []lit{1, 2}[0]",
+			want: []string{},
+		},
+		{in: "f(g(h(i(j(k(1))))))",
+			want: []string{
+				"1:9: info: nested 5 deep, more than 4 [deep-nesting]",
+			},
+		},
+	}
+	funcs := map[string]CallFun{
+		"f": nil, "g": nil, "h": nil, "i": nil, "j": nil, "k": nil,
+	}
+	for _, c := range cases {
+		got := []string{}
+		for _, d := range MustNew(c.in, funcs).Lint() {
+			got = append(got, d.String())
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Lint(%s) got: %q, want: %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestLinter_maxDepth(t *testing.T) {
+	expr := MustNew("((a + b) * c) - d", map[string]CallFun{})
+	got := Linter{MaxDepth: 1}.Lint(expr)
+	want := []Diagnostic{
+		{
+			Pos:      Position{Offset: 0, Line: 1, Column: 1},
+			End:      Position{Offset: 13, Line: 1, Column: 14},
+			Severity: SeverityInfo,
+			Code:     CodeRedundantParens,
+			Msg:      "parentheses around (a + b) * c aren't needed",
+		},
+		{
+			Pos:      Position{Offset: 1, Line: 1, Column: 2},
+			End:      Position{Offset: 8, Line: 1, Column: 9},
+			Severity: SeverityInfo,
+			Code:     CodeDeepNesting,
+			Msg:      "nested 2 deep, more than 1",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lint got: %v, want: %v", got, want)
+	}
+}
+
+func TestLinter_LintSource(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []Diagnostic
+	}{
+		{in: "a == a",
+			want: []Diagnostic{
+				{
+					Pos:      Position{Offset: 0, Line: 1, Column: 1},
+					End:      Position{Offset: 6, Line: 1, Column: 7},
+					Severity: SeverityWarning,
+					Code:     CodeSelfCompare,
+					Msg:      "a == a compares an operand with itself so is always true",
+				},
+			},
+		},
+		{in: "a +",
+			want: []Diagnostic{
+				{
+					Pos:      Position{Offset: 0, Line: 1, Column: 1},
+					End:      Position{Offset: 3, Line: 1, Column: 4},
+					Severity: SeverityError,
+					Code:     CodeInvalid,
+					Msg:      "invalid expression: a + (syntax error)",
+				},
+			},
+		},
+	}
+	for _, c := range cases {
+		got := Linter{}.LintSource(c.in, map[string]CallFun{})
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("LintSource(%s) got: %v, want: %v", c.in, got, c.want)
+		}
+	}
+}
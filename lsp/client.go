@@ -0,0 +1,160 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// Notification is a notification sent by the server
+type Notification struct {
+	Method string
+	Params json.RawMessage
+}
+
+// Client is a simple client to talk to a Server.  It handles one
+// request at a time and keeps any notifications received while waiting
+// for a response.  Messages from the server are read as soon as they
+// arrive so that the server never blocks writing to the client.
+type Client struct {
+	w             io.Writer
+	nextID        int
+	notifications []Notification
+
+	mu sync.Mutex
+	// received is signalled when a message is added to queue or
+	// reading stops
+	received *sync.Cond
+	queue    []*message
+	readErr  error
+}
+
+// NewClient returns a Client that reads from r and writes to w
+func NewClient(r io.Reader, w io.Writer) *Client {
+	c := &Client{w: w}
+	c.received = sync.NewCond(&c.mu)
+	go c.readMessages(bufio.NewReader(r))
+	return c
+}
+
+func (c *Client) readMessages(r *bufio.Reader) {
+	for {
+		m, err := readMessage(r)
+		c.mu.Lock()
+		if err != nil {
+			c.readErr = err
+		} else {
+			c.queue = append(c.queue, m)
+		}
+		c.received.Broadcast()
+		c.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// next returns the next message from the server
+func (c *Client) next() (*message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.queue) == 0 && c.readErr == nil {
+		c.received.Wait()
+	}
+	if len(c.queue) == 0 {
+		return nil, c.readErr
+	}
+	m := c.queue[0]
+	c.queue = c.queue[1:]
+	return m, nil
+}
+
+// Call sends a request and decodes the result of the response into
+// result, which may be nil to ignore it.  If the server returns an error
+// it is returned as a *ResponseError.
+func (c *Client) Call(method string, params, result interface{}) error {
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	m := &message{ID: &id, Method: method}
+	if err := c.setParams(m, params); err != nil {
+		return err
+	}
+	if err := writeMessage(c.w, m); err != nil {
+		return err
+	}
+	for {
+		resp, err := c.next()
+		if err != nil {
+			return err
+		}
+		if resp.ID == nil {
+			c.notifications = append(c.notifications,
+				Notification{Method: resp.Method, Params: resp.Params})
+			continue
+		}
+		if string(*resp.ID) != string(id) {
+			continue
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(resp.Result, result)
+	}
+}
+
+// Notify sends a notification
+func (c *Client) Notify(method string, params interface{}) error {
+	m := &message{Method: method}
+	if err := c.setParams(m, params); err != nil {
+		return err
+	}
+	return writeMessage(c.w, m)
+}
+
+// WaitNotification returns the params of the next notification with
+// the given method, waiting for one if it hasn't already been received
+func (c *Client) WaitNotification(method string) (json.RawMessage, error) {
+	for i, n := range c.notifications {
+		if n.Method == method {
+			c.notifications = append(c.notifications[:i], c.notifications[i+1:]...)
+			return n.Params, nil
+		}
+	}
+	for {
+		m, err := c.next()
+		if err != nil {
+			return nil, err
+		}
+		if m.ID != nil {
+			continue
+		}
+		if m.Method == method {
+			return m.Params, nil
+		}
+		c.notifications = append(c.notifications,
+			Notification{Method: m.Method, Params: m.Params})
+	}
+}
+
+func (c *Client) setParams(m *message, params interface{}) error {
+	if params == nil {
+		return nil
+	}
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	m.Params = b
+	return nil
+}
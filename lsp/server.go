@@ -0,0 +1,471 @@
+/*
+ * A Language Server Protocol server for dexpr rule files
+ *
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/lawrencewoodman/dexpr"
+	"io"
+	"sort"
+	"strings"
+)
+
+// FuncInfo describes a function for hover and completion
+type FuncInfo struct {
+	// Signature shows how the function is called such as roundto(x, dp)
+	Signature string
+	Doc       string
+}
+
+// Config describes the functions and variables that the rules in a
+// rule file may use
+type Config struct {
+	CallFuncs map[string]dexpr.CallFun
+	// FuncInfo describes the functions in CallFuncs by name
+	FuncInfo map[string]FuncInfo
+	// Vars are the variables supplied when the rules are evaluated
+	// along with a description of each.  The names of the rules in the
+	// file can also be used as variables.
+	Vars map[string]string
+	// Formatter is used to format the expression of each rule
+	Formatter dexpr.Formatter
+}
+
+// Server is a Language Server Protocol server for rule files as parsed
+// by dexpr.ParseRules.  It provides diagnostics, hover, completion,
+// formatting and go to definition of rules.
+type Server struct {
+	cfg      Config
+	docs     map[string]string
+	out      io.Writer
+	shutdown bool
+}
+
+// NewServer returns a Server using cfg
+func NewServer(cfg Config) *Server {
+	if cfg.CallFuncs == nil {
+		cfg.CallFuncs = map[string]dexpr.CallFun{}
+	}
+	return &Server{cfg: cfg, docs: map[string]string{}}
+}
+
+// Serve reads requests from in and writes responses to out until an
+// exit notification is received or in is closed
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	r := bufio.NewReader(in)
+	s.out = out
+	for {
+		m, err := readMessage(r)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if m.Method == "exit" {
+			return nil
+		}
+		result, rerr := s.handle(m)
+		if m.ID == nil {
+			continue
+		}
+		resp := &message{ID: m.ID, Error: rerr}
+		if rerr == nil {
+			if resp.Result, err = json.Marshal(result); err != nil {
+				return err
+			}
+		}
+		if err := writeMessage(out, resp); err != nil {
+			return err
+		}
+	}
+}
+
+// handle handles a request or notification and returns the result
+func (s *Server) handle(m *message) (interface{}, *ResponseError) {
+	if s.shutdown {
+		return nil, &ResponseError{
+			Code:    CodeInvalidRequest,
+			Message: "server has been shut down",
+		}
+	}
+	switch m.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           1,
+				"hoverProvider":              true,
+				"completionProvider":         map[string]interface{}{},
+				"documentFormattingProvider": true,
+				"definitionProvider":         true,
+			},
+			"serverInfo": map[string]string{"name": "dexpr"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var p DidOpenTextDocumentParams
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.docs[p.TextDocument.URI] = p.TextDocument.Text
+		return nil, s.publishDiagnostics(p.TextDocument.URI)
+	case "textDocument/didChange":
+		var p DidChangeTextDocumentParams
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			s.docs[p.TextDocument.URI] = p.ContentChanges[n-1].Text
+		}
+		return nil, s.publishDiagnostics(p.TextDocument.URI)
+	case "textDocument/didClose":
+		var p DidCloseTextDocumentParams
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return nil, nil
+	case "textDocument/hover":
+		var p TextDocumentPositionParams
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.hover(p), nil
+	case "textDocument/completion":
+		var p TextDocumentPositionParams
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.completion(p), nil
+	case "textDocument/definition":
+		var p TextDocumentPositionParams
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.definition(p), nil
+	case "textDocument/formatting":
+		var p DocumentFormattingParams
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.formatting(p), nil
+	}
+	if m.ID == nil {
+		// Unknown notifications are ignored
+		return nil, nil
+	}
+	return nil, &ResponseError{
+		Code:    CodeMethodNotFound,
+		Message: fmt.Sprintf("method not found: %s", m.Method),
+	}
+}
+
+func invalidParams(err error) *ResponseError {
+	return &ResponseError{Code: CodeInvalidParams, Message: err.Error()}
+}
+
+// notify sends a notification to the client
+func (s *Server) notify(method string, params interface{}) *ResponseError {
+	b, err := json.Marshal(params)
+	if err == nil {
+		err = writeMessage(s.out, &message{Method: method, Params: b})
+	}
+	if err != nil {
+		return &ResponseError{Code: CodeInvalidRequest, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) publishDiagnostics(uri string) *ResponseError {
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: s.diagnostics(s.docs[uri]),
+	})
+}
+
+// diagnostics returns the problems found by dexpr.Linter in each rule
+// of text, which includes any that can't be compiled
+func (s *Server) diagnostics(text string) []Diagnostic {
+	diags := []Diagnostic{}
+	rules, err := dexpr.ParseRules(text)
+	if err != nil {
+		d := Diagnostic{Severity: SeverityError, Source: "dexpr", Message: err.Error()}
+		if ferr, ok := err.(dexpr.RuleFileError); ok {
+			d.Range = toRange(text, ferr.Pos.Offset, ferr.Pos.Offset)
+			d.Message = ferr.Msg
+		}
+		return append(diags, d)
+	}
+	for _, r := range rules {
+		for _, ld := range (dexpr.Linter{}).LintSource(r.Expr, s.cfg.CallFuncs) {
+			diags = append(diags, Diagnostic{
+				Range: toRange(text, r.FilePos(ld.Pos).Offset,
+					r.FilePos(ld.End).Offset),
+				Severity: toSeverity(ld.Severity),
+				Code:     ld.Code,
+				Source:   "dexpr",
+				Message:  fmt.Sprintf("%s: %s", r.Name, ld.Msg),
+			})
+		}
+	}
+	return diags
+}
+
+func toSeverity(s dexpr.Severity) int {
+	switch s {
+	case dexpr.SeverityError:
+		return SeverityError
+	case dexpr.SeverityWarning:
+		return SeverityWarning
+	}
+	return SeverityInformation
+}
+
+// ref is a reference found at a position in a document
+type ref struct {
+	// rule is the rule that the position is within
+	rule dexpr.RuleSource
+	// node is the *dexpr.VarNode or *dexpr.CallNode at the position, or
+	// nil if the position is on the name of rule
+	node dexpr.Node
+	// start and end are the offsets of the name within the document
+	start, end int
+}
+
+// findRef returns the reference at offset in rules
+func (s *Server) findRef(rules []dexpr.RuleSource, offset int) (ref, bool) {
+	for _, r := range rules {
+		nameEnd := r.NamePos.Offset + len(r.Name)
+		if offset >= r.NamePos.Offset && offset <= nameEnd {
+			return ref{rule: r, start: r.NamePos.Offset, end: nameEnd}, true
+		}
+		if offset < r.ExprPos.Offset || offset > r.ExprPos.Offset+len(r.Expr) {
+			continue
+		}
+		expr, err := dexpr.New(r.Expr, s.cfg.CallFuncs)
+		if err != nil {
+			return ref{}, false
+		}
+		rel := offset - r.ExprPos.Offset
+		var found ref
+		ok := false
+		dexpr.Inspect(expr.Node, func(n dexpr.Node) bool {
+			name := ""
+			switch x := n.(type) {
+			case *dexpr.VarNode:
+				name = x.Name
+			case *dexpr.CallNode:
+				name = x.Name
+			default:
+				return n != nil
+			}
+			start := n.Pos().Offset
+			if rel >= start && rel <= start+len(name) {
+				found = ref{
+					rule:  r,
+					node:  n,
+					start: r.FilePos(n.Pos()).Offset,
+					end:   r.FilePos(n.Pos()).Offset + len(name),
+				}
+				ok = true
+			}
+			return true
+		})
+		return found, ok
+	}
+	return ref{}, false
+}
+
+func (s *Server) hover(p TextDocumentPositionParams) *Hover {
+	text, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	rules, err := dexpr.ParseRules(text)
+	if err != nil {
+		return nil
+	}
+	rf, ok := s.findRef(rules, toOffset(text, p.Position))
+	if !ok {
+		return nil
+	}
+	var value string
+	switch x := rf.node.(type) {
+	case nil:
+		value = fmt.Sprintf("rule %s = %s", rf.rule.Name, rf.rule.Expr)
+	case *dexpr.CallNode:
+		if fi, ok := s.cfg.FuncInfo[x.Name]; ok {
+			value = fmt.Sprintf("func %s\n\n%s", fi.Signature, fi.Doc)
+		} else if _, ok := s.cfg.CallFuncs[x.Name]; ok {
+			value = fmt.Sprintf("func %s", x.Name)
+		} else {
+			value = fmt.Sprintf("func %s (not registered)", x.Name)
+		}
+	case *dexpr.VarNode:
+		if r, ok := findRule(rules, x.Name); ok {
+			value = fmt.Sprintf("rule %s = %s", r.Name, r.Expr)
+		} else if doc, ok := s.cfg.Vars[x.Name]; ok {
+			value = fmt.Sprintf("var %s", x.Name)
+			if doc != "" {
+				value += "\n\n" + doc
+			}
+		} else {
+			value = fmt.Sprintf("var %s (not declared)", x.Name)
+		}
+	}
+	rng := toRange(text, rf.start, rf.end)
+	return &Hover{
+		Contents: MarkupContent{Kind: "plaintext", Value: value},
+		Range:    &rng,
+	}
+}
+
+func (s *Server) definition(p TextDocumentPositionParams) []Location {
+	locs := []Location{}
+	text, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return locs
+	}
+	rules, err := dexpr.ParseRules(text)
+	if err != nil {
+		return locs
+	}
+	rf, ok := s.findRef(rules, toOffset(text, p.Position))
+	if !ok {
+		return locs
+	}
+	name := rf.rule.Name
+	if v, isVar := rf.node.(*dexpr.VarNode); isVar {
+		name = v.Name
+	} else if rf.node != nil {
+		return locs
+	}
+	if r, ok := findRule(rules, name); ok {
+		start := r.NamePos.Offset
+		locs = append(locs, Location{
+			URI:   p.TextDocument.URI,
+			Range: toRange(text, start, start+len(r.Name)),
+		})
+	}
+	return locs
+}
+
+func findRule(rules []dexpr.RuleSource, name string) (dexpr.RuleSource, bool) {
+	for _, r := range rules {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return dexpr.RuleSource{}, false
+}
+
+// completion returns the functions, variables and rules that begin
+// with the identifier before the position
+func (s *Server) completion(p TextDocumentPositionParams) []CompletionItem {
+	items := []CompletionItem{}
+	text, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return items
+	}
+	offset := toOffset(text, p.Position)
+	start := offset
+	for start > 0 && isIdentByte(text[start-1]) {
+		start--
+	}
+	prefix := text[start:offset]
+
+	for _, name := range sortedNames(s.cfg.CallFuncs) {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		item := CompletionItem{Label: name, Kind: CompletionItemKindFunction}
+		if fi, ok := s.cfg.FuncInfo[name]; ok {
+			item.Detail = fi.Signature
+			item.Documentation = fi.Doc
+		}
+		items = append(items, item)
+	}
+	vars := map[string]CompletionItem{}
+	for name, doc := range s.cfg.Vars {
+		vars[name] = CompletionItem{
+			Label:         name,
+			Kind:          CompletionItemKindVariable,
+			Documentation: doc,
+		}
+	}
+	// The rules can't be found if the file doesn't parse
+	rules, _ := dexpr.ParseRules(text)
+	for _, r := range rules {
+		vars[r.Name] = CompletionItem{
+			Label:  r.Name,
+			Kind:   CompletionItemKindVariable,
+			Detail: "rule " + r.Name + " = " + r.Expr,
+		}
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		items = append(items, vars[name])
+	}
+	return items
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		c >= '0' && c <= '9'
+}
+
+func sortedNames(funcs map[string]dexpr.CallFun) []string {
+	r := make([]string, 0, len(funcs))
+	for name := range funcs {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// formatting returns edits to format the expression of each rule that
+// can be compiled
+func (s *Server) formatting(p DocumentFormattingParams) []TextEdit {
+	edits := []TextEdit{}
+	text, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return edits
+	}
+	rules, err := dexpr.ParseRules(text)
+	if err != nil {
+		return edits
+	}
+	for _, r := range rules {
+		expr, err := dexpr.New(r.Expr, s.cfg.CallFuncs)
+		if err != nil {
+			continue
+		}
+		formatted := s.cfg.Formatter.Format(expr.Node)
+		if formatted == r.Expr {
+			continue
+		}
+		start := r.ExprPos.Offset
+		edits = append(edits, TextEdit{
+			Range:   toRange(text, start, start+len(r.Expr)),
+			NewText: formatted,
+		})
+	}
+	return edits
+}
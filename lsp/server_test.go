@@ -0,0 +1,279 @@
+package lsp
+
+import (
+	"encoding/json"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/lawrencewoodman/dlit"
+	"io"
+	"reflect"
+	"testing"
+)
+
+const testURI = "file:///rules.dx"
+
+const testRules = "# Applicants\n" +
+	"isAdult = age >= 18\n" +
+	"isAccepted = isAdult &&\n" +
+	"    roundto(income,0) > 20000 && rate == rate\n"
+
+func startServer(t *testing.T) (*Client, func()) {
+	cfg := Config{
+		CallFuncs: map[string]dexpr.CallFun{
+			"roundto": func([]*dlit.Literal) (*dlit.Literal, error) {
+				return dlit.MustNew(0), nil
+			},
+		},
+		FuncInfo: map[string]FuncInfo{
+			"roundto": {"roundto(x, dp)", "returns x rounded to dp places"},
+		},
+		Vars: map[string]string{
+			"age":    "age in years",
+			"income": "yearly income",
+			"rate":   "",
+		},
+		Formatter: dexpr.Formatter{MaxWidth: 30, Indent: "    "},
+	}
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	done := make(chan error)
+	go func() {
+		done <- NewServer(cfg).Serve(serverIn, serverOut)
+		serverOut.Close()
+	}()
+	c := NewClient(clientIn, clientOut)
+	if err := c.Call("initialize", map[string]interface{}{}, nil); err != nil {
+		t.Fatalf("initialize: %s", err)
+	}
+	if err := c.Notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, Text: testRules},
+	}); err != nil {
+		t.Fatalf("didOpen: %s", err)
+	}
+	stop := func() {
+		if err := c.Call("shutdown", nil, nil); err != nil {
+			t.Errorf("shutdown: %s", err)
+		}
+		if err := c.Notify("exit", nil); err != nil {
+			t.Errorf("exit: %s", err)
+		}
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %s", err)
+		}
+	}
+	return c, stop
+}
+
+func posParams(line, char int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: line, Character: char},
+	}
+}
+
+func TestServer_diagnostics(t *testing.T) {
+	c, stop := startServer(t)
+	defer stop()
+	params, err := c.WaitNotification("textDocument/publishDiagnostics")
+	if err != nil {
+		t.Fatalf("WaitNotification: %s", err)
+	}
+	var got PublishDiagnosticsParams
+	if err := json.Unmarshal(params, &got); err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	want := PublishDiagnosticsParams{
+		URI: testURI,
+		Diagnostics: []Diagnostic{
+			{
+				Range: Range{
+					Start: Position{Line: 3, Character: 33},
+					End:   Position{Line: 3, Character: 45},
+				},
+				Severity: SeverityWarning,
+				Code:     dexpr.CodeSelfCompare,
+				Source:   "dexpr",
+				Message: "isAccepted: rate == rate compares an operand with " +
+					"itself so is always true",
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diagnostics got: %v, want: %v", got, want)
+	}
+
+	if err := c.Notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   TextDocumentIdentifier{URI: testURI},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "a = b +\n"}},
+	}); err != nil {
+		t.Fatalf("didChange: %s", err)
+	}
+	params, err = c.WaitNotification("textDocument/publishDiagnostics")
+	if err != nil {
+		t.Fatalf("WaitNotification: %s", err)
+	}
+	got = PublishDiagnosticsParams{}
+	if err := json.Unmarshal(params, &got); err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	if len(got.Diagnostics) != 1 ||
+		got.Diagnostics[0].Code != dexpr.CodeInvalid ||
+		got.Diagnostics[0].Severity != SeverityError {
+		t.Errorf("diagnostics after change got: %v", got)
+	}
+}
+
+func TestServer_hover(t *testing.T) {
+	c, stop := startServer(t)
+	defer stop()
+	cases := []struct {
+		line, char int
+		want       string
+	}{
+		{1, 11, "var age\n\nage in years"},
+		{3, 5, "func roundto(x, dp)\n\nreturns x rounded to dp places"},
+		{3, 33, "var rate"},
+		{2, 15, "rule isAdult = age >= 18"},
+		{2, 3, "rule isAccepted = isAdult &&\n" +
+			"    roundto(income,0) > 20000 && rate == rate"},
+	}
+	for _, cs := range cases {
+		var got *Hover
+		if err := c.Call("textDocument/hover", posParams(cs.line, cs.char),
+			&got); err != nil {
+			t.Fatalf("hover: %s", err)
+		}
+		if got == nil || got.Contents.Value != cs.want {
+			t.Errorf("hover(%d, %d) got: %v, want: %s", cs.line, cs.char, got,
+				cs.want)
+		}
+	}
+
+	var got *Hover
+	if err := c.Call("textDocument/hover", posParams(0, 3), &got); err != nil {
+		t.Fatalf("hover: %s", err)
+	}
+	if got != nil {
+		t.Errorf("hover on comment got: %v, want: nil", got)
+	}
+}
+
+func TestServer_completion(t *testing.T) {
+	c, stop := startServer(t)
+	defer stop()
+	cases := []struct {
+		line, char int
+		want       []string
+	}{
+		{3, 6, []string{"roundto"}},
+		{3, 15, []string{"income"}},
+		{2, 14, []string{"income", "isAccepted", "isAdult"}},
+		{1, 10, []string{"roundto", "age", "income", "isAccepted", "isAdult",
+			"rate"}},
+	}
+	for _, cs := range cases {
+		var items []CompletionItem
+		if err := c.Call("textDocument/completion",
+			posParams(cs.line, cs.char), &items); err != nil {
+			t.Fatalf("completion: %s", err)
+		}
+		got := []string{}
+		for _, item := range items {
+			got = append(got, item.Label)
+		}
+		if !reflect.DeepEqual(got, cs.want) {
+			t.Errorf("completion(%d, %d) got: %v, want: %v", cs.line, cs.char,
+				got, cs.want)
+		}
+	}
+}
+
+func TestServer_definition(t *testing.T) {
+	c, stop := startServer(t)
+	defer stop()
+	var got []Location
+	if err := c.Call("textDocument/definition", posParams(2, 16),
+		&got); err != nil {
+		t.Fatalf("definition: %s", err)
+	}
+	want := []Location{
+		{
+			URI: testURI,
+			Range: Range{
+				Start: Position{Line: 1, Character: 0},
+				End:   Position{Line: 1, Character: 7},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("definition got: %v, want: %v", got, want)
+	}
+
+	got = nil
+	if err := c.Call("textDocument/definition", posParams(1, 11),
+		&got); err != nil {
+		t.Fatalf("definition: %s", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("definition of var got: %v, want: []", got)
+	}
+}
+
+func TestServer_formatting(t *testing.T) {
+	c, stop := startServer(t)
+	defer stop()
+	var got []TextEdit
+	err := c.Call("textDocument/formatting", DocumentFormattingParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+	}, &got)
+	if err != nil {
+		t.Fatalf("formatting: %s", err)
+	}
+	want := []TextEdit{
+		{
+			Range: Range{
+				Start: Position{Line: 2, Character: 13},
+				End:   Position{Line: 3, Character: 45},
+			},
+			NewText: "isAdult &&\n" +
+				"    roundto(income, 0) > 20000 &&\n" +
+				"    rate == rate",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("formatting got: %q, want: %q", got, want)
+	}
+}
+
+func TestServer_unknownMethod(t *testing.T) {
+	c, stop := startServer(t)
+	defer stop()
+	err := c.Call("textDocument/rename", nil, nil)
+	rerr, ok := err.(*ResponseError)
+	if !ok || rerr.Code != CodeMethodNotFound {
+		t.Errorf("Call err: %v, want: method not found", err)
+	}
+}
+
+func TestToOffset(t *testing.T) {
+	text := "a = \"é😀\" + b\nc"
+	cases := []struct {
+		pos  Position
+		want int
+	}{
+		{Position{0, 0}, 0},
+		{Position{0, 5}, 5},
+		{Position{0, 6}, 7},
+		{Position{0, 8}, 11},
+		{Position{0, 99}, 16},
+		{Position{1, 1}, 18},
+	}
+	for _, c := range cases {
+		got := toOffset(text, c.pos)
+		if got != c.want {
+			t.Errorf("toOffset(%v) got: %d, want: %d", c.pos, got, c.want)
+		}
+		if p := toPosition(text, got); c.pos.Character != 99 && p != c.pos {
+			t.Errorf("toPosition(%d) got: %v, want: %v", got, p, c.pos)
+		}
+	}
+}
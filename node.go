@@ -0,0 +1,285 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"fmt"
+	"github.com/lawrencewoodman/dlit"
+	"go/ast"
+	"go/token"
+	"strconv"
+)
+
+// Node is a node in the syntax tree of an expression.  The tree is
+// produced by New and can be inspected with Walk or Inspect.
+type Node interface {
+	// Pos returns the position of the first character of the node
+	Pos() Position
+	// End returns the position of the character after the node
+	End() Position
+	node()
+}
+
+// Span is the part of the source that a Node was parsed from.  Nodes
+// that weren't parsed from source have a zero Span.
+type Span struct {
+	From Position
+	To   Position
+}
+
+// LitNode is a number, character or string literal
+type LitNode struct {
+	Span
+	Kind  token.Token   // token.INT, token.FLOAT, token.CHAR or token.STRING
+	Raw   string        // the literal as written, including any quotes
+	Value *dlit.Literal // the value of the literal
+}
+
+// VarNode is a variable
+type VarNode struct {
+	Span
+	Name string
+}
+
+// ParenNode is an expression within parentheses
+type ParenNode struct {
+	Span
+	X Node
+}
+
+// UnaryNode is a unary expression such as !a
+type UnaryNode struct {
+	Span
+	Op token.Token
+	X  Node
+}
+
+// BinaryNode is a binary expression such as a + b
+type BinaryNode struct {
+	Span
+	X     Node
+	Op    token.Token
+	OpPos Position
+	Y     Node
+}
+
+// CallNode is a function call such as roundto(a, 2)
+type CallNode struct {
+	Span
+	Name string
+	Args []Node
+}
+
+// ListNode is a composite literal such as []lit{1, 2, 3}
+type ListNode struct {
+	Span
+	Type string // the type as written such as []lit
+	Elts []Node
+}
+
+// IndexNode is an index expression such as []lit{1, 2, 3}[1]
+type IndexNode struct {
+	Span
+	X     Node
+	Index Node
+}
+
+func (s Span) Pos() Position { return s.From }
+func (s Span) End() Position { return s.To }
+
+func (*LitNode) node()    {}
+func (*VarNode) node()    {}
+func (*ParenNode) node()  {}
+func (*UnaryNode) node()  {}
+func (*BinaryNode) node() {}
+func (*CallNode) node()   {}
+func (*ListNode) node()   {}
+func (*IndexNode) node()  {}
+
+// A Visitor's Visit method is called for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree in depth-first order.  It starts by calling
+// v.Visit(node); node must not be nil.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	switch n := node.(type) {
+	case *ParenNode:
+		Walk(v, n.X)
+	case *UnaryNode:
+		Walk(v, n.X)
+	case *BinaryNode:
+		Walk(v, n.X)
+		Walk(v, n.Y)
+	case *CallNode:
+		for _, arg := range n.Args {
+			Walk(v, arg)
+		}
+	case *ListNode:
+		for _, elt := range n.Elts {
+			Walk(v, elt)
+		}
+	case *IndexNode:
+		Walk(v, n.X)
+		Walk(v, n.Index)
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree in depth-first order.  It starts by calling
+// f(node); node must not be nil.  If f returns true, Inspect calls f for
+// each of the children of node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// toNode converts the go/ast tree of the source in lt, which has
+// already been compiled successfully, to a Node
+func toNode(lt *lineTable, n ast.Expr) (Node, error) {
+	if x, ok := n.(*ast.BinaryExpr); ok {
+		// This is handled separately because the Pos of an
+		// *ast.BinaryExpr is found from its left operand, which would
+		// take too long for a long chain of operators
+		return binaryToNode(lt, x)
+	}
+	span := Span{
+		From: lt.position(posToOffset(n.Pos())),
+		To:   lt.position(posToOffset(n.End())),
+	}
+	switch x := n.(type) {
+	case *ast.BasicLit:
+		l := &LitNode{Span: span, Kind: x.Kind, Raw: x.Value}
+		if x.Kind == token.CHAR || x.Kind == token.STRING {
+			uc, err := strconv.Unquote(x.Value)
+			if err != nil {
+				return nil, err
+			}
+			l.Value = dlit.NewString(uc)
+		} else {
+			l.Value = numLitToenode(x.Value).(enLit).val
+		}
+		return l, nil
+	case *ast.Ident:
+		return &VarNode{Span: span, Name: x.Name}, nil
+	case *ast.ParenExpr:
+		xn, err := toNode(lt, x.X)
+		if err != nil {
+			return nil, err
+		}
+		return &ParenNode{Span: span, X: xn}, nil
+	case *ast.UnaryExpr:
+		xn, err := toNode(lt, x.X)
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryNode{Span: span, Op: x.Op, X: xn}, nil
+	case *ast.CallExpr:
+		id, ok := x.Fun.(*ast.Ident)
+		if !ok {
+			return nil, fmt.Errorf("can't get name as *ast.Ident: %s", x.Fun)
+		}
+		args, err := toNodes(lt, x.Args)
+		if err != nil {
+			return nil, err
+		}
+		return &CallNode{Span: span, Name: id.Name, Args: args}, nil
+	case *ast.CompositeLit:
+		elts, err := toNodes(lt, x.Elts)
+		if err != nil {
+			return nil, err
+		}
+		typ := lt.src[posToOffset(x.Type.Pos()):posToOffset(x.Type.End())]
+		return &ListNode{Span: span, Type: typ, Elts: elts}, nil
+	case *ast.IndexExpr:
+		xn, err := toNode(lt, x.X)
+		if err != nil {
+			return nil, err
+		}
+		in, err := toNode(lt, x.Index)
+		if err != nil {
+			return nil, err
+		}
+		return &IndexNode{Span: span, X: xn, Index: in}, nil
+	}
+	return nil, fmt.Errorf("unsupported node: %T", n)
+}
+
+func binaryToNode(lt *lineTable, x *ast.BinaryExpr) (Node, error) {
+	xn, err := toNode(lt, x.X)
+	if err != nil {
+		return nil, err
+	}
+	yn, err := toNode(lt, x.Y)
+	if err != nil {
+		return nil, err
+	}
+	return &BinaryNode{
+		Span:  Span{From: xn.Pos(), To: yn.End()},
+		X:     xn,
+		Op:    x.Op,
+		OpPos: lt.position(posToOffset(x.OpPos)),
+		Y:     yn,
+	}, nil
+}
+
+func toNodes(lt *lineTable, es []ast.Expr) ([]Node, error) {
+	r := make([]Node, len(es))
+	for i, e := range es {
+		n, err := toNode(lt, e)
+		if err != nil {
+			return nil, err
+		}
+		r[i] = n
+	}
+	return r, nil
+}
+
+// addConverted adds each node of the go/ast tree, x, to converted along
+// with the Node, n, that toNode converted it to.  Parentheses aren't
+// added as they aren't evaluated separately from the node that they
+// contain.
+func addConverted(converted map[ast.Node]Node, x ast.Expr, n Node) {
+	switch xx := x.(type) {
+	case *ast.ParenExpr:
+		addConverted(converted, xx.X, n.(*ParenNode).X)
+		return
+	case *ast.UnaryExpr:
+		addConverted(converted, xx.X, n.(*UnaryNode).X)
+	case *ast.BinaryExpr:
+		bn := n.(*BinaryNode)
+		addConverted(converted, xx.X, bn.X)
+		addConverted(converted, xx.Y, bn.Y)
+	case *ast.CallExpr:
+		for i, arg := range xx.Args {
+			addConverted(converted, arg, n.(*CallNode).Args[i])
+		}
+	case *ast.CompositeLit:
+		for i, elt := range xx.Elts {
+			addConverted(converted, elt, n.(*ListNode).Elts[i])
+		}
+	case *ast.IndexExpr:
+		in := n.(*IndexNode)
+		addConverted(converted, xx.X, in.X)
+		addConverted(converted, xx.Index, in.Index)
+	}
+	converted[x] = n
+}
@@ -0,0 +1,178 @@
+package dexpr
+
+import (
+	"fmt"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNew_node(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{in: "a", want: "var(a)"},
+		{in: "5.20", want: "lit(FLOAT 5.20 5.20)"},
+		{in: "\"hello\"", want: "lit(STRING \"hello\" hello)"},
+		{in: "-a", want: "unary(- var(a))"},
+		{in: "a + b*(c - 2)",
+			want: "binary(+ var(a) binary(* var(b) paren(binary(- var(c) lit(INT 2 2)))))",
+		},
+		{in: "roundto(a, 2) > 6 || !b",
+			want: "binary(|| binary(> call(roundto var(a) lit(INT 2 2)) " +
+				"lit(INT 6 6)) unary(! var(b)))",
+		},
+		{in: "[]lit{1, a}[1]",
+			want: "index(list([]lit lit(INT 1 1) var(a)) lit(INT 1 1))",
+		},
+	}
+	funcs := map[string]CallFun{"roundto": roundTo}
+	for _, c := range cases {
+		expr, err := New(c.in, funcs)
+		if err != nil {
+			t.Fatalf("New(%s) err: %s", c.in, err)
+		}
+		if got := dumpNode(expr.Node); got != c.want {
+			t.Errorf("New(%s) Node got: %s, want: %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestNew_nodePositions(t *testing.T) {
+	in := "a > 5 &&\n  roundto(b, 2) == 2"
+	expr := MustNew(in, map[string]CallFun{"roundto": roundTo})
+	root, ok := expr.Node.(*BinaryNode)
+	if !ok || root.Op != token.LAND {
+		t.Fatalf("Node: %s, want a && BinaryNode", dumpNode(expr.Node))
+	}
+	cases := []struct {
+		node     Node
+		wantPos  Position
+		wantEnd  Position
+		wantText string
+	}{
+		{node: root,
+			wantPos:  Position{Offset: 0, Line: 1, Column: 1},
+			wantEnd:  Position{Offset: 29, Line: 2, Column: 21},
+			wantText: in,
+		},
+		{node: root.X,
+			wantPos:  Position{Offset: 0, Line: 1, Column: 1},
+			wantEnd:  Position{Offset: 5, Line: 1, Column: 6},
+			wantText: "a > 5",
+		},
+		{node: root.Y.(*BinaryNode).X,
+			wantPos:  Position{Offset: 11, Line: 2, Column: 3},
+			wantEnd:  Position{Offset: 24, Line: 2, Column: 16},
+			wantText: "roundto(b, 2)",
+		},
+	}
+	for _, c := range cases {
+		if c.node.Pos() != c.wantPos || c.node.End() != c.wantEnd {
+			t.Errorf("node: %s, got: %s-%s, want: %s-%s", dumpNode(c.node),
+				c.node.Pos(), c.node.End(), c.wantPos, c.wantEnd)
+		}
+		text := in[c.node.Pos().Offset:c.node.End().Offset]
+		if text != c.wantText {
+			t.Errorf("node: %s, got text: %s, want: %s",
+				dumpNode(c.node), text, c.wantText)
+		}
+	}
+	wantOpPos := Position{Offset: 6, Line: 1, Column: 7}
+	if root.OpPos != wantOpPos {
+		t.Errorf("OpPos got: %s, want: %s", root.OpPos, wantOpPos)
+	}
+}
+
+func TestNew_nodeNotIdentCall(t *testing.T) {
+	in := "a.b(1) == 1"
+	_, err := New(in, map[string]CallFun{})
+	wantErr := InvalidExprError{in, ErrSyntax}
+	if err != wantErr {
+		t.Errorf("New(%s) err: %v, want: %v", in, err, wantErr)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	expr := MustNew("a + f(b, 3) > -c", map[string]CallFun{})
+	got := []string{}
+	Inspect(expr.Node, func(n Node) bool {
+		switch x := n.(type) {
+		case nil:
+			got = append(got, "end")
+		case *VarNode:
+			got = append(got, x.Name)
+		case *CallNode:
+			got = append(got, x.Name+"()")
+			return false
+		default:
+			got = append(got, fmt.Sprintf("%T", n))
+		}
+		return true
+	})
+	want := []string{
+		"*dexpr.BinaryNode",
+		"*dexpr.BinaryNode", "a", "end", "f()", "end",
+		"*dexpr.UnaryNode", "c", "end", "end",
+		"end",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Inspect got: %v, want: %v", got, want)
+	}
+}
+
+type countVisitor map[string]int
+
+func (cv countVisitor) Visit(n Node) Visitor {
+	if n != nil {
+		cv[strings.TrimPrefix(fmt.Sprintf("%T", n), "*dexpr.")]++
+	}
+	return cv
+}
+
+func TestWalk(t *testing.T) {
+	expr := MustNew("[]lit{a, 2}[0] == 1 && (b || !c)", map[string]CallFun{})
+	got := countVisitor{}
+	Walk(got, expr.Node)
+	want := countVisitor{
+		"BinaryNode": 3, "IndexNode": 1, "ListNode": 1, "LitNode": 3,
+		"VarNode": 3, "ParenNode": 1, "UnaryNode": 1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk got: %v, want: %v", got, want)
+	}
+}
+
+/**********************************
+ *    Helper functions
+ **********************************/
+func dumpNode(n Node) string {
+	dumpNodes := func(ns []Node) string {
+		r := ""
+		for _, x := range ns {
+			r += " " + dumpNode(x)
+		}
+		return r
+	}
+	switch x := n.(type) {
+	case *LitNode:
+		return fmt.Sprintf("lit(%s %s %s)", x.Kind, x.Raw, x.Value)
+	case *VarNode:
+		return fmt.Sprintf("var(%s)", x.Name)
+	case *ParenNode:
+		return fmt.Sprintf("paren(%s)", dumpNode(x.X))
+	case *UnaryNode:
+		return fmt.Sprintf("unary(%s %s)", x.Op, dumpNode(x.X))
+	case *BinaryNode:
+		return fmt.Sprintf("binary(%s %s %s)", x.Op, dumpNode(x.X), dumpNode(x.Y))
+	case *CallNode:
+		return fmt.Sprintf("call(%s%s)", x.Name, dumpNodes(x.Args))
+	case *ListNode:
+		return fmt.Sprintf("list(%s%s)", x.Type, dumpNodes(x.Elts))
+	case *IndexNode:
+		return fmt.Sprintf("index(%s %s)", dumpNode(x.X), dumpNode(x.Index))
+	}
+	return fmt.Sprintf("unknown(%T)", n)
+}
@@ -15,6 +15,7 @@
 package dexpr
 
 import (
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/scanner"
@@ -46,6 +47,11 @@ type parser struct {
 	exprLev int  // < 0: in control clause, >= 0: in expression
 	inRhs   bool // if set, the parser is parsing a rhs expression
 
+	// Nesting depth, limited to avoid exhausting the stack
+	depth    int  // current nesting depth
+	maxDepth int  // maximum nesting depth
+	tooDeep  bool // set if parsing stopped because maxDepth was exceeded
+
 	// Ordinary identifier scopes
 	pkgScope   *ast.Scope        // pkgScope.Outer == nil
 	topScope   *ast.Scope        // top-most scope; may be pkgScope
@@ -60,18 +66,24 @@ type parser struct {
 
 // ParseExpr obtains the AST of an expression x.
 // The position information recorded in the AST is undefined. The filename used
-// in error messages is the empty string.
-func parseExpr(x string) (ast.Expr, error) {
+// in error messages is the empty string.  If the expression is nested deeper
+// than maxDepth an ErrTooDeep error is returned.
+func parseExpr(x string, maxDepth int) (expr ast.Expr, err error) {
 	text := []byte(x)
 	fset := token.NewFileSet()
 
 	var p parser
+	p.maxDepth = maxDepth
 	defer func() {
 		if e := recover(); e != nil {
 			// resume same panic if it's not a bailout
 			if _, ok := e.(bailout); !ok {
 				panic(e)
 			}
+			expr, err = nil, p.errors.Err()
+		}
+		if p.tooDeep {
+			expr, err = nil, errTooDeep
 		}
 		p.errors.Sort()
 	}()
@@ -190,6 +202,20 @@ func keywordTokenToIdent(inToken token.Token) token.Token {
 // A bailout panic is raised to indicate early termination.
 type bailout struct{}
 
+// errTooDeep is returned by parseExpr if maxDepth is exceeded
+var errTooDeep = errors.New("exceeded max nesting depth")
+
+// incDepth increases the nesting depth and stops parsing if it is
+// greater than maxDepth
+func (p *parser) incDepth() {
+	p.depth++
+	if p.maxDepth > 0 && p.depth > p.maxDepth {
+		p.tooDeep = true
+		p.error(p.pos, errTooDeep.Error())
+		panic(bailout{})
+	}
+}
+
 func (p *parser) error(pos token.Pos, msg string) {
 	epos := p.file.Position(pos)
 	p.errors.Add(epos, msg)
@@ -614,6 +640,12 @@ func (p *parser) tryIdentOrType() ast.Expr {
 	switch p.tok {
 	case token.IDENT:
 		return p.parseTypeName()
+	case token.LBRACK, token.MUL, token.FUNC, token.MAP, token.LPAREN:
+		// Types can be nested within each other
+		p.incDepth()
+		defer func() { p.depth-- }()
+	}
+	switch p.tok {
 	case token.LBRACK:
 		return p.parseArrayType()
 	case token.MUL:
@@ -712,7 +744,9 @@ func (p *parser) parseOperand(lhs bool) ast.Expr {
 		lparen := p.pos
 		p.next()
 		p.exprLev++
+		p.incDepth()
 		x := p.parseRhsOrType() // types may be parenthesized: (some type)
+		p.depth--
 		p.exprLev--
 		rparen := p.expect(token.RPAREN)
 		return &ast.ParenExpr{Lparen: lparen, X: x, Rparen: rparen}
@@ -993,8 +1027,15 @@ func (p *parser) checkExprOrType(x ast.Expr) ast.Expr {
 // If lhs is set and the result is an identifier, it is not resolved.
 func (p *parser) parsePrimaryExpr(lhs bool) ast.Expr {
 	x := p.parseOperand(lhs)
+	depth := p.depth
+	defer func() { p.depth = depth }()
 L:
 	for {
+		if p.tok == token.PERIOD || p.tok == token.LBRACK ||
+			p.tok == token.LPAREN || p.tok == token.LBRACE {
+			// Each suffix adds a level to the tree
+			p.incDepth()
+		}
 		switch p.tok {
 		case token.PERIOD:
 			p.next()
@@ -1047,13 +1088,17 @@ func (p *parser) parseUnaryExpr(lhs bool) ast.Expr {
 	case token.ADD, token.SUB, token.NOT, token.XOR, token.AND:
 		pos, op := p.pos, p.tok
 		p.next()
+		p.incDepth()
 		x := p.parseUnaryExpr(false)
+		p.depth--
 		return &ast.UnaryExpr{OpPos: pos, Op: op, X: p.checkExpr(x)}
 	case token.MUL:
 		// pointer type or unary "*" expression
 		pos := p.pos
 		p.next()
+		p.incDepth()
 		x := p.parseUnaryExpr(false)
+		p.depth--
 		return &ast.StarExpr{Star: pos, X: p.checkExprOrType(x)}
 	}
 
@@ -1081,7 +1126,12 @@ func (p *parser) parseBinaryExpr(lhs bool, prec1 int) ast.Expr {
 			p.resolve(x)
 			lhs = false
 		}
+		// The right operand is nested within the operator, but a chain of
+		// left associative operators such as a + b + c isn't counted as
+		// nesting so that long flat chains can be parsed
+		p.incDepth()
 		y := p.parseBinaryExpr(false, oprec+1)
+		p.depth--
 		x = &ast.BinaryExpr{X: p.checkExpr(x), OpPos: pos, Op: op, Y: p.checkExpr(y)}
 	}
 }
@@ -0,0 +1,195 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"github.com/lawrencewoodman/dlit"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// Partial returns a new expression with the variables in vars replaced
+// by their values and any parts that then only use constants folded.
+// The new expression uses the same functions and options as expr.
+//
+// Where an operand of && or || decides the result on its own, such as
+// false in false && a, the other operand is removed.  This means that
+// an error it would have caused, for example if a variable is missing,
+// won't be returned by the new expression.  Functions are never called
+// because they may not always return the same value.
+func (expr *Expr) Partial(vars map[string]*dlit.Literal) (*Expr, error) {
+	return New(Format(fold(expr.Node, vars)), expr.callFuncs, expr.opts...)
+}
+
+// fold returns n with the variables in vars replaced by their values and
+// any constant sub-expressions replaced by their value.  Sub-expressions
+// that would evaluate to an error are left so that the error is still
+// returned when evaluated.
+func fold(n Node, vars map[string]*dlit.Literal) Node {
+	switch x := n.(type) {
+	case *VarNode:
+		if l, ok := vars[x.Name]; ok && l.Err() == nil {
+			return litNode(l)
+		}
+	case *ParenNode:
+		xn := fold(x.X, vars)
+		if _, ok := constValue(xn); ok {
+			return xn
+		}
+		return &ParenNode{X: xn}
+	case *UnaryNode:
+		return foldUnary(x.Op, fold(x.X, vars))
+	case *BinaryNode:
+		return foldBinary(x.Op, fold(x.X, vars), fold(x.Y, vars))
+	case *CallNode:
+		return &CallNode{Name: x.Name, Args: foldNodes(x.Args, vars)}
+	case *ListNode:
+		return &ListNode{Type: x.Type, Elts: foldNodes(x.Elts, vars)}
+	case *IndexNode:
+		return foldIndex(fold(x.X, vars), fold(x.Index, vars))
+	}
+	return n
+}
+
+func foldNodes(ns []Node, vars map[string]*dlit.Literal) []Node {
+	r := make([]Node, len(ns))
+	for i, n := range ns {
+		r[i] = fold(n, vars)
+	}
+	return r
+}
+
+func foldUnary(op token.Token, xn Node) Node {
+	if l, ok := constValue(xn); ok {
+		fn := opNeg
+		if op == token.NOT {
+			fn = opNot
+		}
+		if v := fn(litValue(l)); v.Err() == nil {
+			return litNode(v.Literal())
+		}
+	}
+	return &UnaryNode{Op: op, X: xn}
+}
+
+func foldBinary(op token.Token, xn Node, yn Node) Node {
+	lx, xIsConst := constValue(xn)
+	ly, yIsConst := constValue(yn)
+	if xIsConst && yIsConst {
+		if fn, ok := binaryFns[op]; ok {
+			if v := fn(litValue(lx), litValue(ly)); v.Err() == nil {
+				return litNode(v.Literal())
+			}
+		}
+	}
+	if op == token.LAND || op == token.LOR {
+		// The value of && when an operand is false and || when an
+		// operand is true
+		decider := op == token.LOR
+		if xIsConst {
+			if b, isBool := lx.Bool(); isBool {
+				if b == decider {
+					return litNode(dlit.MustNew(b))
+				} else if isBoolNode(yn) {
+					return yn
+				}
+			}
+		}
+		if yIsConst {
+			if b, isBool := ly.Bool(); isBool {
+				if b == decider {
+					return litNode(dlit.MustNew(b))
+				} else if isBoolNode(xn) {
+					return xn
+				}
+			}
+		}
+	}
+	return &BinaryNode{X: xn, Op: op, Y: yn}
+}
+
+func foldIndex(xn Node, in Node) Node {
+	if li, ok := constValue(in); ok {
+		if i, isInt := li.Int(); isInt && i >= 0 {
+			switch x := xn.(type) {
+			case *ListNode:
+				if i < int64(len(x.Elts)) {
+					return x.Elts[i]
+				}
+			case *LitNode:
+				s := x.Value.String()
+				if x.Kind == token.STRING && i < int64(len(s)) {
+					return litNode(dlit.NewString(string(s[i])))
+				}
+			}
+		}
+	}
+	return &IndexNode{X: xn, Index: in}
+}
+
+// constValue returns the value of n if it is a constant
+func constValue(n Node) (*dlit.Literal, bool) {
+	switch x := unparenNode(n).(type) {
+	case *LitNode:
+		return x.Value, true
+	case *UnaryNode:
+		// A negative number is made from a literal and a unary minus
+		if l, ok := x.X.(*LitNode); ok && x.Op == token.SUB {
+			if v := opNeg(litValue(l.Value)); v.Err() == nil {
+				return v.Literal(), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// isBoolNode returns whether n always evaluates to a bool or an error
+func isBoolNode(n Node) bool {
+	switch x := unparenNode(n).(type) {
+	case *UnaryNode:
+		return x.Op == token.NOT
+	case *BinaryNode:
+		switch x.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ,
+			token.LAND, token.LOR:
+			return true
+		}
+	}
+	return false
+}
+
+// litNode returns a node for the value of l.  Numbers become number
+// literals and everything else becomes a string literal, which dlit
+// treats in the same way as the original value.  A string is only
+// written as a number literal if the literal would be read back as a
+// number with the same string, so "08" or "1e5" stay as strings.
+// There is no bool literal so bools become the strings "true" and
+// "false".
+func litNode(l *dlit.Literal) Node {
+	s := l.String()
+	num := strings.TrimPrefix(s, "-")
+	if num != "" && num[0] >= '0' && num[0] <= '9' {
+		if en, ok := numLitToenode(num).(enLit); ok &&
+			(en.v.kind == vkInt || en.v.kind == vkFloat) {
+			kind := token.INT
+			if en.v.kind == vkFloat {
+				kind = token.FLOAT
+			}
+			n := &LitNode{Kind: kind, Raw: num, Value: en.val}
+			if num != s {
+				return &UnaryNode{Op: token.SUB, X: n}
+			}
+			return n
+		}
+	}
+	return &LitNode{
+		Kind:  token.STRING,
+		Raw:   strconv.Quote(s),
+		Value: dlit.NewString(s),
+	}
+}
@@ -0,0 +1,142 @@
+package dexpr
+
+import (
+	"github.com/lawrencewoodman/dlit"
+	"testing"
+)
+
+func TestPartial(t *testing.T) {
+	cases := []struct {
+		in    string
+		known map[string]*dlit.Literal
+		want  string
+	}{
+		{in: "tier == \"gold\" && amount > 100",
+			known: map[string]*dlit.Literal{"tier": dlit.NewString("gold")},
+			want:  "amount > 100",
+		},
+		{in: "tier == \"gold\" && amount > 100",
+			known: map[string]*dlit.Literal{"tier": dlit.NewString("silver")},
+			want:  "\"false\"",
+		},
+		{in: "amount > 100 || tier == \"gold\"",
+			known: map[string]*dlit.Literal{"tier": dlit.NewString("gold")},
+			want:  "\"true\"",
+		},
+		{in: "amount > limit * (rate + 1)",
+			known: map[string]*dlit.Literal{
+				"limit": dlit.MustNew(100),
+				"rate":  dlit.MustNew(0.5),
+			},
+			want: "amount > 150",
+		},
+		{in: "amount > -limit",
+			known: map[string]*dlit.Literal{"limit": dlit.MustNew(100)},
+			want:  "amount > -100",
+		},
+		{in: "amount + offset > 10",
+			known: map[string]*dlit.Literal{"offset": dlit.MustNew(-3)},
+			want:  "amount + -3 > 10",
+		},
+		{in: "roundto(amount * rate, dp) > 10",
+			known: map[string]*dlit.Literal{
+				"rate": dlit.MustNew(2),
+				"dp":   dlit.MustNew(1),
+			},
+			want: "roundto(amount * 2, 1) > 10",
+		},
+		{in: "[]lit{a, b, c}[1] == x",
+			known: map[string]*dlit.Literal{"a": dlit.MustNew(1)},
+			want:  "b == x",
+		},
+		{in: "name == \"fred\" && !banned",
+			known: map[string]*dlit.Literal{"name": dlit.NewString("fred")},
+			want:  "!banned",
+		},
+		// flag may not be a bool so it can't replace the && or the
+		// error that would cause would be lost
+		{in: "enabled && flag",
+			known: map[string]*dlit.Literal{"enabled": dlit.MustNew(true)},
+			want:  "\"true\" && flag",
+		},
+		// Expressions that would fail are left to fail when evaluated
+		{in: "a / b > c",
+			known: map[string]*dlit.Literal{
+				"a": dlit.MustNew(1),
+				"b": dlit.MustNew(0),
+			},
+			want: "1 / 0 > c",
+		},
+		// Strings are only written as numbers if they would be read back
+		// the same
+		{in: "x == y",
+			known: map[string]*dlit.Literal{"y": dlit.NewString("08")},
+			want:  "x == \"08\"",
+		},
+		{in: "x == y",
+			known: map[string]*dlit.Literal{"y": dlit.NewString("0x10")},
+			want:  "x == \"0x10\"",
+		},
+		{in: "x == y",
+			known: map[string]*dlit.Literal{"y": dlit.NewString("1_000")},
+			want:  "x == \"1_000\"",
+		},
+		{in: "x == y",
+			known: map[string]*dlit.Literal{"y": dlit.NewString("1e5")},
+			want:  "x == \"1e5\"",
+		},
+		{in: "x == y",
+			known: map[string]*dlit.Literal{"y": dlit.NewString("-12.5")},
+			want:  "x == -12.5",
+		},
+	}
+	funcs := map[string]CallFun{"roundto": roundTo}
+	for _, c := range cases {
+		expr := MustNew(c.in, funcs)
+		got, err := expr.Partial(c.known)
+		if err != nil {
+			t.Errorf("Partial(%s) err: %s", c.in, err)
+			continue
+		}
+		if got.String() != c.want {
+			t.Errorf("Partial(%s) got: %s, want: %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestPartial_sameResult(t *testing.T) {
+	cases := []string{
+		"tier == \"gold\" && amount > 100",
+		"amount > limit * (rate + 1) || tier != \"gold\"",
+		"roundto(amount * rate, 1) - limit",
+		"!(amount > limit) && -amount < rate",
+		"[]lit{amount, limit}[1] + rate",
+		"code == amount || code == \"08\"",
+	}
+	known := map[string]*dlit.Literal{
+		"code":  dlit.NewString("08"),
+		"tier":  dlit.NewString("gold"),
+		"limit": dlit.MustNew(70),
+		"rate":  dlit.MustNew(1.5),
+	}
+	funcs := map[string]CallFun{"roundto": roundTo}
+	for _, in := range cases {
+		expr := MustNew(in, funcs)
+		partial, err := expr.Partial(known)
+		if err != nil {
+			t.Fatalf("Partial(%s) err: %s", in, err)
+		}
+		for _, amount := range []int64{-50, 0, 99, 100, 101, 2000} {
+			vars := map[string]*dlit.Literal{"amount": dlit.MustNew(amount)}
+			got := partial.Eval(vars)
+			for k, v := range known {
+				vars[k] = v
+			}
+			want := expr.Eval(vars)
+			if got.String() != want.String() {
+				t.Errorf("Partial(%s) = %s, amount: %d, got: %s, want: %s",
+					in, partial, amount, got, want)
+			}
+		}
+	}
+}
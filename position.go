@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// Position is a position within the source of an expression
+type Position struct {
+	Offset int // byte offset, starting at 0
+	Line   int // line number, starting at 1
+	Column int // column number in bytes, starting at 1
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// newPosition returns the Position of offset within src
+func newPosition(src string, offset int) Position {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	before := src[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := offset - strings.LastIndex(before, "\n")
+	return Position{Offset: offset, Line: line, Column: column}
+}
+
+// lineTable finds the Position of many offsets within a source without
+// scanning it for each one
+type lineTable struct {
+	src string
+	// starts is the offset of the start of each line
+	starts []int
+}
+
+func newLineTable(src string) *lineTable {
+	starts := []int{0}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return &lineTable{src: src, starts: starts}
+}
+
+// position returns the same Position as newPosition
+func (lt *lineTable) position(offset int) Position {
+	if offset > len(lt.src) {
+		offset = len(lt.src)
+	}
+	line := sort.Search(len(lt.starts), func(i int) bool {
+		return lt.starts[i] > offset
+	})
+	column := offset - lt.starts[line-1] + 1
+	return Position{Offset: offset, Line: line, Column: column}
+}
+
+// posToOffset returns the offset within the source of a token.Pos
+// produced by parseExpr
+func posToOffset(pos token.Pos) int {
+	// parseExpr uses a new FileSet with one file, which has a base of 1
+	return int(pos) - 1
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+// Ref is a variable or function referenced by an expression along with
+// the position of each place that it is referenced
+type Ref struct {
+	Name      string
+	Positions []Position
+}
+
+// Vars returns the distinct variables referenced by the expression in
+// the order that they are first referenced
+func (expr *Expr) Vars() []Ref {
+	return findRefs(expr.Node, func(n Node) (string, bool) {
+		if v, ok := n.(*VarNode); ok {
+			return v.Name, true
+		}
+		return "", false
+	})
+}
+
+// Funcs returns the distinct functions called by the expression in
+// the order that they are first called
+func (expr *Expr) Funcs() []Ref {
+	return findRefs(expr.Node, func(n Node) (string, bool) {
+		if c, ok := n.(*CallNode); ok {
+			return c.Name, true
+		}
+		return "", false
+	})
+}
+
+// VarNames returns the names of the distinct variables referenced by
+// the expression in the order that they are first referenced
+func (expr *Expr) VarNames() []string {
+	return refNames(expr.Vars())
+}
+
+// FuncNames returns the names of the distinct functions called by the
+// expression in the order that they are first called
+func (expr *Expr) FuncNames() []string {
+	return refNames(expr.Funcs())
+}
+
+func findRefs(root Node, name func(Node) (string, bool)) []Ref {
+	refs := []Ref{}
+	if root == nil {
+		return refs
+	}
+	index := map[string]int{}
+	Inspect(root, func(n Node) bool {
+		if n == nil {
+			return false
+		}
+		if s, ok := name(n); ok {
+			i, seen := index[s]
+			if !seen {
+				i = len(refs)
+				index[s] = i
+				refs = append(refs, Ref{Name: s})
+			}
+			refs[i].Positions = append(refs[i].Positions, n.Pos())
+		}
+		return true
+	})
+	return refs
+}
+
+func refNames(refs []Ref) []string {
+	r := make([]string, len(refs))
+	for i, ref := range refs {
+		r[i] = ref.Name
+	}
+	return r
+}
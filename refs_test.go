@@ -0,0 +1,69 @@
+package dexpr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVars(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []Ref
+	}{
+		{in: "1 + 2", want: []Ref{}},
+		{in: "b > a && roundto(a, 2) == c",
+			want: []Ref{
+				{Name: "b", Positions: []Position{{Offset: 0, Line: 1, Column: 1}}},
+				{Name: "a",
+					Positions: []Position{
+						{Offset: 4, Line: 1, Column: 5},
+						{Offset: 17, Line: 1, Column: 18},
+					},
+				},
+				{Name: "c", Positions: []Position{{Offset: 26, Line: 1, Column: 27}}},
+			},
+		},
+		{in: "[]lit{x, 2}[0] ==\n  x",
+			want: []Ref{
+				{Name: "x",
+					Positions: []Position{
+						{Offset: 6, Line: 1, Column: 7},
+						{Offset: 20, Line: 2, Column: 3},
+					},
+				},
+			},
+		},
+	}
+	funcs := map[string]CallFun{"roundto": roundTo}
+	for _, c := range cases {
+		expr := MustNew(c.in, funcs)
+		if got := expr.Vars(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Vars(%s) got: %v, want: %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	in := "roundto(a, 2) > 3 || iszero(roundto(b, 1))"
+	expr := MustNew(in, map[string]CallFun{"roundto": roundTo})
+	want := []Ref{
+		{Name: "roundto",
+			Positions: []Position{
+				{Offset: 0, Line: 1, Column: 1},
+				{Offset: 28, Line: 1, Column: 29},
+			},
+		},
+		{Name: "iszero", Positions: []Position{{Offset: 21, Line: 1, Column: 22}}},
+	}
+	if got := expr.Funcs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Funcs(%s) got: %v, want: %v", in, got, want)
+	}
+	wantNames := []string{"roundto", "iszero"}
+	if got := expr.FuncNames(); !reflect.DeepEqual(got, wantNames) {
+		t.Errorf("FuncNames(%s) got: %v, want: %v", in, got, wantNames)
+	}
+	wantNames = []string{"a", "b"}
+	if got := expr.VarNames(); !reflect.DeepEqual(got, wantNames) {
+		t.Errorf("VarNames(%s) got: %v, want: %v", in, got, wantNames)
+	}
+}
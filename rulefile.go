@@ -0,0 +1,132 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+)
+
+// RuleSource is a named expression read from a rule file
+type RuleSource struct {
+	Name    string
+	Expr    string
+	NamePos Position // the position of Name within the file
+	ExprPos Position // the position of the start of Expr within the file
+}
+
+// RuleFileError indicates that a rule file couldn't be parsed
+type RuleFileError struct {
+	Pos Position
+	Msg string
+}
+
+func (e RuleFileError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// ParseRules parses the source of a rule file.  Each rule is written as
+// name = expr starting at the beginning of a line.  An expression can
+// continue over the following lines as long as they are indented.
+// Blank lines and lines beginning with # are ignored.
+//
+//	# Applicants that can be accepted straight away
+//	isAdult = age >= 18
+//	isAccepted = isAdult &&
+//	    income > 20000
+func ParseRules(src string) ([]RuleSource, error) {
+	rules := []RuleSource{}
+	names := map[string]bool{}
+	// inRule is whether the last line was part of a rule
+	inRule := false
+	offset := 0
+	for _, line := range strings.SplitAfter(src, "\n") {
+		lineOffset := offset
+		offset += len(line)
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			inRule = false
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if !inRule {
+				return nil, RuleFileError{
+					Pos: newPosition(src, lineOffset),
+					Msg: "indented line isn't part of a rule",
+				}
+			}
+			r := &rules[len(rules)-1]
+			end := lineOffset + len(strings.TrimRight(line, " \t\r\n"))
+			r.Expr = src[r.ExprPos.Offset:end]
+			continue
+		}
+		r, err := parseRuleLine(src, lineOffset, line)
+		if err != nil {
+			return nil, err
+		}
+		if names[r.Name] {
+			return nil, RuleFileError{
+				Pos: r.NamePos,
+				Msg: fmt.Sprintf("rule already defined: %s", r.Name),
+			}
+		}
+		names[r.Name] = true
+		rules = append(rules, r)
+		inRule = true
+	}
+	for _, r := range rules {
+		if r.Expr == "" {
+			return nil, RuleFileError{
+				Pos: r.ExprPos,
+				Msg: fmt.Sprintf("rule has no expression: %s", r.Name),
+			}
+		}
+	}
+	return rules, nil
+}
+
+// parseRuleLine parses the first line of a rule which is at offset
+// within src
+func parseRuleLine(src string, offset int, line string) (RuleSource, error) {
+	i := strings.Index(line, "=")
+	if i < 0 || strings.HasPrefix(line[i:], "==") {
+		return RuleSource{}, RuleFileError{
+			Pos: newPosition(src, offset),
+			Msg: "expected: name = expr",
+		}
+	}
+	name := strings.TrimSpace(line[:i])
+	if !token.IsIdentifier(name) {
+		return RuleSource{}, RuleFileError{
+			Pos: newPosition(src, offset),
+			Msg: fmt.Sprintf("invalid rule name: %s", name),
+		}
+	}
+	rest := line[i+1:]
+	exprOffset := offset + i + 1 + len(rest) - len(strings.TrimLeft(rest, " \t"))
+	return RuleSource{
+		Name:    name,
+		Expr:    strings.TrimSpace(rest),
+		NamePos: newPosition(src, offset),
+		ExprPos: newPosition(src, exprOffset),
+	}, nil
+}
+
+// FilePos returns the position within the rule file of p, which is a
+// position within r.Expr
+func (r RuleSource) FilePos(p Position) Position {
+	fp := Position{
+		Offset: r.ExprPos.Offset + p.Offset,
+		Line:   r.ExprPos.Line + p.Line - 1,
+		Column: p.Column,
+	}
+	if p.Line == 1 {
+		fp.Column = r.ExprPos.Column + p.Column - 1
+	}
+	return fp
+}
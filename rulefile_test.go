@@ -0,0 +1,103 @@
+package dexpr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	src := "# Applicants\n" +
+		"isAdult = age >= 18\n" +
+		"\n" +
+		"isAccepted = isAdult &&\n" +
+		"    income > 20000  \n" +
+		"bad=1\n"
+	want := []RuleSource{
+		{
+			Name:    "isAdult",
+			Expr:    "age >= 18",
+			NamePos: Position{Offset: 13, Line: 2, Column: 1},
+			ExprPos: Position{Offset: 23, Line: 2, Column: 11},
+		},
+		{
+			Name:    "isAccepted",
+			Expr:    "isAdult &&\n    income > 20000",
+			NamePos: Position{Offset: 34, Line: 4, Column: 1},
+			ExprPos: Position{Offset: 47, Line: 4, Column: 14},
+		},
+		{
+			Name:    "bad",
+			Expr:    "1",
+			NamePos: Position{Offset: 79, Line: 6, Column: 1},
+			ExprPos: Position{Offset: 83, Line: 6, Column: 5},
+		},
+	}
+	got, err := ParseRules(src)
+	if err != nil {
+		t.Fatalf("ParseRules err: %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseRules got: %v, want: %v", got, want)
+	}
+
+	expr := MustNew(got[1].Expr, map[string]CallFun{})
+	income := expr.Vars()[1].Positions[0]
+	wantPos := Position{Offset: 62, Line: 5, Column: 5}
+	if p := got[1].FilePos(income); p != wantPos {
+		t.Errorf("FilePos got: %v, want: %v", p, wantPos)
+	}
+	if p := got[0].FilePos(Position{Offset: 7, Line: 1, Column: 8}); p !=
+		(Position{Offset: 30, Line: 2, Column: 18}) {
+		t.Errorf("FilePos got: %v, want: 2:18", p)
+	}
+}
+
+func TestParseRules_errors(t *testing.T) {
+	cases := []struct {
+		in      string
+		wantErr error
+	}{
+		{in: "  a = 1\n",
+			wantErr: RuleFileError{
+				Pos: Position{Offset: 0, Line: 1, Column: 1},
+				Msg: "indented line isn't part of a rule",
+			},
+		},
+		{in: "a = 1\n\n  + 2\n",
+			wantErr: RuleFileError{
+				Pos: Position{Offset: 7, Line: 3, Column: 1},
+				Msg: "indented line isn't part of a rule",
+			},
+		},
+		{in: "a == 1\n",
+			wantErr: RuleFileError{
+				Pos: Position{Offset: 0, Line: 1, Column: 1},
+				Msg: "expected: name = expr",
+			},
+		},
+		{in: "5a = 1\n",
+			wantErr: RuleFileError{
+				Pos: Position{Offset: 0, Line: 1, Column: 1},
+				Msg: "invalid rule name: 5a",
+			},
+		},
+		{in: "a = 1\na = 2\n",
+			wantErr: RuleFileError{
+				Pos: Position{Offset: 6, Line: 2, Column: 1},
+				Msg: "rule already defined: a",
+			},
+		},
+		{in: "a =\n",
+			wantErr: RuleFileError{
+				Pos: Position{Offset: 3, Line: 1, Column: 4},
+				Msg: "rule has no expression: a",
+			},
+		},
+	}
+	for _, c := range cases {
+		_, err := ParseRules(c.in)
+		if err != c.wantErr {
+			t.Errorf("ParseRules(%q) err: %v, want: %v", c.in, err, c.wantErr)
+		}
+	}
+}
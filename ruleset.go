@@ -0,0 +1,188 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"fmt"
+	"github.com/lawrencewoodman/dlit"
+	"sort"
+	"strings"
+)
+
+// Rule is a named expression in a RuleSet
+type Rule struct {
+	Name string
+	Expr *Expr
+}
+
+// RuleSet is a set of rules whose expressions may use the values of
+// other rules as variables.  The rules are evaluated in an order where
+// each rule comes after the rules that it uses.
+type RuleSet struct {
+	// rules is in the order that they are evaluated
+	rules []Rule
+	// deps is the names of the rules used by each rule, by name
+	deps map[string][]string
+	// inputs is the names of the variables used that aren't rules
+	inputs []string
+}
+
+// CycleError indicates that rules use each other in a cycle.  It holds
+// the names of the rules in the cycle with the first repeated at the
+// end, such as a, b, a.
+type CycleError []string
+
+func (e CycleError) Error() string {
+	return "rules use each other in a cycle: " + strings.Join(e, " -> ")
+}
+
+// DuplicateRuleError indicates that more than one rule has the same name
+type DuplicateRuleError string
+
+func (e DuplicateRuleError) Error() string {
+	return "rule already defined: " + string(e)
+}
+
+// RuleError indicates an error with a rule
+type RuleError struct {
+	Name string
+	Err  error
+}
+
+func (e RuleError) Error() string {
+	return fmt.Sprintf("rule: %s, %s", e.Name, e.Err)
+}
+
+func (e RuleError) Unwrap() error {
+	return e.Err
+}
+
+// NewRuleSet returns a RuleSet of rules.  A variable used by a rule
+// that has the name of another rule refers to that rule's value.  If the
+// rules use each other in a cycle a CycleError is returned.
+func NewRuleSet(rules []Rule) (*RuleSet, error) {
+	byName := make(map[string]Rule, len(rules))
+	for _, r := range rules {
+		if _, ok := byName[r.Name]; ok {
+			return nil, DuplicateRuleError(r.Name)
+		}
+		byName[r.Name] = r
+	}
+	rs := &RuleSet{
+		rules: make([]Rule, 0, len(rules)),
+		deps:  make(map[string][]string, len(rules)),
+	}
+	inputs := map[string]bool{}
+	for _, r := range rules {
+		deps := []string{}
+		for _, name := range r.Expr.VarNames() {
+			if _, isRule := byName[name]; isRule {
+				deps = append(deps, name)
+			} else {
+				inputs[name] = true
+			}
+		}
+		rs.deps[r.Name] = deps
+	}
+	for name := range inputs {
+		rs.inputs = append(rs.inputs, name)
+	}
+	sort.Strings(rs.inputs)
+
+	// The state of each rule while sorting, unvisited if absent
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(rules))
+	path := []string{}
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i, n := range path {
+				if n == name {
+					return CycleError(append(append([]string{}, path[i:]...), name))
+				}
+			}
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range rs.deps[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		rs.rules = append(rs.rules, byName[name])
+		return nil
+	}
+	for _, r := range rules {
+		if err := visit(r.Name); err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+// NewRuleSetFromSource compiles each rule with New and returns a
+// RuleSet of them.  A compile error is returned as a RuleError.
+func NewRuleSetFromSource(
+	srcs []RuleSource,
+	callFuncs map[string]CallFun,
+	opts ...Option,
+) (*RuleSet, error) {
+	rules := make([]Rule, len(srcs))
+	for i, src := range srcs {
+		expr, err := New(src.Expr, callFuncs, opts...)
+		if err != nil {
+			return nil, RuleError{Name: src.Name, Err: err}
+		}
+		rules[i] = Rule{Name: src.Name, Expr: expr}
+	}
+	return NewRuleSet(rules)
+}
+
+// Rules returns the rules in the order that they are evaluated
+func (rs *RuleSet) Rules() []Rule {
+	return append([]Rule{}, rs.rules...)
+}
+
+// Deps returns the names of the rules used by the named rule
+func (rs *RuleSet) Deps(name string) []string {
+	return append([]string{}, rs.deps[name]...)
+}
+
+// Inputs returns the sorted names of the variables used by the rules
+// that aren't the names of rules
+func (rs *RuleSet) Inputs() []string {
+	return append([]string{}, rs.inputs...)
+}
+
+// Eval evaluates each rule using vars along with the values of the
+// rules evaluated before it and returns the value of every rule by name.
+// If a rule has the same name as a variable in vars its value is used
+// in place of the variable.  A rule that uses a rule which evaluates to
+// an error will also evaluate to an error.
+func (rs *RuleSet) Eval(
+	vars map[string]*dlit.Literal,
+) map[string]*dlit.Literal {
+	allVars := make(map[string]*dlit.Literal, len(vars)+len(rs.rules))
+	for name, l := range vars {
+		allVars[name] = l
+	}
+	results := make(map[string]*dlit.Literal, len(rs.rules))
+	for _, r := range rs.rules {
+		l := r.Expr.Eval(allVars)
+		allVars[r.Name] = l
+		results[r.Name] = l
+	}
+	return results
+}
@@ -0,0 +1,140 @@
+package dexpr
+
+import (
+	"errors"
+	"github.com/lawrencewoodman/dlit"
+	"reflect"
+	"testing"
+)
+
+func makeRules(srcs ...string) []Rule {
+	rules := make([]Rule, 0, len(srcs)/2)
+	for i := 0; i < len(srcs); i += 2 {
+		rules = append(rules, Rule{
+			Name: srcs[i],
+			Expr: MustNew(srcs[i+1], map[string]CallFun{}),
+		})
+	}
+	return rules
+}
+
+func TestNewRuleSet(t *testing.T) {
+	rules := makeRules(
+		"isProfitable", "margin > 0",
+		"margin", "price - cost",
+		"summary", "isProfitable && margin > minMargin",
+		"cost", "unitCost * quantity",
+	)
+	rs, err := NewRuleSet(rules)
+	if err != nil {
+		t.Fatalf("NewRuleSet err: %s", err)
+	}
+	gotOrder := []string{}
+	for _, r := range rs.Rules() {
+		gotOrder = append(gotOrder, r.Name)
+	}
+	wantOrder := []string{"cost", "margin", "isProfitable", "summary"}
+	if !reflect.DeepEqual(gotOrder, wantOrder) {
+		t.Errorf("Rules got: %v, want: %v", gotOrder, wantOrder)
+	}
+	wantDeps := []string{"isProfitable", "margin"}
+	if got := rs.Deps("summary"); !reflect.DeepEqual(got, wantDeps) {
+		t.Errorf("Deps got: %v, want: %v", got, wantDeps)
+	}
+	wantInputs := []string{"minMargin", "price", "quantity", "unitCost"}
+	if got := rs.Inputs(); !reflect.DeepEqual(got, wantInputs) {
+		t.Errorf("Inputs got: %v, want: %v", got, wantInputs)
+	}
+}
+
+func TestNewRuleSet_errors(t *testing.T) {
+	cases := []struct {
+		rules   []Rule
+		wantErr error
+	}{
+		{rules: makeRules("a", "b + 1", "b", "c * 2", "c", "a - 1"),
+			wantErr: CycleError{"a", "b", "c", "a"},
+		},
+		{rules: makeRules("x", "y", "a", "a + 1"),
+			wantErr: CycleError{"a", "a"},
+		},
+		{rules: makeRules("a", "1", "b", "2", "a", "3"),
+			wantErr: DuplicateRuleError("a"),
+		},
+	}
+	for _, c := range cases {
+		_, err := NewRuleSet(c.rules)
+		if !reflect.DeepEqual(err, c.wantErr) {
+			t.Errorf("NewRuleSet err: %v, want: %v", err, c.wantErr)
+		}
+	}
+	wantMsg := "rules use each other in a cycle: a -> b -> c -> a"
+	if got := (CycleError{"a", "b", "c", "a"}).Error(); got != wantMsg {
+		t.Errorf("Error got: %s, want: %s", got, wantMsg)
+	}
+}
+
+func TestRuleSet_Eval(t *testing.T) {
+	rs, err := NewRuleSet(makeRules(
+		"isProfitable", "margin > 0",
+		"margin", "price - cost",
+		"bad", "price / zero",
+		"usesBad", "bad + 1",
+	))
+	if err != nil {
+		t.Fatalf("NewRuleSet err: %s", err)
+	}
+	vars := map[string]*dlit.Literal{
+		"price": dlit.MustNew(12),
+		"cost":  dlit.MustNew(7),
+		"zero":  dlit.MustNew(0),
+	}
+	got := rs.Eval(vars)
+	want := map[string]string{
+		"isProfitable": "true",
+		"margin":       "5",
+		"bad":          "invalid expression: price / zero (divide by zero)",
+		"usesBad": "invalid expression: bad + 1 " +
+			"(invalid expression: price / zero (divide by zero))",
+	}
+	if len(got) != len(want) {
+		t.Errorf("Eval got: %v, want: %v", got, want)
+	}
+	for name, w := range want {
+		if l, ok := got[name]; !ok || l.String() != w {
+			t.Errorf("Eval got %s: %v, want: %s", name, l, w)
+		}
+	}
+	if err := got["usesBad"].Err(); !errors.Is(err, ErrDivByZero) {
+		t.Errorf("Eval got usesBad err: %v, want: %v", err, ErrDivByZero)
+	}
+	if len(vars) != 3 {
+		t.Errorf("Eval changed vars: %v", vars)
+	}
+}
+
+func TestNewRuleSetFromSource(t *testing.T) {
+	srcs, err := ParseRules("a = b * 2\nb = x +\n")
+	if err != nil {
+		t.Fatalf("ParseRules err: %s", err)
+	}
+	_, err = NewRuleSetFromSource(srcs, map[string]CallFun{})
+	var rerr RuleError
+	if !errors.As(err, &rerr) || rerr.Name != "b" ||
+		!errors.Is(err, ErrSyntax) {
+		t.Errorf("NewRuleSetFromSource err: %v", err)
+	}
+
+	srcs, err = ParseRules("a = b * 2\nb = x + 1\n")
+	if err != nil {
+		t.Fatalf("ParseRules err: %s", err)
+	}
+	rs, err := NewRuleSetFromSource(srcs, map[string]CallFun{})
+	if err != nil {
+		t.Fatalf("NewRuleSetFromSource err: %s", err)
+	}
+	got := rs.Eval(map[string]*dlit.Literal{"x": dlit.MustNew(3)})
+	if got["a"].String() != "8" || got["b"].String() != "4" {
+		t.Errorf("Eval got: %v", got)
+	}
+}
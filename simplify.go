@@ -0,0 +1,298 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"go/token"
+	"math"
+)
+
+// maxSimplifyPasses is the most times that the simplifier passes over
+// a tree before giving up on it becoming any simpler
+const maxSimplifyPasses = 10
+
+// Simplify returns a new expression that gives the same result as expr
+// but is simpler.  Constants are folded in the same way as Partial.  If
+// expr was made with the BoolVars option the variables true and false
+// are taken to be the bools of the same name.  The new expression uses
+// the same functions and options as expr and its source can be got
+// with String.
+//
+// The following are simplified:
+//
+//	!!a             to a             if a is a bool
+//	true && a       to a             if a is a bool
+//	false || a      to a             if a is a bool
+//	!(a && b)       to !a || !b
+//	!(a || b)       to !a && !b
+//	!(a == b)       to a != b
+//	!(a != b)       to a == b
+//	a && b && a     to a && b        if a is a bool that doesn't call
+//	                                 a function, and the same for ||
+//	a + 0, a - 0    to a             if a is a finite number
+//	a * 1, a / 1    to a             if a is a finite number
+//
+// a is only known to be a finite number if it is a finite number
+// literal or the result of an arithmetic operator, as these return an
+// error rather than an infinite number.  A variable could be "Inf",
+// which gives an error when 0 is added.  Other arithmetic isn't changed
+// because the result could overflow differently.  Ordering comparisons
+// aren't negated because NaN isn't ordered.
+func (expr *Expr) Simplify() (*Expr, error) {
+	o := options{}
+	for _, opt := range expr.opts {
+		opt(&o)
+	}
+	s := simplifier{boolVars: o.boolVars}
+	n := fold(expr.Node, nil)
+	src := Format(n)
+	for i := 0; i < maxSimplifyPasses; i++ {
+		n = fold(s.simplify(n), nil)
+		newSrc := Format(n)
+		if newSrc == src {
+			break
+		}
+		src = newSrc
+	}
+	return New(src, expr.callFuncs, expr.opts...)
+}
+
+// simplifier holds the state of a Simplify
+type simplifier struct {
+	// boolVars is whether the variables true and false are the bools
+	// of the same name
+	boolVars bool
+}
+
+// BoolVars returns an Option to say that the variables true and false
+// will always be the bools of the same name when the expression is
+// evaluated, so Simplify can treat them as constants
+func BoolVars() Option {
+	return func(o *options) {
+		o.boolVars = true
+	}
+}
+
+// simplify returns a simplified n
+func (s simplifier) simplify(n Node) Node {
+	switch x := n.(type) {
+	case *ParenNode:
+		return s.simplify(x.X)
+	case *UnaryNode:
+		if x.Op == token.NOT {
+			return s.negate(s.simplify(x.X))
+		}
+		return &UnaryNode{Op: x.Op, X: s.simplify(x.X)}
+	case *BinaryNode:
+		if x.Op == token.LAND || x.Op == token.LOR {
+			return s.simplifyChain(x)
+		}
+		bn := &BinaryNode{X: s.simplify(x.X), Op: x.Op, Y: s.simplify(x.Y)}
+		if isArithOp(bn.Op) {
+			return simplifyArith(bn)
+		}
+		return bn
+	case *CallNode:
+		return &CallNode{Name: x.Name, Args: s.simplifyNodes(x.Args)}
+	case *ListNode:
+		return &ListNode{Type: x.Type, Elts: s.simplifyNodes(x.Elts)}
+	case *IndexNode:
+		return &IndexNode{X: s.simplify(x.X), Index: s.simplify(x.Index)}
+	}
+	return n
+}
+
+func (s simplifier) simplifyNodes(ns []Node) []Node {
+	r := make([]Node, len(ns))
+	for i, n := range ns {
+		r[i] = s.simplify(n)
+	}
+	return r
+}
+
+// negate returns a node that is the negation of n, which has
+// already been simplified
+func (s simplifier) negate(n Node) Node {
+	switch x := unparenNode(n).(type) {
+	case *VarNode:
+		if !s.boolVars {
+			break
+		}
+		switch x.Name {
+		case "true":
+			return &VarNode{Name: "false"}
+		case "false":
+			return &VarNode{Name: "true"}
+		}
+	case *UnaryNode:
+		if x.Op == token.NOT && isBoolNode(x.X) {
+			return x.X
+		}
+	case *BinaryNode:
+		switch x.Op {
+		case token.LAND:
+			return s.simplifyChain(&BinaryNode{
+				X: s.negate(x.X), Op: token.LOR, Y: s.negate(x.Y),
+			})
+		case token.LOR:
+			return s.simplifyChain(&BinaryNode{
+				X: s.negate(x.X), Op: token.LAND, Y: s.negate(x.Y),
+			})
+		case token.EQL:
+			return &BinaryNode{X: x.X, Op: token.NEQ, Y: x.Y}
+		case token.NEQ:
+			return &BinaryNode{X: x.X, Op: token.EQL, Y: x.Y}
+		}
+	}
+	return foldUnary(token.NOT, n)
+}
+
+// simplifyChain simplifies a chain of && or || operators.  The chain is
+// evaluated from left to right whichever way it is grouped so it is
+// flattened before removing operands that don't affect the result.
+func (s simplifier) simplifyChain(bn *BinaryNode) Node {
+	// The value that doesn't change the result of the chain
+	identity := bn.Op == token.LAND
+	all := flattenChain(bn, bn.Op)
+	operands := []Node{}
+	seen := map[string]bool{}
+	var lastConst Node
+	for i, o := range all {
+		o = s.simplify(o)
+		all[i] = o
+		if b, ok := s.boolConst(o); ok && b == identity {
+			lastConst = o
+			continue
+		}
+		if isBoolNode(o) && !hasCall(o) {
+			src := Format(o)
+			if seen[src] {
+				continue
+			}
+			seen[src] = true
+		}
+		operands = append(operands, o)
+	}
+	switch {
+	case len(operands) == 0:
+		return lastConst
+	case len(operands) == 1 && isBoolNode(operands[0]):
+		return operands[0]
+	case len(operands) == 1:
+		// The operand must stay in a chain to keep its error if it
+		// isn't a bool
+		operands = all
+	}
+	r := operands[0]
+	for _, o := range operands[1:] {
+		r = &BinaryNode{X: r, Op: bn.Op, Y: o}
+	}
+	return r
+}
+
+// flattenChain returns the operands of a chain of op operators however
+// they are grouped
+func flattenChain(n Node, op token.Token) []Node {
+	if bn, ok := unparenNode(n).(*BinaryNode); ok && bn.Op == op {
+		return append(flattenChain(bn.X, op), flattenChain(bn.Y, op)...)
+	}
+	return []Node{n}
+}
+
+// simplifyArith removes operands of arithmetic operators that don't
+// change the value of the other operand
+func simplifyArith(bn *BinaryNode) Node {
+	switch bn.Op {
+	case token.ADD:
+		if isConstInt(bn.Y, 0) && isFiniteNum(bn.X) {
+			return bn.X
+		} else if isConstInt(bn.X, 0) && isFiniteNum(bn.Y) {
+			return bn.Y
+		}
+	case token.SUB:
+		if isConstInt(bn.Y, 0) && isFiniteNum(bn.X) {
+			return bn.X
+		}
+	case token.MUL:
+		if isConstInt(bn.Y, 1) && isFiniteNum(bn.X) {
+			return bn.X
+		} else if isConstInt(bn.X, 1) && isFiniteNum(bn.Y) {
+			return bn.Y
+		}
+	case token.QUO:
+		if isConstInt(bn.Y, 1) && isFiniteNum(bn.X) {
+			return bn.X
+		}
+	}
+	return bn
+}
+
+// isFiniteNum returns whether n always evaluates to a finite number or
+// an error
+func isFiniteNum(n Node) bool {
+	if l, ok := constValue(n); ok {
+		f, isFloat := l.Float()
+		return isFloat && !math.IsInf(f, 0) && !math.IsNaN(f)
+	}
+	b, ok := unparenNode(n).(*BinaryNode)
+	return ok && isArithOp(b.Op)
+}
+
+func isArithOp(op token.Token) bool {
+	switch op {
+	case token.ADD, token.SUB, token.MUL, token.QUO:
+		return true
+	}
+	return false
+}
+
+func isConstInt(n Node, want int64) bool {
+	if l, ok := constValue(n); ok {
+		i, isInt := l.Int()
+		return isInt && i == want
+	}
+	return false
+}
+
+// boolConst returns the value of n if it is a constant bool, or the
+// variable true or false if they are the bools of the same name
+func (s simplifier) boolConst(n Node) (bool, bool) {
+	if _, ok := unparenNode(n).(*VarNode); ok && !s.boolVars {
+		return false, false
+	}
+	return boolConst(n)
+}
+
+// boolConst returns the value of n if it is a constant bool or the
+// variable true or false
+func boolConst(n Node) (bool, bool) {
+	if v, ok := unparenNode(n).(*VarNode); ok {
+		switch v.Name {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		}
+		return false, false
+	}
+	if l, ok := constValue(n); ok {
+		return l.Bool()
+	}
+	return false, false
+}
+
+// hasCall returns whether n calls a function
+func hasCall(n Node) bool {
+	found := false
+	Inspect(n, func(n Node) bool {
+		if _, ok := n.(*CallNode); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,110 @@
+package dexpr
+
+import (
+	"github.com/lawrencewoodman/dlit"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	cases := []struct {
+		in   string
+		opts []Option
+		want string
+	}{
+		{in: "true && (x > 3) && !(!(y > 2))",
+			opts: []Option{BoolVars()},
+			want: "x > 3 && y > 2",
+		},
+		{in: "true && (x > 3) && !(!(y > 2))", want: "true && x > 3 && y > 2"},
+		{in: "false || x > 3", opts: []Option{BoolVars()}, want: "x > 3"},
+		{in: "false || x > 3", want: "false || x > 3"},
+		{in: "x > 3 && true", opts: []Option{BoolVars()}, want: "x > 3"},
+		{in: "x > 3 && true", want: "x > 3 && true"},
+		{in: "!true", opts: []Option{BoolVars()}, want: "false"},
+		{in: "!true", want: "!true"},
+		{in: "!!(a == b)", want: "a == b"},
+		{in: "!!a", want: "!!a"},
+		{in: "!(a > 1 && b < 2)", want: "!(a > 1) || !(b < 2)"},
+		{in: "!(a == 1 || b != 2)", want: "a != 1 && b == 2"},
+		{in: "!(!(a == 1) && !(b == 2))", want: "a == 1 || b == 2"},
+		{in: "!true || x > 2", opts: []Option{BoolVars()}, want: "x > 2"},
+		{in: "!true || x > 2", want: "!true || x > 2"},
+		{in: "a > 1 && (b > 2 && a > 1)", want: "a > 1 && b > 2"},
+		{in: "a > 1 || b > 2 || (a > 1)", want: "a > 1 || b > 2"},
+		{in: "f(a) > 1 && f(a) > 1", want: "f(a) > 1 && f(a) > 1"},
+		{in: "a + 0 > 5", want: "a + 0 > 5"},
+		{in: "(a - 0) * (1 * b) / 1 < c", want: "(a - 0) * (1 * b) < c"},
+		{in: "(a * b) * 1 - 0 < c", want: "a * b < c"},
+		{in: "0 + (a / b) > 5", want: "a / b > 5"},
+		{in: "a + 0", want: "a + 0"},
+		{in: "a + 0 == 5", want: "a + 0 == 5"},
+		{in: "(a * b) + 0 == 5", want: "a * b == 5"},
+		{in: "0 - a > 5", want: "0 - a > 5"},
+		{in: "a + (2 * 3) > 5 + 1", want: "a + 6 > 6"},
+		{in: "true && flag", opts: []Option{BoolVars()}, want: "true && flag"},
+		{in: "true && true", opts: []Option{BoolVars()}, want: "true"},
+	}
+	funcs := map[string]CallFun{}
+	for _, c := range cases {
+		expr := MustNew(c.in, funcs, c.opts...)
+		got, err := expr.Simplify()
+		if err != nil {
+			t.Errorf("Simplify(%s) err: %s", c.in, err)
+			continue
+		}
+		if got.String() != c.want {
+			t.Errorf("Simplify(%s) got: %s, want: %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestSimplify_sameResult(t *testing.T) {
+	cases := []string{
+		"true && (x > 3) && !(!(y > 2))",
+		"!(x > 1 && y < 2) || !(x == y)",
+		"(x - 0) * (1 * y) / 1 < 7",
+		"x + 0 == y * 1",
+		"x > 1 && (y > 2 && x > 1) || false",
+		"!(!(x == 1) || !(y != 2))",
+		"x + 0 > 5 && y * 1 < 7",
+		"(x * y) * 1 - 0 == y / x + 0",
+	}
+	values := []*dlit.Literal{
+		dlit.MustNew(-3),
+		dlit.MustNew(0),
+		dlit.MustNew(1),
+		dlit.MustNew(2.5),
+		dlit.MustNew(9223372036854775807),
+		dlit.NewString("fred"),
+		dlit.NewString("Inf"),
+	}
+	boolVars := map[string]*dlit.Literal{
+		"true": dlit.MustNew(true), "false": dlit.MustNew(false),
+	}
+	for _, in := range cases {
+		for _, opts := range [][]Option{nil, {BoolVars()}} {
+			expr := MustNew(in, map[string]CallFun{}, opts...)
+			simple, err := expr.Simplify()
+			if err != nil {
+				t.Fatalf("Simplify(%s) err: %s", in, err)
+			}
+			for _, x := range values {
+				for _, y := range values {
+					vars := map[string]*dlit.Literal{"x": x, "y": y}
+					if opts != nil {
+						for name, l := range boolVars {
+							vars[name] = l
+						}
+					}
+					want := expr.Eval(vars)
+					got := simple.Eval(vars)
+					if (got.Err() == nil) != (want.Err() == nil) ||
+						(got.Err() == nil && got.String() != want.String()) {
+						t.Errorf("Simplify(%s) = %s, x: %s, y: %s, got: %s, want: %s",
+							in, simple, x, y, got, want)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,279 @@
+/*
+ * A standard library of functions for dexpr expressions
+ *
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package stdfuncs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/lawrencewoodman/dlit"
+	"math"
+	"strings"
+)
+
+// Func describes a function in the library
+type Func struct {
+	Name string
+	// Signature shows how the function is called such as roundto(x, dp)
+	Signature string
+	Doc       string
+	Fn        dexpr.CallFun
+}
+
+// WrongNumOfArgsError indicates that a function was called with the
+// wrong number of arguments
+type WrongNumOfArgsError struct {
+	Got  int
+	Want string
+}
+
+func (e WrongNumOfArgsError) Error() string {
+	return fmt.Sprintf("wrong number of arguments: %d, want: %s", e.Got, e.Want)
+}
+
+var ErrNotNumber = errors.New("can't convert to number")
+var ErrNotInt = errors.New("can't convert to int")
+
+// All is every function in the library sorted by name
+var All = []Func{
+	{"abs", "abs(x)", "returns the absolute value of x", abs},
+	{"contains", "contains(s, substr)", "returns whether substr is within s",
+		contains},
+	{"hasprefix", "hasprefix(s, prefix)",
+		"returns whether s begins with prefix", hasPrefix},
+	{"hassuffix", "hassuffix(s, suffix)", "returns whether s ends with suffix",
+		hasSuffix},
+	{"in", "in(x, v1, v2, ...)",
+		"returns whether x is equal to any of v1, v2, ...", in},
+	{"len", "len(s)", "returns the number of bytes in s", length},
+	{"lower", "lower(s)", "returns s in lower case", lower},
+	{"max", "max(x1, x2, ...)", "returns the largest number", max},
+	{"min", "min(x1, x2, ...)", "returns the smallest number", min},
+	{"pow", "pow(x, y)", "returns x to the power of y", pow},
+	{"roundto", "roundto(x, dp)",
+		"returns x rounded half up to dp decimal places", roundTo},
+	{"sqrt", "sqrt(x)", "returns the square root of x", sqrt},
+	{"upper", "upper(s)", "returns s in upper case", upper},
+}
+
+// CallFuncs returns the functions in the library for use by dexpr.New
+func CallFuncs() map[string]dexpr.CallFun {
+	r := make(map[string]dexpr.CallFun, len(All))
+	for _, f := range All {
+		r[f.Name] = f.Fn
+	}
+	return r
+}
+
+// Lookup returns the function with the given name
+func Lookup(name string) (Func, bool) {
+	for _, f := range All {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Func{}, false
+}
+
+func abs(args []*dlit.Literal) (*dlit.Literal, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return dlit.MustNew(err), err
+	}
+	if x, isInt := args[0].Int(); isInt && x != math.MinInt64 {
+		if x < 0 {
+			x = -x
+		}
+		return dlit.MustNew(x), nil
+	}
+	x, err := toFloat(args[0])
+	if err != nil {
+		return dlit.MustNew(err), err
+	}
+	return dlit.MustNew(math.Abs(x)), nil
+}
+
+func contains(args []*dlit.Literal) (*dlit.Literal, error) {
+	if err := checkArgs(args, 2); err != nil {
+		return dlit.MustNew(err), err
+	}
+	r := strings.Contains(args[0].String(), args[1].String())
+	return dlit.MustNew(r), nil
+}
+
+func hasPrefix(args []*dlit.Literal) (*dlit.Literal, error) {
+	if err := checkArgs(args, 2); err != nil {
+		return dlit.MustNew(err), err
+	}
+	r := strings.HasPrefix(args[0].String(), args[1].String())
+	return dlit.MustNew(r), nil
+}
+
+func hasSuffix(args []*dlit.Literal) (*dlit.Literal, error) {
+	if err := checkArgs(args, 2); err != nil {
+		return dlit.MustNew(err), err
+	}
+	r := strings.HasSuffix(args[0].String(), args[1].String())
+	return dlit.MustNew(r), nil
+}
+
+var eqlExpr = dexpr.MustNew("x == v", map[string]dexpr.CallFun{})
+
+// in uses == to compare x with each value
+func in(args []*dlit.Literal) (*dlit.Literal, error) {
+	if len(args) < 2 {
+		err := WrongNumOfArgsError{Got: len(args), Want: "2 or more"}
+		return dlit.MustNew(err), err
+	}
+	for _, arg := range args {
+		if err := arg.Err(); err != nil {
+			return dlit.MustNew(err), err
+		}
+	}
+	vars := map[string]*dlit.Literal{"x": args[0]}
+	for _, v := range args[1:] {
+		vars["v"] = v
+		if isEql, err := eqlExpr.EvalBool(vars); err == nil && isEql {
+			return dlit.MustNew(true), nil
+		}
+	}
+	return dlit.MustNew(false), nil
+}
+
+func length(args []*dlit.Literal) (*dlit.Literal, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return dlit.MustNew(err), err
+	}
+	return dlit.MustNew(len(args[0].String())), nil
+}
+
+func lower(args []*dlit.Literal) (*dlit.Literal, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return dlit.MustNew(err), err
+	}
+	return dlit.NewString(strings.ToLower(args[0].String())), nil
+}
+
+func upper(args []*dlit.Literal) (*dlit.Literal, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return dlit.MustNew(err), err
+	}
+	return dlit.NewString(strings.ToUpper(args[0].String())), nil
+}
+
+func max(args []*dlit.Literal) (*dlit.Literal, error) {
+	return extreme(args, func(x, y float64) bool { return x > y })
+}
+
+func min(args []*dlit.Literal) (*dlit.Literal, error) {
+	return extreme(args, func(x, y float64) bool { return x < y })
+}
+
+// extreme returns the argument for which better is true when compared
+// with every other argument
+func extreme(
+	args []*dlit.Literal,
+	better func(float64, float64) bool,
+) (*dlit.Literal, error) {
+	if len(args) == 0 {
+		err := WrongNumOfArgsError{Got: 0, Want: "1 or more"}
+		return dlit.MustNew(err), err
+	}
+	r := args[0]
+	rF, err := toFloat(r)
+	if err != nil {
+		return dlit.MustNew(err), err
+	}
+	for _, arg := range args[1:] {
+		f, err := toFloat(arg)
+		if err != nil {
+			return dlit.MustNew(err), err
+		}
+		if better(f, rF) {
+			r, rF = arg, f
+		}
+	}
+	return r, nil
+}
+
+func pow(args []*dlit.Literal) (*dlit.Literal, error) {
+	if err := checkArgs(args, 2); err != nil {
+		return dlit.MustNew(err), err
+	}
+	x, err := toFloat(args[0])
+	if err != nil {
+		return dlit.MustNew(err), err
+	}
+	y, err := toFloat(args[1])
+	if err != nil {
+		return dlit.MustNew(err), err
+	}
+	r := math.Pow(x, y)
+	if math.IsInf(r, 0) || math.IsNaN(r) {
+		err := dexpr.ErrUnderflowOverflow
+		return dlit.MustNew(err), err
+	}
+	return dlit.MustNew(r), nil
+}
+
+func roundTo(args []*dlit.Literal) (*dlit.Literal, error) {
+	if err := checkArgs(args, 2); err != nil {
+		return dlit.MustNew(err), err
+	}
+	x, err := toFloat(args[0])
+	if err != nil {
+		return dlit.MustNew(err), err
+	}
+	dp, isInt := args[1].Int()
+	if !isInt {
+		return dlit.MustNew(ErrNotInt), ErrNotInt
+	}
+	// This uses round half-up to tie-break
+	shift := math.Pow(10, float64(dp))
+	return dlit.MustNew(math.Floor(.5+x*shift) / shift), nil
+}
+
+func sqrt(args []*dlit.Literal) (*dlit.Literal, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return dlit.MustNew(err), err
+	}
+	x, err := toFloat(args[0])
+	if err != nil {
+		return dlit.MustNew(err), err
+	}
+	if x < 0 {
+		err := errors.New("can't find square root of negative number")
+		return dlit.MustNew(err), err
+	}
+	return dlit.MustNew(math.Sqrt(x)), nil
+}
+
+// checkArgs returns an error if there aren't want args or if any of
+// them is an error
+func checkArgs(args []*dlit.Literal, want int) error {
+	if len(args) != want {
+		return WrongNumOfArgsError{Got: len(args), Want: fmt.Sprint(want)}
+	}
+	for _, arg := range args {
+		if err := arg.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toFloat(l *dlit.Literal) (float64, error) {
+	if err := l.Err(); err != nil {
+		return 0, err
+	}
+	x, isFloat := l.Float()
+	if !isFloat {
+		return 0, ErrNotNumber
+	}
+	return x, nil
+}
@@ -0,0 +1,75 @@
+package stdfuncs
+
+import (
+	"github.com/lawrencewoodman/dexpr"
+	"github.com/lawrencewoodman/dlit"
+	"sort"
+	"testing"
+)
+
+func TestCallFuncs(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{in: "abs(-5)", want: "5"},
+		{in: "abs(-2.5)", want: "2.5"},
+		{in: "contains(\"hello\", \"ell\")", want: "true"},
+		{in: "hasprefix(\"hello\", \"he\")", want: "true"},
+		{in: "hassuffix(\"hello\", \"he\")", want: "false"},
+		{in: "in(s, \"a\", \"b\", \"fred\")", want: "true"},
+		{in: "in(3, 1, 2.0, 3.0)", want: "true"},
+		{in: "in(4, 1, 2, 3)", want: "false"},
+		{in: "len(s)", want: "4"},
+		{in: "lower(\"HeLLo\")", want: "hello"},
+		{in: "upper(s)", want: "FRED"},
+		{in: "max(3, 9.5, 2)", want: "9.5"},
+		{in: "min(3, -9, 2)", want: "-9"},
+		{in: "pow(2, 10)", want: "1024"},
+		{in: "roundto(2.345, 2)", want: "2.35"},
+		{in: "sqrt(16)", want: "4"},
+	}
+	vars := map[string]*dlit.Literal{"s": dlit.NewString("fred")}
+	for _, c := range cases {
+		got := dexpr.Eval(c.in, CallFuncs(), vars)
+		if got.Err() != nil || got.String() != c.want {
+			t.Errorf("Eval(%s) got: %s, want: %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestCallFuncs_errors(t *testing.T) {
+	cases := []struct {
+		in      string
+		wantErr error
+	}{
+		{in: "abs(1, 2)", wantErr: WrongNumOfArgsError{Got: 2, Want: "1"}},
+		{in: "max()", wantErr: WrongNumOfArgsError{Got: 0, Want: "1 or more"}},
+		{in: "in(1)", wantErr: WrongNumOfArgsError{Got: 1, Want: "2 or more"}},
+		{in: "sqrt(s)", wantErr: ErrNotNumber},
+		{in: "roundto(1.5, 0.5)", wantErr: ErrNotInt},
+		{in: "pow(10, 400)", wantErr: dexpr.ErrUnderflowOverflow},
+		{in: "lower(missing)", wantErr: dexpr.VarNotExistError("missing")},
+	}
+	vars := map[string]*dlit.Literal{"s": dlit.NewString("fred")}
+	for _, c := range cases {
+		_, err := dexpr.EvalBool(c.in+" == 1", CallFuncs(), vars)
+		ferr, ok := err.(dexpr.InvalidExprError).Err.(dexpr.FunctionError)
+		if !ok || ferr.Err != c.wantErr {
+			t.Errorf("EvalBool(%s) err: %v, want: %v", c.in, err, c.wantErr)
+		}
+	}
+}
+
+func TestAll_sorted(t *testing.T) {
+	names := []string{}
+	for _, f := range All {
+		names = append(names, f.Name)
+		if l, ok := Lookup(f.Name); !ok || l.Signature != f.Signature {
+			t.Errorf("Lookup(%s) got: %v, %t", f.Name, l, ok)
+		}
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("All isn't sorted by name: %v", names)
+	}
+}
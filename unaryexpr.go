@@ -7,7 +7,6 @@
 package dexpr
 
 import (
-	"github.com/lawrencewoodman/dlit"
 	"go/ast"
 	"go/token"
 	"math"
@@ -15,71 +14,53 @@ import (
 )
 
 func unaryExprToenode(
-	callFuncs map[string]CallFun,
-	eltStore *eltStore,
+	c *compiler,
 	ue *ast.UnaryExpr,
 ) enode {
-	rh := nodeToenode(callFuncs, eltStore, ue.X)
+	rh := nodeToenode(c, ue.X)
 	if _, ok := rh.(enErr); ok {
 		return rh
 	}
 	switch ue.Op {
 	case token.NOT:
-		return enFunc{
-			fn: func(vars map[string]*dlit.Literal) *dlit.Literal {
-				return callUnaryFn(opNot, rh, vars)
-			},
-		}
+		return enUnary{op: ue.Op, fn: opNot, rh: rh}
 	case token.SUB:
-		return enFunc{
-			fn: func(vars map[string]*dlit.Literal) *dlit.Literal {
-				return callUnaryFn(opNeg, rh, vars)
-			},
-		}
+		return enUnary{op: ue.Op, fn: opNeg, rh: rh}
 	}
 	return enErr{err: InvalidOpError(ue.Op)}
 }
 
-func callUnaryFn(
-	fn unaryFn,
-	l enode,
-	vars map[string]*dlit.Literal,
-) *dlit.Literal {
-	lV := l.Eval(vars)
-	if lV.Err() != nil {
-		return lV
-	}
-	return fn(lV)
-}
+type unaryFn func(value) value
 
-type unaryFn func(*dlit.Literal) *dlit.Literal
+// posMinInt64 is math.MinInt64 without its sign, which can't itself be
+// represented as an int64
+var posMinInt64 = strconv.FormatInt(int64(math.MinInt64), 10)[1:]
 
-func opNot(l *dlit.Literal) *dlit.Literal {
+func opNot(l value) value {
 	lBool, lIsBool := l.Bool()
 	if !lIsBool {
-		return dlit.MustNew(ErrIncompatibleTypes)
+		return errValue(ErrIncompatibleTypes)
 	}
 	if lBool {
-		return falseLiteral
+		return falseValue
 	}
-	return trueLiteral
+	return trueValue
 }
 
-func opNeg(l *dlit.Literal) *dlit.Literal {
+func opNeg(l value) value {
 	lInt, lIsInt := l.Int()
 	if lIsInt {
-		return dlit.MustNew(0 - lInt)
-	}
-
-	strMinInt64 := strconv.FormatInt(int64(math.MinInt64), 10)
-	posMinInt64 := strMinInt64[1:]
-	if l.String() == posMinInt64 {
-		return dlit.MustNew(int64(math.MinInt64))
+		return intValue(0 - lInt)
 	}
 
 	lFloat, lIsFloat := l.Float()
 	if lIsFloat {
-		return dlit.MustNew(0 - lFloat)
+		// Only check the string when it could be posMinInt64 to avoid
+		// converting every float to a string
+		if lFloat == -math.MinInt64 && l.String() == posMinInt64 {
+			return intValue(int64(math.MinInt64))
+		}
+		return floatValue(0 - lFloat)
 	}
-	return dlit.MustNew(ErrIncompatibleTypes)
+	return errValue(ErrIncompatibleTypes)
 }
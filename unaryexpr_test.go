@@ -21,7 +21,7 @@ func BenchmarkOpNot(b *testing.B) {
 		}
 		for _, c := range cases {
 			b.StartTimer()
-			got := opNot(c.in)
+			got := opNot(litValue(c.in))
 			b.StopTimer()
 			if got.String() != c.want.String() {
 				b.Errorf("opNot(%s) - got: %s, want: %s", c.in, got, c.want)
@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) 2017 Lawrence Woodman <lwoodman@vlifesystems.com>
+ *
+ * Licensed under an MIT licence.  Please see LICENCE.md for details.
+ */
+
+package dexpr
+
+import (
+	"github.com/lawrencewoodman/dlit"
+	"math"
+	"strconv"
+)
+
+// value holds the intermediate results of an evaluation.  Ints, floats
+// and bools are kept unboxed so that a *dlit.Literal only has to be
+// created for the final result of an expression.
+type value struct {
+	kind valueKind
+	i    int64
+	f    float64
+	b    bool
+	l    *dlit.Literal
+	err  error
+}
+
+type valueKind uint8
+
+const (
+	vkLit valueKind = iota
+	vkInt
+	vkFloat
+	vkBool
+	vkErr
+)
+
+var trueValue = boolValue(true)
+var falseValue = boolValue(false)
+
+func litValue(l *dlit.Literal) value {
+	return value{kind: vkLit, l: l}
+}
+
+func intValue(i int64) value {
+	return value{kind: vkInt, i: i}
+}
+
+func floatValue(f float64) value {
+	return value{kind: vkFloat, f: f}
+}
+
+func boolValue(b bool) value {
+	return value{kind: vkBool, b: b}
+}
+
+func errValue(err error) value {
+	return value{kind: vkErr, err: err}
+}
+
+// Int returns the value as an int64 if it can be represented as one,
+// following the same rules as dlit.Literal.Int
+func (v value) Int() (int64, bool) {
+	switch v.kind {
+	case vkLit:
+		return v.l.Int()
+	case vkInt:
+		return v.i, true
+	case vkFloat:
+		if v.f >= math.MinInt64 && v.f < math.MaxInt64 {
+			if i := int64(v.f); float64(i) == v.f {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Float returns the value as a float64 if it can be represented as one,
+// following the same rules as dlit.Literal.Float
+func (v value) Float() (float64, bool) {
+	switch v.kind {
+	case vkLit:
+		return v.l.Float()
+	case vkInt:
+		return float64(v.i), true
+	case vkFloat:
+		return v.f, true
+	}
+	return 0, false
+}
+
+// Bool returns the value as a bool if it can be represented as one.
+// Ints and floats are rarely used as bools so rather than duplicate
+// dlit's conversion rules they are converted to a Literal to find out.
+func (v value) Bool() (bool, bool) {
+	switch v.kind {
+	case vkLit:
+		return v.l.Bool()
+	case vkBool:
+		return v.b, true
+	case vkErr:
+		return false, false
+	}
+	return v.Literal().Bool()
+}
+
+func (v value) Err() error {
+	switch v.kind {
+	case vkLit:
+		return v.l.Err()
+	case vkErr:
+		return v.err
+	}
+	return nil
+}
+
+func (v value) String() string {
+	if v.kind == vkLit {
+		return v.l.String()
+	}
+	return v.Literal().String()
+}
+
+// Literal returns the value as a *dlit.Literal
+func (v value) Literal() *dlit.Literal {
+	switch v.kind {
+	case vkInt:
+		return dlit.MustNew(v.i)
+	case vkFloat:
+		return dlit.MustNew(v.f)
+	case vkBool:
+		if v.b {
+			return trueLiteral
+		}
+		return falseLiteral
+	case vkErr:
+		return dlit.MustNew(v.err)
+	}
+	return v.l
+}
+
+// OtherString returns a string that isn't in strs, to use as a value
+// that isn't equal to any of them
+func OtherString(strs map[string]bool) string {
+	s := "other"
+	for i := 1; strs[s]; i++ {
+		s = "other" + strconv.Itoa(i)
+	}
+	return s
+}
@@ -0,0 +1,80 @@
+package dexpr
+
+import (
+	"errors"
+	"github.com/lawrencewoodman/dlit"
+	"math"
+	"testing"
+)
+
+func TestValue_matchesLiteral(t *testing.T) {
+	cases := []struct {
+		v value
+		l *dlit.Literal
+	}{
+		{v: intValue(0), l: dlit.MustNew(0)},
+		{v: intValue(1), l: dlit.MustNew(1)},
+		{v: intValue(-7), l: dlit.MustNew(-7)},
+		{v: intValue(math.MaxInt64), l: dlit.MustNew(int64(math.MaxInt64))},
+		{v: intValue(math.MinInt64), l: dlit.MustNew(int64(math.MinInt64))},
+		{v: floatValue(0), l: dlit.MustNew(0.0)},
+		{v: floatValue(1), l: dlit.MustNew(1.0)},
+		{v: floatValue(2.5), l: dlit.MustNew(2.5)},
+		{v: floatValue(-17), l: dlit.MustNew(-17.0)},
+		{v: floatValue(math.MaxFloat64), l: dlit.MustNew(math.MaxFloat64)},
+		{v: floatValue(-math.MinInt64), l: dlit.MustNew(-float64(math.MinInt64))},
+		{v: trueValue, l: dlit.MustNew(true)},
+		{v: falseValue, l: dlit.MustNew(false)},
+		{v: errValue(ErrDivByZero), l: dlit.MustNew(ErrDivByZero)},
+		{v: litValue(dlit.NewString("4.5")), l: dlit.NewString("4.5")},
+		{v: litValue(dlit.NewString("fred")), l: dlit.NewString("fred")},
+		{v: litValue(dlit.MustNew(errors.New("an error"))),
+			l: dlit.MustNew(errors.New("an error")),
+		},
+	}
+	for _, c := range cases {
+		gotInt, gotIsInt := c.v.Int()
+		wantInt, wantIsInt := c.l.Int()
+		if gotInt != wantInt || gotIsInt != wantIsInt {
+			t.Errorf("Int() value: %s, got: %d, %t, want: %d, %t",
+				c.v, gotInt, gotIsInt, wantInt, wantIsInt)
+		}
+		gotFloat, gotIsFloat := c.v.Float()
+		wantFloat, wantIsFloat := c.l.Float()
+		if gotFloat != wantFloat || gotIsFloat != wantIsFloat {
+			t.Errorf("Float() value: %s, got: %f, %t, want: %f, %t",
+				c.v, gotFloat, gotIsFloat, wantFloat, wantIsFloat)
+		}
+		gotBool, gotIsBool := c.v.Bool()
+		wantBool, wantIsBool := c.l.Bool()
+		if gotBool != wantBool || gotIsBool != wantIsBool {
+			t.Errorf("Bool() value: %s, got: %t, %t, want: %t, %t",
+				c.v, gotBool, gotIsBool, wantBool, wantIsBool)
+		}
+		if (c.v.Err() == nil) != (c.l.Err() == nil) {
+			t.Errorf("Err() value: %s, got: %s, want: %s", c.v, c.v.Err(), c.l.Err())
+		}
+		if c.v.String() != c.l.String() {
+			t.Errorf("String() got: %s, want: %s", c.v, c.l)
+		}
+		if c.v.Literal().String() != c.l.String() {
+			t.Errorf("Literal() got: %s, want: %s", c.v.Literal(), c.l)
+		}
+	}
+}
+
+func TestOtherString(t *testing.T) {
+	cases := []struct {
+		strs map[string]bool
+		want string
+	}{
+		{strs: map[string]bool{}, want: "other"},
+		{strs: map[string]bool{"UK": true, "FR": true}, want: "other"},
+		{strs: map[string]bool{"other": true, "other1": true}, want: "other2"},
+	}
+	for _, c := range cases {
+		if got := OtherString(c.strs); got != c.want {
+			t.Errorf("OtherString(%v) got: %s, want: %s", c.strs, got, c.want)
+		}
+	}
+}